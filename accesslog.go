@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// requestIDHeader is the response header logRequests puts a request's id in, so that whoever made it can tell us
+// which request they mean.
+const requestIDHeader = "X-Request-Id"
+
+// requestIDKey is the context key of a request's id.
+type requestIDKey struct{}
+
+// requestID returns the id logRequests gave the request that ctx belongs to, or "" if it isn't a request's.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// errorID returns the id to log an error in ctx with, and show to the customer instead of the error itself:
+// the id of the request it happened in, so that the error and the request it failed are logged with the same id,
+// or a new one if it didn't happen in a request.
+func errorID(ctx context.Context) string {
+	if id := requestID(ctx); id != "" {
+		return id
+	}
+	return newErrorID()
+}
+
+// statusRecorder is a http.ResponseWriter that remembers the status code of the response written to it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController get at what the underlying ResponseWriter can do, like flushing.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logRequests wraps handler so that every request is logged once it's been answered, with its method, path, status
+// code and how long it took. Each request gets an id, in the log, in its context for errorID, and in the
+// X-Request-Id response header. The query string isn't logged, because it can hold phone numbers and tokens.
+// Load balancers check /healthz and /readyz every few seconds, so those are only logged at debug level.
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := newErrorID()
+		w.Header().Set(requestIDHeader, id)
+		recorder := &statusRecorder{ResponseWriter: w}
+		handler.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+
+		status := recorder.status
+		if status == 0 {
+			// Nothing was written, which net/http answers with an empty 200 OK.
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "Request", "request_id", id, "method", r.Method, "path", r.URL.Path, "status", status, "duration", time.Since(start))
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/messagebird/go-rest-api/lookup"
+)
+
+// adminBookingsPage is the data for views/admin/bookings.gohtml.
+type adminBookingsPage struct {
+	// Date is the day shown, as YYYY-MM-DD, or empty to show all upcoming bookings.
+	Date string
+	// Reference is the booking reference looked up, if any. Then the only booking shown is the one with it.
+	Reference string
+	Bookings  []booking
+	Message   string
+	// SMSUsed is how many SMS segments we've sent today, out of SMSLimit. SMSLimit is 0 if there's no daily limit.
+	SMSUsed  int
+	SMSLimit int
+}
+
+// requireAdmin wraps handler so that it's only served to operators who log in with HTTP basic authentication,
+// using any user name and cfg.AdminPassword as the password. If no admin password is set, the admin pages don't exist.
+func requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminPassword == "" {
+			http.NotFound(w, r)
+			return
+		}
+		_, password, ok := r.BasicAuth()
+		// Compare hashes, so that the comparison takes as long whatever the length of the password tried.
+		want, got := sha256.Sum256([]byte(cfg.AdminPassword)), sha256.Sum256([]byte(password))
+		if !ok || subtle.ConstantTimeCompare(want[:], got[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="BeautyBird admin", charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// adminBookings lists upcoming bookings, earliest first, for operators.
+// With a date query parameter, like ?date=2018-08-01, it only lists the bookings on that day.
+// With a reference, like ?reference=7KQ2-M9XD-4HRT, it shows the booking a customer quotes, even a past or cancelled one.
+func (a *app) adminBookings(w http.ResponseWriter, r *http.Request) {
+	page := adminBookingsPage{Date: r.FormValue("date"), Reference: strings.TrimSpace(r.FormValue("reference"))}
+	if page.Reference != "" {
+		a.adminFindBooking(w, page)
+		return
+	}
+	var day time.Time
+	if page.Date != "" {
+		var err error
+		day, err = time.ParseInLocation("2006-01-02", page.Date, loc)
+		if err != nil {
+			page.Message = "Please enter a date like 2018-08-01."
+			renderPageIn(w, http.StatusBadRequest, adminLayout, "views/admin/bookings.gohtml", page)
+			return
+		}
+	}
+
+	bookings, err := a.store.List()
+	if err != nil {
+		slog.Error("Couldn't list bookings", "err", err)
+		page.Message = "We couldn't load the bookings. Please try again later."
+		renderPageIn(w, http.StatusInternalServerError, adminLayout, "views/admin/bookings.gohtml", page)
+		return
+	}
+	page.Bookings = upcomingBookings(bookings, a.now(), day)
+	if a.smsBudget != nil {
+		page.SMSLimit = a.smsBudget.limit
+		if page.SMSUsed, err = a.smsBudget.used(a.now()); err != nil {
+			slog.Error("Couldn't check SMS budget", "err", err)
+		}
+	}
+	renderPageIn(w, http.StatusOK, adminLayout, "views/admin/bookings.gohtml", page)
+}
+
+// adminFindBooking shows the booking with page.Reference, however the operator typed it.
+func (a *app) adminFindBooking(w http.ResponseWriter, page adminBookingsPage) {
+	reference, ok := normalizeReference(page.Reference)
+	if !ok {
+		page.Message = "Please enter a booking reference like 7KQ2-M9XD-4HRT."
+		renderPageIn(w, http.StatusBadRequest, adminLayout, "views/admin/bookings.gohtml", page)
+		return
+	}
+	b, err := a.store.GetByReference(reference)
+	if err == errBookingNotFound {
+		page.Message = "We couldn't find a booking with that reference."
+		renderPageIn(w, http.StatusNotFound, adminLayout, "views/admin/bookings.gohtml", page)
+		return
+	}
+	if err != nil {
+		slog.Error("Couldn't get booking", "reference", reference, "err", err)
+		page.Message = "We couldn't load the booking. Please try again later."
+		renderPageIn(w, http.StatusInternalServerError, adminLayout, "views/admin/bookings.gohtml", page)
+		return
+	}
+	page.Reference = reference
+	page.Bookings = []booking{b}
+	renderPageIn(w, http.StatusOK, adminLayout, "views/admin/bookings.gohtml", page)
+}
+
+// upcomingBookings returns the bookings that start after now, earliest first. Unless day is zero, only those on day.
+func upcomingBookings(bookings []booking, now, day time.Time) []booking {
+	var upcoming []booking
+	for _, b := range bookings {
+		if b.BookingTime.Before(now) {
+			continue
+		}
+		if !day.IsZero() && !sameDay(*b.BookingTime, day) {
+			continue
+		}
+		upcoming = append(upcoming, b)
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].BookingTime.Before(*upcoming[j].BookingTime)
+	})
+	return upcoming
+}
+
+// adminCancelPhone cancels every upcoming booking for a phone number, along with its reminders, and reports how many
+// it cancelled. It's for customers who leave, or ask us to forget them. Operators post the number in "phone",
+// in any format: the lookup tells us which number it really is, like when the booking was made.
+func (a *app) adminCancelPhone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	phone := strings.TrimSpace(r.FormValue("phone"))
+	if phone == "" {
+		renderPageIn(w, http.StatusBadRequest, adminLayout, "views/admin/bookings.gohtml", adminBookingsPage{Message: "Please enter a phone number."})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+	defer cancel()
+	// If the lookup fails, still cancel the bookings we can match as entered: we don't want to keep reminding
+	// someone who asked us to stop, just because MessageBird isn't answering.
+	normalized := phone
+	if number, err := a.client.Lookup(ctx, phone, &lookup.Params{CountryCode: cfg.CountryCode}); err == nil && number.Formats.E164 != "" {
+		normalized = number.Formats.E164
+	} else if err != nil {
+		slog.Warn("Couldn't look up phone number to cancel", "phone", maskPhone(phone), "err", maskPhones(err.Error()))
+	}
+
+	bookings, err := a.store.List()
+	if err != nil {
+		slog.Error("Couldn't list bookings", "err", err)
+		renderPageIn(w, http.StatusInternalServerError, adminLayout, "views/admin/bookings.gohtml", adminBookingsPage{Message: "We couldn't load the bookings. Please try again later."})
+		return
+	}
+	var cancelled, failed int
+	now := a.now()
+	for i := range bookings {
+		b := &bookings[i]
+		if b.Cancelled || b.BookingTime.Before(now) || !(samePhone(b.Phone, normalized) || samePhone(normalized, b.Phone) || samePhone(b.ContactPhone, normalized)) {
+			continue
+		}
+		if _, err := a.cancelReminders(ctx, *b); err != nil {
+			slog.Error("Couldn't cancel reminders", "booking_id", b.ID, "err", maskPhones(err.Error()))
+			failed++
+			continue
+		}
+		b.Cancelled = true
+		if err := a.store.Update(*b); err != nil {
+			slog.Error("Couldn't save cancelled booking", "booking_id", b.ID, "err", err)
+			b.Cancelled = false
+			failed++
+			continue
+		}
+		a.offerFreedSlot(ctx, *b)
+		cancelled++
+	}
+	slog.Info("Cancelled bookings for phone number", "phone", maskPhone(normalized), "cancelled", cancelled, "failed", failed)
+
+	status := http.StatusOK
+	message := fmt.Sprintf("Cancelled %d upcoming bookings for %s.", cancelled, maskPhone(normalized))
+	if failed > 0 {
+		status = http.StatusBadGateway
+		message += fmt.Sprintf(" We couldn't cancel %d more; please try again.", failed)
+	}
+	renderPageIn(w, status, adminLayout, "views/admin/bookings.gohtml", adminBookingsPage{Message: message, Bookings: upcomingBookings(bookings, now, time.Time{})})
+}
+
+// adminResendResponse is what adminResend returns to clients that ask for JSON.
+type adminResendResponse struct {
+	MessageID string `json:"message_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// adminResend sends the reminder of the booking with the id posted in "id" again, right away, for customers who say
+// they didn't get it. The scheduled reminders stay as they are, and the new SMS shows up in the audit log like any other.
+// Clients that ask for JSON get the new message's id in "message_id".
+func (a *app) adminResend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	respond := func(status int, message, messageID string) {
+		if wantsJSON(r) {
+			response := adminResendResponse{MessageID: messageID}
+			if status != http.StatusOK {
+				response.Error = message
+			}
+			writeJSON(w, status, response)
+			return
+		}
+		page := adminBookingsPage{Message: message}
+		if bookings, err := a.store.List(); err == nil {
+			page.Bookings = upcomingBookings(bookings, a.now(), time.Time{})
+		}
+		renderPageIn(w, status, adminLayout, "views/admin/bookings.gohtml", page)
+	}
+
+	b, err := a.store.Get(strings.TrimSpace(r.FormValue("id")))
+	if err == errBookingNotFound {
+		respond(http.StatusNotFound, "We couldn't find that booking.", "")
+		return
+	}
+	if err != nil {
+		slog.Error("Couldn't get booking", "err", err)
+		respond(http.StatusInternalServerError, "We couldn't load the booking. Please try again later.", "")
+		return
+	}
+	switch {
+	case b.Cancelled:
+		respond(http.StatusConflict, "That booking is cancelled, so there's nothing to remind them of.", "")
+		return
+	case b.BookingTime.Before(a.now()):
+		respond(http.StatusConflict, "That appointment has already started.", "")
+		return
+	case b.Channel == channelVoice:
+		// They may well be on a landline, which can't get an SMS.
+		respond(http.StatusConflict, "That booking has phone call reminders, so we can't send its reminder by SMS.", "")
+		return
+	case a.optedOut(b.ContactPhone):
+		respond(http.StatusConflict, fmt.Sprintf("%s has opted out of our text messages.", maskPhone(b.ContactPhone)), "")
+		return
+	}
+	text, err := reminderText(b)
+	if err != nil {
+		slog.Error("Couldn't render reminder", "booking_id", b.ID, "err", err)
+		respond(http.StatusInternalServerError, "We couldn't write the reminder. Please check the reminder template.", "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+	defer cancel()
+	// Unlike scheduled reminders, we don't retry: if it fails, the operator can try again, and a network error that
+	// hides a message MessageBird did send would only get the customer the same reminder twice.
+	msg, err := a.client.CreateSMS(ctx, branchFor(b).Originator, []string{b.ContactPhone}, text, nil)
+	if err != nil {
+		slog.Warn("Couldn't resend reminder", "booking_id", b.ID, "phone", maskPhone(b.ContactPhone), "err", maskPhones(err.Error()))
+		respond(http.StatusBadGateway, "We couldn't send the reminder. Please try again.", "")
+		return
+	}
+	slog.Info("Resent reminder", "booking_id", b.ID, "message_id", msg.ID, "phone", maskPhone(b.ContactPhone))
+	respond(http.StatusOK, fmt.Sprintf("Sent the reminder for %s again to %s, as message %s.", b.Name, maskPhone(b.ContactPhone), msg.ID), msg.ID)
+}
+
+// sameDay reports whether t falls on day, in our timezone.
+func sameDay(t, day time.Time) bool {
+	y1, m1, d1 := t.In(loc).Date()
+	y2, m2, d2 := day.In(loc).Date()
+	return y1 == y2 && m1 == m2 && d1 == d2
+}
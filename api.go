@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Booking statuses, as returned in bookingResponse.Status.
+const (
+	statusBooked = "booked"
+	statusDryRun = "dry_run"
+	statusFailed = "failed"
+)
+
+// bookingResponse is the result of a booking request. The JSON API returns it as is, and so does the booking form
+// for clients that ask for JSON; for browsers, the booking form shows its Message or Error instead.
+// Phone and ContactPhone are the numbers as MessageBird recognized them, and Country is where Phone is, so that
+// clients can show the customer we got their number right.
+type bookingResponse struct {
+	ID string `json:"id,omitempty"`
+	// Reference is what the customer quotes to cancel or reschedule; see newBookingReference.
+	Reference    string     `json:"reference,omitempty"`
+	BookingTime  *time.Time `json:"booking_time,omitempty"`
+	Channel      string     `json:"channel,omitempty"`
+	Phone        string     `json:"phone,omitempty"`
+	ContactPhone string     `json:"contact_phone,omitempty"`
+	Phones       []string   `json:"phones,omitempty"`
+	// RejectedPhones are the group's numbers that won't get reminders, because they didn't check out.
+	RejectedPhones []string    `json:"rejected_phones,omitempty"`
+	Country        string      `json:"country,omitempty"`
+	Language       string      `json:"language,omitempty"`
+	ReminderTimes  []time.Time `json:"reminder_times,omitempty"`
+	Status         string      `json:"status,omitempty"`
+	DryRun         bool        `json:"dry_run,omitempty"`
+	SMSSegments    int         `json:"sms_segments,omitempty"`
+	EstimatedCost  float64     `json:"estimated_cost,omitempty"`
+	Message        string      `json:"message,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	Code           errorCode   `json:"code,omitempty"`
+	Field          string      `json:"field,omitempty"`
+	// SuggestedTime is the earliest time we'd book instead, if the booking time didn't check out, for clients to offer.
+	SuggestedTime *time.Time `json:"suggested_time,omitempty"`
+	// Errors lists every field that's wrong, with what's wrong with it, so that clients can show them all at once.
+	// Field and Error are just the first of them.
+	Errors []fieldError `json:"errors,omitempty"`
+}
+
+// bookedResponse returns the response for b, which was booked with reminders at reminderTimes.
+// For a dry run, there's no id, and the status says nothing was booked.
+// SMSSegments counts the SMS segments of all of b's reminders together, to every number they go to, so that clients
+// can tell what they cost.
+func bookedResponse(b booking, reminderTimes []time.Time) bookingResponse {
+	segments := reminderSegments(b) * len(reminderTimes) * len(reminderRecipients(b))
+	response := bookingResponse{
+		ID:             b.ID,
+		Reference:      b.Reference,
+		BookingTime:    b.BookingTime,
+		Channel:        b.Channel,
+		Phone:          b.Phone,
+		ContactPhone:   b.ContactPhone,
+		Phones:         b.Phones,
+		RejectedPhones: b.RejectedPhones,
+		Country:        b.Country,
+		Language:       b.Language,
+		ReminderTimes:  reminderTimes,
+		Status:         statusBooked,
+		SMSSegments:    segments,
+		EstimatedCost:  smsCost(segments),
+	}
+	if b.DryRun {
+		response.Status = statusDryRun
+		response.DryRun = true
+	}
+	return response
+}
+
+// errorResponse returns the response for a booking that failed with berr.
+func errorResponse(berr *bookingError) bookingResponse {
+	return bookingResponse{Status: statusFailed, Error: berr.Message, Code: berr.Code, Field: berr.Field, Errors: berr.fieldErrors()}
+}
+
+// apiBookings makes a booking from a JSON request body, such as:
+//
+//	{"name": "Jane", "treatment": "Manicure", "phone": "+31612345678", "booking_time": "2018-08-01T14:00:00+02:00", "reminder_lead": "3h", "consent": true}
+//
+// It goes through the same validation and scheduling as the booking form, and error messages follow the Accept-Language header.
+// So do the reminders, unless the booking has a "language", like "nl".
+func (a *app) apiBookings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, bookingResponse{Error: "Use POST to make a booking.", Code: codeInvalidRequest})
+		return
+	}
+
+	var requested booking
+	if err := json.NewDecoder(r.Body).Decode(&requested); err != nil {
+		writeJSON(w, http.StatusBadRequest, bookingResponse{Error: "Please send a valid JSON booking.", Code: codeInvalidRequest})
+		return
+	}
+	// Clients that retry a request after a network error can send an Idempotency-Key header, to avoid booking twice.
+	status, response := a.createBooking(r.Context(), requested, idempotencyKey(r), requestLocale(r))
+	writeJSON(w, status, response)
+}
+
+// createBooking books requested for the JSON API and gRPC alike, and returns the status code and response to
+// answer with. If key isn't empty, it's the request's idempotency key: a request with a key that's already booked
+// gets the same response again, instead of a second booking.
+func (a *app) createBooking(ctx context.Context, requested booking, key, lang string) (int, bookingResponse) {
+	if requested.BookingTime == nil {
+		return http.StatusBadRequest, bookingResponse{Error: "Please enter a booking_time.", Code: codeInvalidBookingTime, Field: "booking_time"}
+	}
+
+	// Only take the fields a customer is allowed to set. makeBooking moves the time to the branch's timezone.
+	bookingTime := *requested.BookingTime
+	thisBooking := booking{
+		Name:         requested.Name,
+		Treatment:    requested.Treatment,
+		Staff:        requested.Staff,
+		Branch:       requested.Branch,
+		Notes:        requested.Notes,
+		Consent:      requested.Consent,
+		DryRun:       requested.DryRun,
+		Phone:        requested.Phone,
+		ContactPhone: requested.ContactPhone,
+		Phones:       requested.Phones,
+		Country:      requested.Country,
+		Email:        requested.Email,
+		BookingTime:  &bookingTime,
+		ReminderLead: requested.ReminderLead,
+		Channel:      requested.Channel,
+		Language:     requested.Language,
+	}
+
+	if key != "" && a.idempotency != nil {
+		previous, busy := a.idempotency.start(key, a.now())
+		if busy {
+			return http.StatusConflict, errorResponse(&bookingError{http.StatusConflict, codeDuplicateRequest, translate(lang, "duplicate_request"), "", nil})
+		}
+		if previous != nil {
+			return previous.status, previous.response
+		}
+		defer a.idempotency.abort(key)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.APITimeout)
+	defer cancel()
+	thisBooking, reminderTimes, berr := a.makeBooking(ctx, thisBooking, lang)
+	a.metrics.booking(berr, thisBooking.DryRun)
+	if berr != nil {
+		response := errorResponse(berr)
+		response.SuggestedTime = thisBooking.SuggestedTime
+		return berr.Status, response
+	}
+
+	response := bookedResponse(thisBooking, reminderTimes)
+	if key != "" && a.idempotency != nil {
+		a.idempotency.finish(key, idempotentResult{http.StatusCreated, thisBooking, response}, a.now())
+	}
+	return http.StatusCreated, response
+}
+
+// wantsJSON reports whether the Accept header of r asks for JSON rather than HTML.
+// Browsers accept anything, so only an Accept header that lists JSON before HTML counts.
+func wantsJSON(r *http.Request) bool {
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(mediaRange, ";")
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json":
+			return true
+		case "text/html":
+			return false
+		}
+	}
+	return false
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Couldn't write JSON response", "err", err)
+	}
+}
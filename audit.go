@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/messagebird/go-rest-api/balance"
+	"github.com/messagebird/go-rest-api/conversation"
+	"github.com/messagebird/go-rest-api/lookup"
+	"github.com/messagebird/go-rest-api/sms"
+	"github.com/messagebird/go-rest-api/voicemessage"
+)
+
+// Outcomes of an SMS send, as recorded in the audit log.
+const (
+	auditSent      = "sent"
+	auditScheduled = "scheduled"
+	auditFailed    = "failed"
+)
+
+// defaultAuditRecords is how many records a memoryAuditLog keeps.
+const defaultAuditRecords = 1000
+
+// defaultAuditLogSize is how big a fileAuditLog's file grows before it's rotated, in bytes.
+const defaultAuditLogSize = 10 << 20
+
+// auditRecord is what we record about every SMS we ask MessageBird to send or schedule.
+type auditRecord struct {
+	Time time.Time `json:"time"`
+	// Recipients are masked like in our logs, so that the audit log doesn't hold on to customers' numbers.
+	Recipients []string `json:"recipients"`
+	// MessageID is MessageBird's id for the message. It's empty if MessageBird didn't accept it.
+	MessageID string `json:"message_id,omitempty"`
+	// ScheduledAt is when MessageBird will send the message, for reminders. It's nil for messages sent right away.
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	// Outcome is auditSent, auditScheduled or auditFailed.
+	Outcome string `json:"outcome"`
+	// Error is why the message failed, with any phone numbers in it masked.
+	Error string `json:"error,omitempty"`
+}
+
+// auditLog is an append-only record of the SMS we send, for billing disputes and compliance.
+// To send the records somewhere else, like a log collector, implement it and set it up in main.
+type auditLog interface {
+	// Append records r.
+	Append(r auditRecord) error
+	// Recent returns up to n of the latest records, newest first.
+	Recent(n int) ([]auditRecord, error)
+}
+
+// memoryAuditLog is an auditLog that keeps the latest records in memory. They're lost when the application stops.
+type memoryAuditLog struct {
+	size int
+
+	mu      sync.Mutex
+	records []auditRecord
+}
+
+// newMemoryAuditLog returns a memoryAuditLog that keeps the latest size records.
+func newMemoryAuditLog(size int) *memoryAuditLog {
+	return &memoryAuditLog{size: size}
+}
+
+func (l *memoryAuditLog) Append(r auditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, r)
+	if len(l.records) > l.size {
+		l.records = append(l.records[:0], l.records[len(l.records)-l.size:]...)
+	}
+	return nil
+}
+
+func (l *memoryAuditLog) Recent(n int) ([]auditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return latest(l.records, n), nil
+}
+
+// fileAuditLog is an auditLog that appends records to a file, as JSON lines. Once the file has grown to maxSize bytes,
+// it's renamed to the same path with ".1" added, replacing the one before it, and a new file is started.
+type fileAuditLog struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// newFileAuditLog opens, or creates, the audit log at path.
+func newFileAuditLog(path string, maxSize int64) (*fileAuditLog, error) {
+	l := &fileAuditLog{path: path, maxSize: maxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *fileAuditLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+func (l *fileAuditLog) Append(r auditRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate moves the current file out of the way and starts a new one.
+func (l *fileAuditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *fileAuditLog) Recent(n int) ([]auditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// The latest records may have only just been rotated, so read the previous file too.
+	var records []auditRecord
+	for _, path := range []string{l.path + ".1", l.path} {
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var r auditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				file.Close()
+				return nil, err
+			}
+			records = append(records, r)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return latest(records, n), nil
+}
+
+// latest returns up to n of the last of records, in reverse order.
+func latest(records []auditRecord, n int) []auditRecord {
+	var newest []auditRecord
+	for i := len(records) - 1; i >= 0 && len(newest) < n; i-- {
+		newest = append(newest, records[i])
+	}
+	return newest
+}
+
+// auditedClient is a messagingClient that records every SMS sent through client in log.
+// If recording fails, the message is still sent, and the failure is logged.
+type auditedClient struct {
+	client messagingClient
+	log    auditLog
+	now    func() time.Time
+}
+
+func (c auditedClient) Lookup(ctx context.Context, phone string, params *lookup.Params) (*lookup.Lookup, error) {
+	return c.client.Lookup(ctx, phone, params)
+}
+
+func (c auditedClient) CreateSMS(ctx context.Context, originator string, recipients []string, body string, params *sms.Params) (*sms.Message, error) {
+	msg, err := c.client.CreateSMS(ctx, originator, recipients, body, params)
+
+	record := auditRecord{Time: c.now(), Outcome: auditSent}
+	for _, recipient := range recipients {
+		record.Recipients = append(record.Recipients, maskPhone(recipient))
+	}
+	if params != nil && !params.ScheduledDatetime.IsZero() {
+		scheduledAt := params.ScheduledDatetime
+		record.ScheduledAt, record.Outcome = &scheduledAt, auditScheduled
+	}
+	if msg != nil {
+		record.MessageID = msg.ID
+	}
+	if err != nil {
+		record.Outcome, record.Error = auditFailed, maskPhones(err.Error())
+	}
+	if err := c.log.Append(record); err != nil {
+		slog.Error("Couldn't write audit record", "message_id", record.MessageID, "err", err)
+	}
+	return msg, err
+}
+
+func (c auditedClient) ReadSMS(ctx context.Context, id string) (*sms.Message, error) {
+	return c.client.ReadSMS(ctx, id)
+}
+
+func (c auditedClient) DeleteSMS(ctx context.Context, id string) (*sms.Message, error) {
+	return c.client.DeleteSMS(ctx, id)
+}
+
+func (c auditedClient) StartConversation(ctx context.Context, req *conversation.StartRequest) (*conversation.Conversation, error) {
+	return c.client.StartConversation(ctx, req)
+}
+
+func (c auditedClient) CreateVoiceMessage(ctx context.Context, recipients []string, body string, params *voicemessage.Params) (*voicemessage.VoiceMessage, error) {
+	return c.client.CreateVoiceMessage(ctx, recipients, body, params)
+}
+
+func (c auditedClient) Balance(ctx context.Context) (*balance.Balance, error) {
+	return c.client.Balance(ctx)
+}
+
+// adminAuditRecords is how many records /admin/audit shows.
+const adminAuditRecords = 200
+
+// adminAuditPage is the data for views/admin/audit.gohtml.
+type adminAuditPage struct {
+	Records []auditRecord
+	Message string
+}
+
+// adminAudit shows operators the latest records in the audit log, newest first.
+func (a *app) adminAudit(w http.ResponseWriter, r *http.Request) {
+	if a.audit == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var page adminAuditPage
+	records, err := a.audit.Recent(adminAuditRecords)
+	if err != nil {
+		slog.Error("Couldn't read audit log", "err", err)
+		page.Message = "We couldn't load the audit log. Please try again later."
+		renderPageIn(w, http.StatusInternalServerError, adminLayout, "views/admin/audit.gohtml", page)
+		return
+	}
+	page.Records = records
+	renderPageIn(w, http.StatusOK, adminLayout, "views/admin/audit.gohtml", page)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// slot is a time customers can book, as listed by /slots.
+type slot struct {
+	Time time.Time `json:"time"`
+	// Staff lists the stylists who are free at Time. It's empty if customers don't choose a stylist.
+	Staff []string `json:"staff,omitempty"`
+}
+
+// slotsResponse is the result of a request to /slots.
+type slotsResponse struct {
+	Date      string `json:"date"`
+	Branch    string `json:"branch"`
+	Treatment string `json:"treatment"`
+	// BufferMinutes is how long stylists are kept free after each appointment, cfg.AppointmentBuffer.
+	// Slots are at least that far from the appointments around them.
+	BufferMinutes int    `json:"buffer_minutes"`
+	Slots         []slot `json:"slots"`
+}
+
+// slotTimes returns the times on day at which a treatment taking duration can start at branch, step apart from
+// opening time, and finishing by closing time. They don't take bookings into account: see availableSlots for that.
+func slotTimes(branch Branch, day time.Time, duration, step time.Duration) []time.Time {
+	openingTime, closingTime, open := branch.BusinessHours.On(day.In(branch.Timezone))
+	if !open {
+		return nil
+	}
+	var times []time.Time
+	for t := openingTime; !t.Add(duration).After(closingTime); t = t.Add(step) {
+		times = append(times, t)
+	}
+	return times
+}
+
+// availableSlots returns the times on day at which customers can book treatment at branch, with reminderDiff as their
+// reminder lead, as of now: the slotTimes that checkTime accepts, that the branch has a chair free for, for as many
+// slots as treatment takes, and, if the salon has stylists, that one of them is free for. If staff isn't empty, only
+// that stylist counts. If the branch is fully booked that day, there are none.
+func (a *app) availableSlots(branch Branch, day time.Time, treatment Treatment, staff string, reminderDiff time.Duration, now time.Time) ([]slot, error) {
+	stylists := cfg.Staff
+	if staff != "" {
+		stylists = []string{staff}
+	}
+	var bookings []booking
+	if len(stylists) > 0 || branch.MaxBookingsPerDay > 0 || branch.Chairs > 0 {
+		var err error
+		if bookings, err = a.store.List(); err != nil {
+			return nil, err
+		}
+	}
+	if dayFull(bookings, booking{Branch: branch.Name, BookingTime: &day}) {
+		return nil, nil
+	}
+
+	step := cfg.SlotGranularity
+	if step <= 0 {
+		step = defaultSlotMinutes * time.Minute
+	}
+	var slots []slot
+	for _, t := range slotTimes(branch, day, treatment.Duration, step) {
+		if terrs, _ := checkTime(branch, t, treatment.Duration, reminderDiff, now); len(terrs) > 0 {
+			continue
+		}
+		if !chairFree(bookings, booking{Branch: branch.Name, BookingTime: &t}, treatment.Duration) {
+			continue
+		}
+		if len(stylists) == 0 {
+			slots = append(slots, slot{Time: t})
+			continue
+		}
+		s := slot{Time: t}
+		for _, stylist := range stylists {
+			b := booking{Staff: stylist, Branch: branch.Name, BookingTime: &t}
+			if !staffFree(bookings, b, treatment.Duration) {
+				continue
+			}
+			held, err := a.heldByOther(b, treatment.Duration)
+			if err != nil {
+				return nil, err
+			}
+			if !held {
+				s.Staff = append(s.Staff, stylist)
+			}
+		}
+		if len(s.Staff) > 0 {
+			slots = append(slots, s)
+		}
+	}
+	return slots, nil
+}
+
+// slots serves /slots: the times customers can book on a day, as JSON, for front ends that want to offer a choice
+// instead of a free-form time. It takes the same parameters as the booking form, like
+// /slots?date=2018-08-01&treatment=Manicure, with optional branch, staff and reminder_lead.
+func (a *app) slots(w http.ResponseWriter, r *http.Request) {
+	lang := requestLocale(r)
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, bookingResponse{Error: "Use GET to list slots.", Code: codeInvalidRequest})
+		return
+	}
+
+	branch, ok := findBranch(r.FormValue("branch"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, errorResponse(&bookingError{http.StatusBadRequest, codeInvalidBranch, translate(lang, "invalid_branch"), "branch", nil}))
+		return
+	}
+	day, err := time.ParseInLocation("2006-01-02", r.FormValue("date"), branch.Timezone)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(&bookingError{http.StatusBadRequest, codeInvalidBookingTime, translate(lang, "invalid_date"), "date", nil}))
+		return
+	}
+	treatment, ok := findTreatment(r.FormValue("treatment"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, errorResponse(&bookingError{http.StatusBadRequest, codeInvalidTreatment, translate(lang, "invalid_treatment"), "treatment", nil}))
+		return
+	}
+	staff := r.FormValue("staff")
+	if staff != "" && !validStaff(staff) {
+		writeJSON(w, http.StatusBadRequest, errorResponse(&bookingError{http.StatusBadRequest, codeInvalidStaff, translate(lang, "invalid_staff"), "staff", nil}))
+		return
+	}
+	reminderDiff, err := reminderDiffFor(r.FormValue("reminder_lead"), treatment, lang)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(&bookingError{http.StatusBadRequest, codeInvalidReminderLead, err.Error(), "reminder_lead", nil}))
+		return
+	}
+
+	slots, err := a.availableSlots(branch, day, treatment, staff, reminderDiff, a.now())
+	if err != nil {
+		slog.Error("Couldn't list slots", "date", r.FormValue("date"), "err", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse(&bookingError{http.StatusInternalServerError, codeStoreFailed, translate(lang, "slots_failed"), "", nil}))
+		return
+	}
+	if slots == nil {
+		// A day without free slots is an empty list, not null.
+		slots = []slot{}
+	}
+	writeJSON(w, http.StatusOK, slotsResponse{
+		Date:          day.Format("2006-01-02"),
+		Branch:        branch.Name,
+		Treatment:     treatment.Name,
+		BufferMinutes: int(cfg.AppointmentBuffer / time.Minute),
+		Slots:         slots,
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// getSlots asks a's /slots for the slots of treatment on 11 March, the day after testNow, and returns their times.
+func getSlots(t *testing.T, a *app, treatment string) []time.Time {
+	t.Helper()
+	w := httptest.NewRecorder()
+	a.slots(w, httptest.NewRequest("GET", "/slots?date=2026-03-11&treatment="+treatment, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var response slotsResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Slots == nil {
+		t.Fatal("got slots null, want a list")
+	}
+	var times []time.Time
+	for _, s := range response.Slots {
+		times = append(times, s.Time)
+	}
+	return times
+}
+
+func TestSlotsFitTreatmentBeforeClosing(t *testing.T) {
+	a, _ := newTestApp(t)
+	closing := time.Date(2026, 3, 11, 18, 0, 0, 0, loc)
+
+	times := getSlots(t, a, "Colouring")
+	if len(times) == 0 {
+		t.Fatal("got no slots")
+	}
+	// Colouring takes 2 hours, so the last slot is at 16:00.
+	if last := times[len(times)-1]; !last.Equal(closing.Add(-2 * time.Hour)) {
+		t.Errorf("last slot is at %v, want %v", last, closing.Add(-2*time.Hour))
+	}
+}
+
+func TestSlotsForTreatmentLongerThanOpeningHours(t *testing.T) {
+	a, _ := newTestApp(t)
+	cfg.Treatments = append(cfg.Treatments, Treatment{Name: "Makeover", Duration: 10 * time.Hour})
+
+	if times := getSlots(t, a, "Makeover"); len(times) != 0 {
+		t.Errorf("got slots %v for a treatment longer than the opening hours, want none", times)
+	}
+	// The booking form turns it down too.
+	w := postForm(a.bbScheduler, "/", bookingForm("treatment", "Makeover", "time", "09:00"), "Accept", "application/json")
+	var response bookingResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != codeRunsPastClosing {
+		t.Errorf("got code %q, want %q", response.Code, codeRunsPastClosing)
+	}
+}
+
+func TestLongTreatmentTakesEverySlotItSpans(t *testing.T) {
+	a, _ := newTestApp(t)
+	cfg.Branches[0].Chairs = 1
+	bookForTest(t, a, "treatment", "Colouring", "time", "10:00")
+
+	at := func(hour, minute int) time.Time { return time.Date(2026, 3, 11, hour, minute, 0, 0, loc) }
+	times := getSlots(t, a, "Haircut")
+	// A haircut takes 45 minutes, so 9:30 would run into the colouring, which takes the chair until 12:00.
+	for _, taken := range []time.Time{at(9, 30), at(10, 0), at(10, 30), at(11, 0), at(11, 30)} {
+		if slices.ContainsFunc(times, taken.Equal) {
+			t.Errorf("got slot %v, which the colouring at 10:00 takes", taken)
+		}
+	}
+	for _, free := range []time.Time{at(9, 0), at(12, 0)} {
+		if !slices.ContainsFunc(times, free.Equal) {
+			t.Errorf("slot %v is missing", free)
+		}
+	}
+
+	w := postForm(a.bbScheduler, "/", bookingForm("time", "11:30"), "Accept", "application/json")
+	var response bookingResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != codeSlotTaken {
+		t.Errorf("booking inside the colouring got code %q, want %q", response.Code, codeSlotTaken)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/messagebird/go-rest-api/balance"
+)
+
+// balanceCacheTTL is how long we keep the balance we got from MessageBird before asking for it again.
+const balanceCacheTTL = time.Minute
+
+// balanceCache keeps the account's balance for balanceCacheTTL, so that operators refreshing /admin/balance don't
+// send MessageBird a request every time.
+type balanceCache struct {
+	mu      sync.Mutex
+	balance *balance.Balance
+	fetched time.Time
+}
+
+// get returns the balance of the account behind client, and when we got it, as of now. Only one request at a time asks
+// MessageBird; the others wait for its answer.
+func (c *balanceCache) get(ctx context.Context, client messagingClient, now time.Time) (*balance.Balance, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.balance != nil && now.Sub(c.fetched) < balanceCacheTTL {
+		return c.balance, c.fetched, nil
+	}
+	b, err := client.Balance(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	c.balance, c.fetched = b, now
+	if lowBalance(b) {
+		slog.Warn("MessageBird balance is low", "amount", b.Amount, "type", b.Type, "threshold", cfg.LowBalance)
+	}
+	return b, now, nil
+}
+
+// lowBalance reports whether b is below cfg.LowBalance, so that it's time to top up before sending starts to fail.
+func lowBalance(b *balance.Balance) bool {
+	return cfg.LowBalance > 0 && float64(b.Amount) < cfg.LowBalance
+}
+
+// adminBalancePage is the data for views/admin/balance.gohtml.
+type adminBalancePage struct {
+	Balance *balance.Balance
+	// Fetched is when we got Balance from MessageBird.
+	Fetched time.Time
+	// Low is set when Balance is below LowBalance, cfg.LowBalance.
+	Low        bool
+	LowBalance float64
+	Message    string
+}
+
+// adminBalance shows operators how much credit is left on the MessageBird account, and warns them when it's running
+// low. Once it runs out, MessageBird turns down every SMS we send or schedule.
+func (a *app) adminBalance(w http.ResponseWriter, r *http.Request) {
+	if a.balance == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+	defer cancel()
+	page := adminBalancePage{LowBalance: cfg.LowBalance}
+	b, fetched, err := a.balance.get(ctx, a.client, a.now())
+	if err != nil {
+		slog.Error("Couldn't get MessageBird balance", "err", err)
+		page.Message = "We couldn't get your balance from MessageBird. Please try again later."
+		renderPageIn(w, http.StatusBadGateway, adminLayout, "views/admin/balance.gohtml", page)
+		return
+	}
+	page.Balance, page.Fetched, page.Low = b, fetched, lowBalance(b)
+	renderPageIn(w, http.StatusOK, adminLayout, "views/admin/balance.gohtml", page)
+}
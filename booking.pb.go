@@ -0,0 +1,448 @@
+// The gRPC service our own services can book appointments with, next to the JSON API at /api/bookings.
+// Set GRPC_ADDR to serve it. CreateBooking goes through the same validation and scheduling as the JSON API, and takes
+// and returns the same fields: see the readme.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: booking.proto
+
+package main
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CreateBookingRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Name         string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Treatment    string                 `protobuf:"bytes,2,opt,name=treatment,proto3" json:"treatment,omitempty"`
+	Staff        string                 `protobuf:"bytes,3,opt,name=staff,proto3" json:"staff,omitempty"`
+	Branch       string                 `protobuf:"bytes,4,opt,name=branch,proto3" json:"branch,omitempty"`
+	Notes        string                 `protobuf:"bytes,5,opt,name=notes,proto3" json:"notes,omitempty"`
+	Consent      bool                   `protobuf:"varint,6,opt,name=consent,proto3" json:"consent,omitempty"`
+	DryRun       bool                   `protobuf:"varint,7,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	Phone        string                 `protobuf:"bytes,8,opt,name=phone,proto3" json:"phone,omitempty"`
+	ContactPhone string                 `protobuf:"bytes,9,opt,name=contact_phone,json=contactPhone,proto3" json:"contact_phone,omitempty"`
+	Phones       []string               `protobuf:"bytes,10,rep,name=phones,proto3" json:"phones,omitempty"`
+	Country      string                 `protobuf:"bytes,11,opt,name=country,proto3" json:"country,omitempty"`
+	Email        string                 `protobuf:"bytes,12,opt,name=email,proto3" json:"email,omitempty"`
+	BookingTime  *timestamppb.Timestamp `protobuf:"bytes,13,opt,name=booking_time,json=bookingTime,proto3" json:"booking_time,omitempty"`
+	// Like "3h". Empty for the treatment's default.
+	ReminderLead  string `protobuf:"bytes,14,opt,name=reminder_lead,json=reminderLead,proto3" json:"reminder_lead,omitempty"`
+	Channel       string `protobuf:"bytes,15,opt,name=channel,proto3" json:"channel,omitempty"`
+	Language      string `protobuf:"bytes,16,opt,name=language,proto3" json:"language,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateBookingRequest) Reset() {
+	*x = CreateBookingRequest{}
+	mi := &file_booking_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateBookingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateBookingRequest) ProtoMessage() {}
+
+func (x *CreateBookingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateBookingRequest.ProtoReflect.Descriptor instead.
+func (*CreateBookingRequest) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CreateBookingRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetTreatment() string {
+	if x != nil {
+		return x.Treatment
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetStaff() string {
+	if x != nil {
+		return x.Staff
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetBranch() string {
+	if x != nil {
+		return x.Branch
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetConsent() bool {
+	if x != nil {
+		return x.Consent
+	}
+	return false
+}
+
+func (x *CreateBookingRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *CreateBookingRequest) GetPhone() string {
+	if x != nil {
+		return x.Phone
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetContactPhone() string {
+	if x != nil {
+		return x.ContactPhone
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetPhones() []string {
+	if x != nil {
+		return x.Phones
+	}
+	return nil
+}
+
+func (x *CreateBookingRequest) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetBookingTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.BookingTime
+	}
+	return nil
+}
+
+func (x *CreateBookingRequest) GetReminderLead() string {
+	if x != nil {
+		return x.ReminderLead
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *CreateBookingRequest) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+type CreateBookingResponse struct {
+	state          protoimpl.MessageState   `protogen:"open.v1"`
+	Id             string                   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	BookingTime    *timestamppb.Timestamp   `protobuf:"bytes,2,opt,name=booking_time,json=bookingTime,proto3" json:"booking_time,omitempty"`
+	Channel        string                   `protobuf:"bytes,3,opt,name=channel,proto3" json:"channel,omitempty"`
+	Phone          string                   `protobuf:"bytes,4,opt,name=phone,proto3" json:"phone,omitempty"`
+	ContactPhone   string                   `protobuf:"bytes,5,opt,name=contact_phone,json=contactPhone,proto3" json:"contact_phone,omitempty"`
+	Phones         []string                 `protobuf:"bytes,6,rep,name=phones,proto3" json:"phones,omitempty"`
+	RejectedPhones []string                 `protobuf:"bytes,7,rep,name=rejected_phones,json=rejectedPhones,proto3" json:"rejected_phones,omitempty"`
+	Country        string                   `protobuf:"bytes,8,opt,name=country,proto3" json:"country,omitempty"`
+	Language       string                   `protobuf:"bytes,9,opt,name=language,proto3" json:"language,omitempty"`
+	ReminderTimes  []*timestamppb.Timestamp `protobuf:"bytes,10,rep,name=reminder_times,json=reminderTimes,proto3" json:"reminder_times,omitempty"`
+	// "booked", or "dry_run" when nothing was booked.
+	Status        string  `protobuf:"bytes,11,opt,name=status,proto3" json:"status,omitempty"`
+	DryRun        bool    `protobuf:"varint,12,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	SmsSegments   int32   `protobuf:"varint,13,opt,name=sms_segments,json=smsSegments,proto3" json:"sms_segments,omitempty"`
+	EstimatedCost float64 `protobuf:"fixed64,14,opt,name=estimated_cost,json=estimatedCost,proto3" json:"estimated_cost,omitempty"`
+	// What the customer quotes to cancel or reschedule, like "7KQ2-M9XD-4HRT". Empty for a dry run.
+	Reference     string `protobuf:"bytes,15,opt,name=reference,proto3" json:"reference,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateBookingResponse) Reset() {
+	*x = CreateBookingResponse{}
+	mi := &file_booking_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateBookingResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateBookingResponse) ProtoMessage() {}
+
+func (x *CreateBookingResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_booking_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateBookingResponse.ProtoReflect.Descriptor instead.
+func (*CreateBookingResponse) Descriptor() ([]byte, []int) {
+	return file_booking_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateBookingResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CreateBookingResponse) GetBookingTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.BookingTime
+	}
+	return nil
+}
+
+func (x *CreateBookingResponse) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *CreateBookingResponse) GetPhone() string {
+	if x != nil {
+		return x.Phone
+	}
+	return ""
+}
+
+func (x *CreateBookingResponse) GetContactPhone() string {
+	if x != nil {
+		return x.ContactPhone
+	}
+	return ""
+}
+
+func (x *CreateBookingResponse) GetPhones() []string {
+	if x != nil {
+		return x.Phones
+	}
+	return nil
+}
+
+func (x *CreateBookingResponse) GetRejectedPhones() []string {
+	if x != nil {
+		return x.RejectedPhones
+	}
+	return nil
+}
+
+func (x *CreateBookingResponse) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *CreateBookingResponse) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *CreateBookingResponse) GetReminderTimes() []*timestamppb.Timestamp {
+	if x != nil {
+		return x.ReminderTimes
+	}
+	return nil
+}
+
+func (x *CreateBookingResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *CreateBookingResponse) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *CreateBookingResponse) GetSmsSegments() int32 {
+	if x != nil {
+		return x.SmsSegments
+	}
+	return 0
+}
+
+func (x *CreateBookingResponse) GetEstimatedCost() float64 {
+	if x != nil {
+		return x.EstimatedCost
+	}
+	return 0
+}
+
+func (x *CreateBookingResponse) GetReference() string {
+	if x != nil {
+		return x.Reference
+	}
+	return ""
+}
+
+var File_booking_proto protoreflect.FileDescriptor
+
+const file_booking_proto_rawDesc = "" +
+	"\n" +
+	"\rbooking.proto\x12\treminders\x1a\x1fgoogle/protobuf/timestamp.proto\"\xdc\x03\n" +
+	"\x14CreateBookingRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1c\n" +
+	"\ttreatment\x18\x02 \x01(\tR\ttreatment\x12\x14\n" +
+	"\x05staff\x18\x03 \x01(\tR\x05staff\x12\x16\n" +
+	"\x06branch\x18\x04 \x01(\tR\x06branch\x12\x14\n" +
+	"\x05notes\x18\x05 \x01(\tR\x05notes\x12\x18\n" +
+	"\aconsent\x18\x06 \x01(\bR\aconsent\x12\x17\n" +
+	"\adry_run\x18\a \x01(\bR\x06dryRun\x12\x14\n" +
+	"\x05phone\x18\b \x01(\tR\x05phone\x12#\n" +
+	"\rcontact_phone\x18\t \x01(\tR\fcontactPhone\x12\x16\n" +
+	"\x06phones\x18\n" +
+	" \x03(\tR\x06phones\x12\x18\n" +
+	"\acountry\x18\v \x01(\tR\acountry\x12\x14\n" +
+	"\x05email\x18\f \x01(\tR\x05email\x12=\n" +
+	"\fbooking_time\x18\r \x01(\v2\x1a.google.protobuf.TimestampR\vbookingTime\x12#\n" +
+	"\rreminder_lead\x18\x0e \x01(\tR\freminderLead\x12\x18\n" +
+	"\achannel\x18\x0f \x01(\tR\achannel\x12\x1a\n" +
+	"\blanguage\x18\x10 \x01(\tR\blanguage\"\x8e\x04\n" +
+	"\x15CreateBookingResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12=\n" +
+	"\fbooking_time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\vbookingTime\x12\x18\n" +
+	"\achannel\x18\x03 \x01(\tR\achannel\x12\x14\n" +
+	"\x05phone\x18\x04 \x01(\tR\x05phone\x12#\n" +
+	"\rcontact_phone\x18\x05 \x01(\tR\fcontactPhone\x12\x16\n" +
+	"\x06phones\x18\x06 \x03(\tR\x06phones\x12'\n" +
+	"\x0frejected_phones\x18\a \x03(\tR\x0erejectedPhones\x12\x18\n" +
+	"\acountry\x18\b \x01(\tR\acountry\x12\x1a\n" +
+	"\blanguage\x18\t \x01(\tR\blanguage\x12A\n" +
+	"\x0ereminder_times\x18\n" +
+	" \x03(\v2\x1a.google.protobuf.TimestampR\rreminderTimes\x12\x16\n" +
+	"\x06status\x18\v \x01(\tR\x06status\x12\x17\n" +
+	"\adry_run\x18\f \x01(\bR\x06dryRun\x12!\n" +
+	"\fsms_segments\x18\r \x01(\x05R\vsmsSegments\x12%\n" +
+	"\x0eestimated_cost\x18\x0e \x01(\x01R\restimatedCost\x12\x1c\n" +
+	"\treference\x18\x0f \x01(\tR\treference2^\n" +
+	"\bBookings\x12R\n" +
+	"\rCreateBooking\x12\x1f.reminders.CreateBookingRequest\x1a .reminders.CreateBookingResponseB6Z4github.com/messagebirdguides/reminders-guide-go;mainb\x06proto3"
+
+var (
+	file_booking_proto_rawDescOnce sync.Once
+	file_booking_proto_rawDescData []byte
+)
+
+func file_booking_proto_rawDescGZIP() []byte {
+	file_booking_proto_rawDescOnce.Do(func() {
+		file_booking_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_booking_proto_rawDesc), len(file_booking_proto_rawDesc)))
+	})
+	return file_booking_proto_rawDescData
+}
+
+var file_booking_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_booking_proto_goTypes = []any{
+	(*CreateBookingRequest)(nil),  // 0: reminders.CreateBookingRequest
+	(*CreateBookingResponse)(nil), // 1: reminders.CreateBookingResponse
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_booking_proto_depIdxs = []int32{
+	2, // 0: reminders.CreateBookingRequest.booking_time:type_name -> google.protobuf.Timestamp
+	2, // 1: reminders.CreateBookingResponse.booking_time:type_name -> google.protobuf.Timestamp
+	2, // 2: reminders.CreateBookingResponse.reminder_times:type_name -> google.protobuf.Timestamp
+	0, // 3: reminders.Bookings.CreateBooking:input_type -> reminders.CreateBookingRequest
+	1, // 4: reminders.Bookings.CreateBooking:output_type -> reminders.CreateBookingResponse
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_booking_proto_init() }
+func file_booking_proto_init() {
+	if File_booking_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_booking_proto_rawDesc), len(file_booking_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_booking_proto_goTypes,
+		DependencyIndexes: file_booking_proto_depIdxs,
+		MessageInfos:      file_booking_proto_msgTypes,
+	}.Build()
+	File_booking_proto = out.File
+	file_booking_proto_goTypes = nil
+	file_booking_proto_depIdxs = nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Branch is one of the salon's locations. Each branch has its own timezone, opening hours and SMS sender,
+// and every booking is at one of them.
+type Branch struct {
+	// Name identifies the branch to customers, and is stored with its bookings.
+	// It may only be empty if it's the only branch.
+	Name string
+	// Timezone is where the branch is, so that we know what time customers mean.
+	Timezone      *time.Location
+	BusinessHours BusinessHours
+	// Originator is the sender shown on the branch's reminders.
+	Originator string
+	// Address is the branch's address, as shown in calendar events. It's optional.
+	Address string
+	// MaxBookingsPerDay is how many appointments the branch takes on a single day, however many slots are free,
+	// so that its staff aren't overloaded. If 0, there's no cap.
+	MaxBookingsPerDay int
+	// Chairs is how many appointments the branch takes at the same time, with or without stylists. An appointment
+	// takes its chair for every slot it spans, and for cfg.AppointmentBuffer after it. If 0, there's no limit.
+	Chairs int
+}
+
+// validateBranches checks that there's at least one branch, and that each has a unique name (unless it's the only one),
+// a timezone, valid opening hours and a valid originator.
+func validateBranches(branches []Branch) error {
+	if len(branches) == 0 {
+		return errors.New("configure at least one branch")
+	}
+	names := make(map[string]bool)
+	for _, branch := range branches {
+		switch {
+		case branch.Name == "" && len(branches) > 1:
+			return errors.New("every branch needs a name if there's more than one")
+		case names[branch.Name]:
+			return fmt.Errorf("more than one branch is called %q", branch.Name)
+		case branch.Timezone == nil:
+			return fmt.Errorf("branch %q needs a timezone", branch.Name)
+		case !validOriginator(branch.Originator):
+			return fmt.Errorf("invalid originator %q for branch %q: use a phone number, or at most 11 letters and digits", branch.Originator, branch.Name)
+		}
+		if err := branch.BusinessHours.Validate(); err != nil {
+			return fmt.Errorf("branch %q: %v", branch.Name, err)
+		}
+		names[branch.Name] = true
+	}
+	return nil
+}
+
+// findBranch returns the branch in cfg.Branches called name, and false if there's no such branch.
+// An empty name means the first branch, so that customers of a salon with a single branch don't have to choose it.
+func findBranch(name string) (Branch, bool) {
+	if name == "" {
+		return cfg.Branches[0], true
+	}
+	for _, branch := range cfg.Branches {
+		if branch.Name == name {
+			return branch, true
+		}
+	}
+	return Branch{}, false
+}
+
+// branchFor returns the branch of b. Bookings at a branch we've since closed, or made before we had branches,
+// belong to the first branch.
+func branchFor(b booking) Branch {
+	if branch, ok := findBranch(b.Branch); ok {
+		return branch
+	}
+	return cfg.Branches[0]
+}
+
+// localTime returns the time of b in the timezone of its branch.
+func localTime(b booking) time.Time {
+	return b.BookingTime.In(branchFor(b).Timezone)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/messagebird/go-rest-api/balance"
+	"github.com/messagebird/go-rest-api/conversation"
+	"github.com/messagebird/go-rest-api/lookup"
+	"github.com/messagebird/go-rest-api/sms"
+	"github.com/messagebird/go-rest-api/voicemessage"
+)
+
+// SMSUsage counts the SMS segments we ask MessageBird to send or schedule, by day, like "2018-08-01".
+type SMSUsage interface {
+	// Add counts segments more segments on day.
+	Add(day string, segments int) error
+	// Used returns how many segments were counted on day.
+	Used(day string) (int, error)
+}
+
+// memorySMSUsage is an SMSUsage that keeps its counts in memory. They're lost when the application stops.
+type memorySMSUsage struct {
+	mu   sync.Mutex
+	days map[string]int
+}
+
+func newMemorySMSUsage() *memorySMSUsage {
+	return &memorySMSUsage{days: make(map[string]int)}
+}
+
+func (u *memorySMSUsage) Add(day string, segments int) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	// Only today's count matters, so forget the days before it.
+	for d := range u.days {
+		if d < day {
+			delete(u.days, d)
+		}
+	}
+	u.days[day] += segments
+	return nil
+}
+
+func (u *memorySMSUsage) Used(day string) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.days[day], nil
+}
+
+// smsDay returns the day t falls on in our timezone, as counted in SMSUsage. Days start at local midnight.
+func smsDay(t time.Time) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// smsBudget stops bookings once we've sent limit SMS segments in a day, so that abuse or a bug can't run up the bill.
+type smsBudget struct {
+	usage SMSUsage
+	limit int
+
+	mu sync.Mutex
+	// alerted is the last day we told operators the budget was exhausted, so that we tell them once a day.
+	alerted string
+}
+
+func newSMSBudget(usage SMSUsage, limit int) *smsBudget {
+	return &smsBudget{usage: usage, limit: limit}
+}
+
+// used returns how many segments we've sent on the day of now.
+func (b *smsBudget) used(now time.Time) (int, error) {
+	return b.usage.Used(smsDay(now))
+}
+
+// exhausted reports whether we've sent the day's limit by now. The first time it has each day, it logs an error,
+// for operators to alert on. If we can't tell, it isn't: the budget shouldn't stop everyone from booking.
+func (b *smsBudget) exhausted(now time.Time) bool {
+	day := smsDay(now)
+	used, err := b.usage.Used(day)
+	if err != nil {
+		slog.Error("Couldn't check SMS budget", "err", err)
+		return false
+	}
+	if used < b.limit {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.alerted != day {
+		slog.Error("SMS budget exhausted; no more bookings until tomorrow", "day", day, "used", used, "limit", b.limit)
+		b.alerted = day
+	}
+	return true
+}
+
+// budgetedClient is a messagingClient that counts the segments of every SMS it sends or schedules with client in
+// usage, on the day we ask MessageBird for it.
+type budgetedClient struct {
+	client messagingClient
+	usage  SMSUsage
+	now    func() time.Time
+}
+
+func (c budgetedClient) Lookup(ctx context.Context, phone string, params *lookup.Params) (*lookup.Lookup, error) {
+	return c.client.Lookup(ctx, phone, params)
+}
+
+func (c budgetedClient) CreateSMS(ctx context.Context, originator string, recipients []string, body string, params *sms.Params) (*sms.Message, error) {
+	msg, err := c.client.CreateSMS(ctx, originator, recipients, body, params)
+	if err == nil {
+		if err := c.usage.Add(smsDay(c.now()), smsSegments(body)*len(recipients)); err != nil {
+			slog.Error("Couldn't count SMS towards budget", "message_id", msg.ID, "err", err)
+		}
+	}
+	return msg, err
+}
+
+func (c budgetedClient) ReadSMS(ctx context.Context, id string) (*sms.Message, error) {
+	return c.client.ReadSMS(ctx, id)
+}
+
+func (c budgetedClient) DeleteSMS(ctx context.Context, id string) (*sms.Message, error) {
+	return c.client.DeleteSMS(ctx, id)
+}
+
+func (c budgetedClient) StartConversation(ctx context.Context, req *conversation.StartRequest) (*conversation.Conversation, error) {
+	return c.client.StartConversation(ctx, req)
+}
+
+func (c budgetedClient) CreateVoiceMessage(ctx context.Context, recipients []string, body string, params *voicemessage.Params) (*voicemessage.VoiceMessage, error) {
+	return c.client.CreateVoiceMessage(ctx, recipients, body, params)
+}
+
+func (c budgetedClient) Balance(ctx context.Context) (*balance.Balance, error) {
+	return c.client.Balance(ctx)
+}
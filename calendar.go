@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// icsTimeFormat is the iCalendar format for a time in UTC.
+const icsTimeFormat = "20060102T150405Z"
+
+// bookingCalendar serves /bookings/{id}/calendar.ics: an iCalendar file with the booking as an event,
+// so that customers can add their appointment to their calendar.
+func (a *app) bookingCalendar(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/bookings/")
+	if !strings.HasSuffix(id, "/calendar.ics") {
+		http.NotFound(w, r)
+		return
+	}
+	id = strings.TrimSuffix(id, "/calendar.ics")
+
+	thisBooking, err := findBooking(a.store, id)
+	if err != nil {
+		if err != errBookingNotFound {
+			slog.Error("Couldn't get booking", "booking_id", id, "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	// The alarm goes off when the reminder does. The booking's lead was checked when it was made; if the treatment
+	// has gone since, it's the default's.
+	treatment, _ := findTreatment(thisBooking.Treatment)
+	reminderDiff, err := reminderDiffFor(thisBooking.ReminderLead, treatment, defaultLocale)
+	if err != nil {
+		reminderDiff = defaultReminderDiff
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="beautybird.ics"`)
+	w.Write(bookingEvent(thisBooking, reminderDiff, a.now()))
+}
+
+// bookingEvent returns an RFC 5545 iCalendar file with a single event for b, with an alarm reminderDiff before it starts.
+// now is used as the time the event was created. All times are in UTC, so that we don't have to describe our timezone.
+func bookingEvent(b booking, reminderDiff time.Duration, now time.Time) []byte {
+	var ics bytes.Buffer
+	line := func(name, value string) {
+		icsLine(&ics, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//BeautyBird//Reminders//EN")
+	line("BEGIN", "VEVENT")
+	line("UID", b.ID+"@beautybird")
+	line("DTSTAMP", now.UTC().Format(icsTimeFormat))
+	line("DTSTART", b.BookingTime.UTC().Format(icsTimeFormat))
+	if treatment, ok := findTreatment(b.Treatment); ok {
+		line("DTEND", b.BookingTime.Add(treatment.Duration).UTC().Format(icsTimeFormat))
+	}
+	line("SUMMARY", icsText(b.Treatment+" at "+cfg.SalonName))
+	if address := branchFor(b).Address; address != "" {
+		line("LOCATION", icsText(address))
+	}
+	if b.Cancelled {
+		line("STATUS", "CANCELLED")
+	} else {
+		line("STATUS", "CONFIRMED")
+	}
+	line("BEGIN", "VALARM")
+	line("ACTION", "DISPLAY")
+	line("DESCRIPTION", icsText("Your "+b.Treatment+" appointment at "+cfg.SalonName))
+	line("TRIGGER", icsDuration(-reminderDiff))
+	line("END", "VALARM")
+	line("END", "VEVENT")
+	line("END", "VCALENDAR")
+	return ics.Bytes()
+}
+
+// icsLine writes a content line to ics, ending in CRLF and folded so that no line is longer than 75 octets.
+func icsLine(ics *bytes.Buffer, contentLine string) {
+	limit := 75
+	for len(contentLine) > limit {
+		// Don't fold in the middle of a UTF-8 sequence.
+		cut := limit
+		for contentLine[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		ics.WriteString(contentLine[:cut] + "\r\n ")
+		contentLine = contentLine[cut:]
+		// Continuation lines start with a space, which counts towards their length.
+		limit = 74
+	}
+	ics.WriteString(contentLine + "\r\n")
+}
+
+// icsText escapes s for use as an iCalendar TEXT value.
+var icsText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "").Replace
+
+// icsDuration formats d as an iCalendar DURATION value, like -PT3H, -PT1H30M or -P1D. Whole days are written as days,
+// which calendars count like reminderTimeFor does: the same time the day before, even across a daylight saving change.
+func icsDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	days := int(d / (24 * time.Hour))
+	d %= 24 * time.Hour
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	var clock string
+	switch {
+	case hours == 0 && minutes == 0:
+		if days == 0 {
+			return sign + "PT0M"
+		}
+	case minutes == 0:
+		clock = fmt.Sprintf("T%dH", hours)
+	case hours == 0:
+		clock = fmt.Sprintf("T%dM", minutes)
+	default:
+		clock = fmt.Sprintf("T%dH%dM", hours, minutes)
+	}
+	if days > 0 {
+		return fmt.Sprintf("%sP%dD%s", sign, days, clock)
+	}
+	return sign + "P" + clock
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidCancelToken = errors.New("invalid or expired cancellation link")
+
+// signCancelToken returns a token that lets whoever has it cancel the booking with the given id until expires:
+// the id, the expiry as a Unix time, and an HMAC-SHA256 of both, signed with key, separated by dots.
+func signCancelToken(key []byte, id string, expires time.Time) string {
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + cancelSignature(key, payload)
+}
+
+// verifyCancelToken returns the booking id in token, if it was signed with key and hasn't expired by now.
+// Otherwise, it returns errInvalidCancelToken.
+func verifyCancelToken(key []byte, token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", errInvalidCancelToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(cancelSignature(key, payload))) {
+		return "", errInvalidCancelToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || !now.Before(time.Unix(expires, 0)) {
+		return "", errInvalidCancelToken
+	}
+	return parts[0], nil
+}
+
+func cancelSignature(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cancelLink returns the path of the page that cancels b. If cancellation links are signed, it carries a token that
+// expires when the appointment starts; otherwise, it's the booking's id, like customers would type it in.
+func cancelLink(b booking) string {
+	if len(cfg.CancelSecret) == 0 || b.BookingTime == nil {
+		return "/cancel?id=" + url.QueryEscape(b.ID)
+	}
+	return "/cancel?token=" + signCancelToken(cfg.CancelSecret, b.ID, *b.BookingTime)
+}
+
+// cancelURL returns the full URL of cancelLink(b), for messages. It's empty unless cancellation links are signed and
+// we know where we're hosted, so that messages never carry a link that works for anyone who knows the booking's id.
+// It's empty for voice reminders too: a link is no use read out on a call.
+func cancelURL(b booking) string {
+	if len(cfg.CancelSecret) == 0 || cfg.PublicURL == "" || b.ID == "" || b.Channel == channelVoice {
+		return ""
+	}
+	return cfg.PublicURL + cancelLink(b)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// scheduleCommand books a single appointment from the command line, like `reminders schedule --name Jane
+// --treatment Haircut --phone +31612345678 --time "2018-08-01 14:30" --consent`, for scripts and cron jobs.
+// It goes through makeBooking like any other booking, and prints the message id of each of its reminders to stdout,
+// one per line. What went wrong goes to stderr. It returns the exit code: 0 if the appointment was booked, 1 if it
+// wasn't, and 2 if args aren't right.
+//
+// Only SMS reminders can be booked this way: reminders on the other channels, and by email, are sent by the process
+// that booked them, and this one exits right away.
+func (a *app) scheduleCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("schedule", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	name := flags.String("name", "", "the customer's `name`")
+	treatment := flags.String("treatment", "", "the `treatment` to book, like Haircut")
+	phone := flags.String("phone", "", "the customer's phone `number`")
+	contactPhone := flags.String("contact-phone", "", "the phone `number` to send reminders to, if not the customer's own")
+	phones := flags.String("phones", "", "more phone `numbers` to send reminders to, comma separated, for a group")
+	at := flags.String("time", "", `the appointment's date and time, like "2018-08-01 14:30" in the branch's timezone and the booking form's formats, or 2018-08-01T14:30:00+02:00`)
+	staff := flags.String("staff", "", "the `stylist` to book")
+	branchName := flags.String("branch", "", "the `branch` to book at")
+	notes := flags.String("notes", "", "`notes` for the salon")
+	country := flags.String("country", "", "the country `code` of a national phone number, like NL")
+	reminderLead := flags.String("reminder-lead", "", "how long before the appointment to send the reminder, like 3h")
+	language := flags.String("language", defaultLocale, "the `language` of the reminders, like nl")
+	consent := flags.Bool("consent", false, "confirm that the customer agreed to get reminders")
+	dryRun := flags.Bool("dry-run", false, "check the booking, but don't book it or send anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "schedule: unexpected argument %q\n", flags.Arg(0))
+		return 2
+	}
+	if !*consent {
+		fmt.Fprintln(stderr, "schedule: pass --consent to confirm that the customer agreed to get reminders")
+		return 2
+	}
+	if _, ok := a.store.(*memoryStore); ok && cfg.LocalDispatch {
+		// The reminder would be queued in a store that's gone once we exit, so it would never be sent.
+		fmt.Fprintln(stderr, "schedule: LOCAL_DISPATCH needs DB_PATH or REDIS_URL, so that the server can send the reminder")
+		return 2
+	}
+
+	b := booking{
+		Name:         *name,
+		Treatment:    *treatment,
+		Phone:        *phone,
+		ContactPhone: *contactPhone,
+		Phones:       parsePhones(*phones),
+		Staff:        *staff,
+		Branch:       *branchName,
+		Notes:        *notes,
+		Country:      *country,
+		Channel:      channelSMS,
+		ReminderLead: *reminderLead,
+		Language:     *language,
+		Consent:      true,
+		DryRun:       *dryRun,
+	}
+	branch, ok := findBranch(b.Branch)
+	if !ok {
+		fmt.Fprintf(stderr, "branch: %s\n", translate(defaultLocale, "invalid_branch"))
+		return 1
+	}
+	bookingTime, err := parseImportTime(strings.TrimSpace(*at), branch.Timezone)
+	if err != nil {
+		fmt.Fprintf(stderr, "time: please enter the date and time like %s\n", importTimeExample())
+		return 1
+	}
+	b.BookingTime = &bookingTime
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.APITimeout)
+	defer cancel()
+	b, _, berr := a.makeBooking(ctx, b, defaultLocale)
+	if berr != nil {
+		if errs := berr.fieldErrors(); len(errs) > 0 {
+			for _, e := range errs {
+				fmt.Fprintf(stderr, "%s: %s\n", scheduleFlag(e.Field), e.Message)
+			}
+		} else {
+			fmt.Fprintln(stderr, berr.Message)
+		}
+		return 1
+	}
+	if b.DryRun {
+		fmt.Fprintln(stderr, "Dry run: the booking checks out, but nothing was booked or sent.")
+		return 0
+	}
+	for _, phone := range b.RejectedPhones {
+		fmt.Fprintf(stderr, "phones: %s won't get reminders: it didn't check out\n", phone)
+	}
+	for _, id := range b.MessageIDs {
+		fmt.Fprintln(stdout, id)
+	}
+	return 0
+}
+
+// scheduleFlag returns the name of scheduleCommand's flag for the booking form's field, like "reminder-lead" for
+// "reminder_lead".
+func scheduleFlag(field string) string {
+	// The form has a date and a time, but the command takes both in --time.
+	if field == "date" {
+		return "time"
+	}
+	return strings.ReplaceAll(field, "_", "-")
+}
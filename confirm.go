@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// confirmationWindow is how long customers have to confirm a booking after we've checked it.
+// After that, the slot may well be gone, so we'd rather check it again.
+const confirmationWindow = 30 * time.Minute
+
+// confirmation is what the booking form's confirmation step carries from the check to the actual booking:
+// the booking as we checked it, with the phone numbers and country we looked up and the name we may have shortened.
+// LookedUp says the numbers are MessageBird's, so that the booking doesn't pay for the same lookups again.
+type confirmation struct {
+	Booking     booking   `json:"booking"`
+	Recurrence  string    `json:"recurrence,omitempty"`
+	Occurrences int       `json:"occurrences,omitempty"`
+	LookedUp    bool      `json:"looked_up,omitempty"`
+	Expires     time.Time `json:"expires"`
+}
+
+// confirmPage is the data for views/confirm.gohtml.
+type confirmPage struct {
+	Booking booking
+	// Time and ReminderTimes are the booking's time and its reminder times, formatted for the customer.
+	Time          string
+	ReminderTimes []string
+	Recurrence    string
+	Occurrences   int
+	// Message notes anything about the booking the customer should know before they confirm it.
+	Message string
+	// Token is the signed confirmation, which the confirm button posts back.
+	Token          string
+	IdempotencyKey string
+	Lang           string
+}
+
+var errInvalidConfirmation = errors.New("invalid or expired confirmation")
+
+// newConfirmationKey returns a random key to sign confirmations with. Confirmations don't survive a restart,
+// but they're only good for confirmationWindow anyway.
+func newConfirmationKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signConfirmation returns c as a token for the confirmation form: its JSON and an HMAC-SHA256 of it, signed with key,
+// both base64 encoded and separated by a dot. Customers can read it, but can't change it.
+func signConfirmation(key []byte, c confirmation) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyConfirmation returns the confirmation in token, if it was signed with key and hasn't expired by now.
+// Otherwise, it returns errInvalidConfirmation.
+func verifyConfirmation(key []byte, token string, now time.Time) (confirmation, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return confirmation{}, errInvalidConfirmation
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return confirmation{}, errInvalidConfirmation
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return confirmation{}, errInvalidConfirmation
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return confirmation{}, errInvalidConfirmation
+	}
+
+	var c confirmation
+	if err := json.Unmarshal(payload, &c); err != nil || c.Booking.BookingTime == nil || now.After(c.Expires) {
+		return confirmation{}, errInvalidConfirmation
+	}
+	return c, nil
+}
+
+// confirmBooking checks b with a dry run and, if it would go through, shows the customer what we're about to book,
+// with a button to confirm it. It's the first step of the booking form; enteredName is the name as the customer entered it.
+func (a *app) confirmBooking(ctx context.Context, w http.ResponseWriter, r *http.Request, b booking, recurrence string, occurrences int, enteredName, lang string) {
+	requestedChannel := b.Channel
+	b.DryRun = true
+	checked, reminderTimes, berr := a.makeBooking(ctx, b, lang)
+	if berr != nil {
+		a.metrics.booking(berr, false)
+		checked.DryRun = false
+		a.writeBookingError(w, r, checked, berr, lang)
+		return
+	}
+	// Book what the customer asked for: if WhatsApp is only unavailable for now, it may be back by the time they confirm.
+	checked.DryRun, checked.Channel = false, requestedChannel
+
+	token, err := signConfirmation(a.confirmationKey, confirmation{checked, recurrence, occurrences, checked.LookedUp, a.now().Add(confirmationWindow)})
+	if err != nil {
+		slog.Error("Couldn't sign confirmation", "err", err)
+		http.Error(w, "Sorry, something went wrong on our side. Please try again later.", http.StatusInternalServerError)
+		return
+	}
+	page := confirmPage{
+		Booking:        checked,
+		Time:           localTime(checked).Format(translate(lang, "date_format")),
+		Token:          token,
+		IdempotencyKey: r.FormValue("idempotency_key"),
+		Lang:           lang,
+	}
+	for _, reminderTime := range reminderTimes {
+		page.ReminderTimes = append(page.ReminderTimes, reminderTime.Format(translate(lang, "date_format")))
+	}
+	if occurrences > 1 {
+		page.Recurrence, page.Occurrences = recurrence, occurrences
+	}
+	if checked.Name != enteredName {
+		page.Message = strings.TrimSpace(translate(lang, "name_shortened", checked.Name))
+	}
+	if len(checked.RejectedPhones) > 0 {
+		page.Message = strings.TrimSpace(page.Message + translate(lang, "phones_rejected", strings.Join(checked.RejectedPhones, ", ")))
+	}
+	renderPage(w, http.StatusOK, "views/confirm.gohtml", page)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+// confirmationToken matches the signed confirmation in the confirmation page.
+var confirmationToken = regexp.MustCompile(`name="confirmation" value="([^"]+)"`)
+
+func TestConfirmedBookingIsntLookedUpAgain(t *testing.T) {
+	a, client := newTestApp(t)
+	var err error
+	if a.confirmationKey, err = newConfirmationKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := postForm(a.bbScheduler, "/", bookingForm("contact_phone", "+31687654321", "phones", "+31611111111"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	match := confirmationToken.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("no confirmation in %s", w.Body.String())
+	}
+	checked := len(client.Lookups)
+	if checked != 3 {
+		t.Fatalf("checking the booking took %d lookups, want 3", checked)
+	}
+
+	w = postForm(a.bbScheduler, "/", url.Values{"confirmation": {match[1]}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	// The numbers in the confirmation are the ones we looked up, so confirming doesn't pay for them again.
+	if len(client.Lookups) != checked {
+		t.Errorf("confirming the booking took %d more lookups, want none", len(client.Lookups)-checked)
+	}
+	bookings, err := a.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 || bookings[0].Phone != "+31612345678" || bookings[0].ContactPhone != "+31687654321" || bookings[0].Country != "NL" {
+		t.Fatalf("got bookings %+v, want one for +31612345678 in NL, reminding +31687654321", bookings)
+	}
+	if len(client.Messages) == 0 {
+		t.Error("no reminders are scheduled")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/messagebird/go-rest-api/sms"
+)
+
+// dispatchInterval is how often the dispatcher looks for SMS reminders that are due.
+const dispatchInterval = time.Minute
+
+// dispatchedReminderPrefix starts the id of every SMS reminder the dispatcher sends, rather than MessageBird.
+// It's followed by the Unix time the reminder is due, and a random part, like "local-sms-1533125400-0123456789abcdef".
+const dispatchedReminderPrefix = localReminderPrefix + channelSMS + "-"
+
+// dispatchedReminderID returns the id of a new SMS reminder, due at sendAt, for the dispatcher to send.
+func dispatchedReminderID(sendAt time.Time) (string, error) {
+	id, err := newBookingID()
+	if err != nil {
+		return "", err
+	}
+	return dispatchedReminderPrefix + strconv.FormatInt(sendAt.Unix(), 10) + "-" + id, nil
+}
+
+// dispatchedReminderTime returns when the reminder with the given id is due, if it's one for the dispatcher.
+func dispatchedReminderTime(id string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(id, dispatchedReminderPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	due, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(due, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// runDispatcher sends SMS reminders ourselves, for when MessageBird can't schedule them for us, until ctx is done.
+// Every dispatchInterval, it goes through the stored bookings and sends the reminders that are due. Because the
+// reminders are kept with their bookings, the first round also sends any that came due while we weren't running.
+func (a *app) runDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+	for {
+		a.dispatchDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchDue sends every SMS reminder for the dispatcher that's due and still pending.
+func (a *app) dispatchDue(ctx context.Context) {
+	bookings, err := a.store.List()
+	if err != nil {
+		slog.Error("Couldn't get bookings to send reminders for", "err", err)
+		return
+	}
+	now := a.now()
+	for _, b := range bookings {
+		if b.Cancelled {
+			continue
+		}
+		for _, messageID := range b.MessageIDs {
+			sendAt, ok := dispatchedReminderTime(messageID)
+			if !ok || sendAt.After(now) || b.ReminderStatuses[messageID] != reminderPending {
+				continue
+			}
+			a.dispatch(ctx, b.ID, messageID)
+		}
+	}
+}
+
+// dispatch sends the SMS reminder with messageID for the booking with bookingID. Once MessageBird has it, the reminder
+// takes MessageBird's message id, like a reminder MessageBird scheduled, so that status reports find it.
+// If we can't send it, or it's too late to, its status is reminderFailed, and we don't try again.
+func (a *app) dispatch(ctx context.Context, bookingID, messageID string) {
+	// The booking may have been cancelled or moved since we listed it.
+	b, err := a.store.Get(bookingID)
+	if err != nil {
+		slog.Error("Couldn't get booking to send reminder for", "booking_id", bookingID, "err", err)
+		return
+	}
+	i := -1
+	for j, id := range b.MessageIDs {
+		if id == messageID {
+			i = j
+		}
+	}
+	if b.Cancelled || i < 0 || b.ReminderStatuses[messageID] != reminderPending {
+		return
+	}
+
+	if msg := a.sendDispatched(ctx, b); msg == nil {
+		b.ReminderStatuses[messageID] = reminderFailed
+	} else {
+		slog.Info("Sent SMS reminder", "booking_id", b.ID, "message_id", msg.ID, "phone", maskPhone(b.ContactPhone), "booking_time", *b.BookingTime)
+		b.MessageIDs[i] = msg.ID
+		delete(b.ReminderStatuses, messageID)
+		b.ReminderStatuses[msg.ID] = reminderPending
+	}
+	if err := a.store.Update(b); err != nil {
+		slog.Error("Couldn't save reminder status", "booking_id", b.ID, "message_id", messageID, "err", err)
+	}
+}
+
+// sendDispatched sends b's reminder by SMS now, and returns the message, or nil if it didn't go out.
+func (a *app) sendDispatched(ctx context.Context, b booking) *sms.Message {
+	if !b.BookingTime.After(a.now()) {
+		// We were down until after the appointment, so there's nothing left to remind anyone of.
+		slog.Warn("Didn't send SMS reminder: the appointment has started", "booking_id", b.ID, "booking_time", *b.BookingTime)
+		return nil
+	}
+	// Whoever in a group opted out since they booked is left out; without anyone left, there's nothing to send.
+	var recipients []string
+	for _, phone := range reminderRecipients(b) {
+		if a.optedOut(phone) {
+			slog.Info("Didn't send SMS reminder: opted out", "booking_id", b.ID, "phone", maskPhone(phone))
+			continue
+		}
+		recipients = append(recipients, phone)
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+	text, err := reminderText(b)
+	if err != nil {
+		slog.Error("Couldn't render reminder", "booking_id", b.ID, "err", err)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.APITimeout)
+	defer cancel()
+	var msg *sms.Message
+	err = retry(ctx, "create SMS", func() (err error) {
+		msg, err = a.client.CreateSMS(ctx, branchFor(b).Originator, recipients, text, nil)
+		return err
+	})
+	if err != nil {
+		slog.Error("Couldn't send SMS reminder", "booking_id", b.ID, "phone", maskPhone(b.ContactPhone), "err", maskPhones(err.Error()))
+		return nil
+	}
+	return msg
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log/slog"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// mailer sends email reminders.
+type mailer interface {
+	SendMail(to, subject, body string) error
+}
+
+// smtpMailer is a mailer that sends email through an SMTP server.
+type smtpMailer struct {
+	// addr is the host:port of the SMTP server.
+	addr string
+	// from is the address emails are sent from.
+	from string
+	// auth logs in to the SMTP server. If nil, we don't log in.
+	auth smtp.Auth
+}
+
+func (m smtpMailer) SendMail(to, subject, body string) error {
+	from := mail.Address{Name: cfg.SalonName, Address: m.from}
+	msg := "From: " + from.String() + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg))
+}
+
+// parseEmail checks that email is a single, valid email address, and returns just the address part of it.
+func parseEmail(email string) (string, bool) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return "", false
+	}
+	return addr.Address, true
+}
+
+// scheduleEmail schedules an email reminder with body, in the locale lang, to be sent to to at sendAt, and returns
+// the reminder's id.
+func (a *app) scheduleEmail(to, body, lang string, sendAt time.Time) (string, error) {
+	return a.timers.schedule("email", sendAt.Sub(a.now()), func() {
+		if err := a.mailer.SendMail(to, translate(lang, "email_subject", cfg.SalonName), body); err != nil {
+			slog.Error("Couldn't send email reminder", "err", err)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/messagebird/go-rest-api"
+	"github.com/messagebird/go-rest-api/balance"
+	"github.com/messagebird/go-rest-api/conversation"
+	"github.com/messagebird/go-rest-api/lookup"
+	"github.com/messagebird/go-rest-api/sms"
+	"github.com/messagebird/go-rest-api/voicemessage"
+)
+
+// fakeClient is a messagingClient that never calls MessageBird. It records every call,
+// so that tests can check what would have been sent, and returns canned results:
+// every phone number is valid unless it's listed in InvalidPhones, and every SMS is
+// accepted unless CreateErr is set. It answers right away, so it ignores its contexts.
+// It's also used to run the application offline.
+type fakeClient struct {
+	// InvalidPhones are phone numbers that Lookup rejects.
+	InvalidPhones map[string]bool
+	// PhoneTypes are the types Lookup reports for phone numbers, like "fixed line". Other numbers are "mobile".
+	PhoneTypes map[string]string
+	// CreateErr, if set, is returned by every CreateSMS call, once CreateErrAfter of them have gone through.
+	CreateErr error
+	// CreateErrAfter is how many SMS CreateSMS creates before it returns CreateErr, to fail part of the way.
+	CreateErrAfter int
+	// DeleteErr, if set, is returned by every DeleteSMS call, so that reminders can't be cancelled.
+	DeleteErr error
+	// LookupErr, if set, is returned by every Lookup call, like when MessageBird's lookup API is down.
+	LookupErr error
+	// AccountBalance, if set, is what Balance returns. Otherwise, it's 100 prepaid credits.
+	AccountBalance *balance.Balance
+
+	mu            sync.Mutex
+	created       int // SMS messages created so far, deleted or not, so that ids aren't reused
+	Lookups       []string
+	Messages      []*sms.Message
+	Deleted       []string
+	BalanceReads  int
+	Conversations []*conversation.StartRequest
+	VoiceMessages []*voicemessage.VoiceMessage
+}
+
+func (c *fakeClient) StartConversation(ctx context.Context, req *conversation.StartRequest) (*conversation.Conversation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.InvalidPhones[req.To] {
+		return nil, errFakeInvalidPhone
+	}
+	slog.Info("Fake conversation", "channel_id", req.ChannelID, "phone", maskPhone(req.To), "text", req.Content.Text)
+	c.Conversations = append(c.Conversations, req)
+	return &conversation.Conversation{ID: "fake-conversation-" + strconv.Itoa(len(c.Conversations))}, nil
+}
+
+func (c *fakeClient) CreateVoiceMessage(ctx context.Context, recipients []string, body string, params *voicemessage.Params) (*voicemessage.VoiceMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, recipient := range recipients {
+		if c.InvalidPhones[recipient] {
+			return nil, errFakeInvalidPhone
+		}
+	}
+	msg := &voicemessage.VoiceMessage{ID: "fake-voice-" + strconv.Itoa(len(c.VoiceMessages)+1), Originator: params.Originator, Body: body}
+	slog.Info("Fake voice message", "message_id", msg.ID, "originator", params.Originator, "recipients", len(recipients), "body", body)
+	c.VoiceMessages = append(c.VoiceMessages, msg)
+	return msg, nil
+}
+
+// Errors returned by fakeClient.
+var (
+	// errFakeInvalidPhone looks like MessageBird's answer to a number that can't exist, so that lookupFailed doesn't
+	// take it for MessageBird being down.
+	errFakeInvalidPhone = messagebird.ErrorResponse{Errors: []messagebird.Error{{Code: mbErrBadRequest, Description: "fake: invalid phone number"}}}
+	// errFakeNotFound looks like MessageBird's own answer, so that fakeClient can stand in for it in isNotFound.
+	errFakeNotFound = messagebird.ErrorResponse{Errors: []messagebird.Error{{Code: mbErrNotFound, Description: "fake: message not found"}}}
+)
+
+func (c *fakeClient) Lookup(ctx context.Context, phone string, params *lookup.Params) (*lookup.Lookup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	slog.Info("Fake lookup", "phone", maskPhone(phone))
+	c.Lookups = append(c.Lookups, phone)
+	if c.LookupErr != nil {
+		return nil, c.LookupErr
+	}
+	if c.InvalidPhones[phone] {
+		return nil, errFakeInvalidPhone
+	}
+	number := &lookup.Lookup{CountryCode: params.CountryCode, Type: "mobile"}
+	if t, ok := c.PhoneTypes[phone]; ok {
+		number.Type = t
+	}
+	// Without a numbering plan we can only normalize numbers that are already in international format.
+	if digits := digitsOnly(phone); strings.HasPrefix(phone, "+") {
+		number.Formats.E164 = "+" + digits
+	} else if strings.HasPrefix(digits, "00") {
+		number.Formats.E164 = "+" + digits[2:]
+	}
+	return number, nil
+}
+
+func (c *fakeClient) CreateSMS(ctx context.Context, originator string, recipients []string, body string, params *sms.Params) (*sms.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.CreateErr != nil && c.created >= c.CreateErrAfter {
+		return nil, c.CreateErr
+	}
+
+	now := time.Now()
+	c.created++
+	msg := &sms.Message{
+		ID:              "fake-" + strconv.Itoa(c.created),
+		Originator:      originator,
+		Body:            body,
+		CreatedDatetime: &now,
+	}
+	status := "sent"
+	if params != nil && !params.ScheduledDatetime.IsZero() {
+		scheduled := params.ScheduledDatetime
+		msg.ScheduledDatetime = &scheduled
+		status = "scheduled"
+	}
+	for _, recipient := range recipients {
+		// Like MessageBird, report recipients as numbers in international format.
+		number, _ := strconv.ParseInt(digitsOnly(recipient), 10, 64)
+		msg.Recipients.Items = append(msg.Recipients.Items, messagebird.Recipient{Recipient: number, Status: status})
+	}
+	msg.Recipients.TotalCount = len(recipients)
+
+	slog.Info("Fake SMS", "message_id", msg.ID, "originator", originator, "recipients", len(recipients), "body", body, "send_at", msg.ScheduledDatetime)
+	c.Messages = append(c.Messages, msg)
+	return msg, nil
+}
+
+func (c *fakeClient) ReadSMS(ctx context.Context, id string) (*sms.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range c.Messages {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (c *fakeClient) DeleteSMS(ctx context.Context, id string) (*sms.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.DeleteErr != nil {
+		return nil, c.DeleteErr
+	}
+	for i, msg := range c.Messages {
+		if msg.ID == id {
+			slog.Info("Fake SMS deleted", "message_id", id)
+			c.Deleted = append(c.Deleted, id)
+			c.Messages = append(c.Messages[:i], c.Messages[i+1:]...)
+			return msg, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (c *fakeClient) Balance(ctx context.Context) (*balance.Balance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.BalanceReads++
+	if c.AccountBalance != nil {
+		return c.AccountBalance, nil
+	}
+	return &balance.Balance{Payment: "prepaid", Type: "credits", Amount: 100}, nil
+}
@@ -0,0 +1,21 @@
+module github.com/messagebirdguides/reminders-guide-go
+
+go 1.25.0
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.52
+	github.com/messagebird/go-rest-api v5.3.0+incompatible
+	github.com/redis/go-redis/v9 v9.22.0
+	golang.org/x/crypto v0.54.0
+	google.golang.org/grpc v1.84.0
+	google.golang.org/protobuf v1.36.11
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
+)
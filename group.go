@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/messagebird/go-rest-api/sms"
+)
+
+// maxGroupPhones is how many numbers a group booking can send reminders to on top of its contact number.
+// Each of them costs a lookup and an SMS per reminder.
+const maxGroupPhones = 9
+
+// parsePhones parses a comma separated list of phone numbers, like "+31612345678, +31687654321".
+func parsePhones(list string) []string {
+	var phones []string
+	for _, phone := range strings.Split(list, ",") {
+		if phone = strings.TrimSpace(phone); phone != "" {
+			phones = append(phones, phone)
+		}
+	}
+	return phones
+}
+
+// reminderRecipients returns the numbers b's SMS reminders go to: its contact number, and the rest of its group.
+func reminderRecipients(b booking) []string {
+	return append([]string{b.ContactPhone}, b.Phones...)
+}
+
+// checkGroupPhones looks up each of b's group numbers with lookupPhone, in country unless they start with a country
+// code. The ones that check out stay in b.Phones, as MessageBird gave them to us. The others, and the ones that are
+// already on the booking, are left out and listed in b.RejectedPhones, so that a single typo doesn't stop the whole
+// group from booking. A lookup that doesn't get an answer stops it, though.
+func (a *app) checkGroupPhones(ctx context.Context, b *booking, country, lang string) *bookingError {
+	phones := b.Phones
+	b.Phones, b.RejectedPhones = nil, nil
+	for _, phone := range phones {
+		number, _, berr := a.lookupPhone(ctx, phone, country, phoneTypesFor(channelSMS), "phones", lang)
+		if berr != nil && berr.Field == "" {
+			return berr
+		}
+		if berr != nil || samePhone(number, b.ContactPhone) || containsPhone(b.Phones, number) {
+			b.RejectedPhones = append(b.RejectedPhones, phone)
+			continue
+		}
+		b.Phones = append(b.Phones, number)
+	}
+	return nil
+}
+
+// leaveOut moves the numbers in b's group that out reports on from b.Phones to b.RejectedPhones.
+func leaveOut(b *booking, out func(phone string) bool) {
+	var phones []string
+	for _, phone := range b.Phones {
+		if out(phone) {
+			b.RejectedPhones = append(b.RejectedPhones, phone)
+		} else {
+			phones = append(phones, phone)
+		}
+	}
+	b.Phones = phones
+}
+
+// containsPhone reports whether phones has phone in it, as compared by samePhone.
+func containsPhone(phones []string, phone string) bool {
+	for _, p := range phones {
+		if samePhone(p, phone) {
+			return true
+		}
+	}
+	return false
+}
+
+// leaveGroup takes sender off b's group, now that they've opted out, and saves b. MessageBird can't take a single
+// recipient off a message it has scheduled, so each of b's scheduled SMS reminders is deleted and scheduled again
+// for the rest of the group.
+func (a *app) leaveGroup(ctx context.Context, b booking, sender string) error {
+	var phones []string
+	for _, phone := range b.Phones {
+		if !samePhone(phone, sender) {
+			phones = append(phones, phone)
+		}
+	}
+	b.Phones = phones
+	for i, messageID := range b.MessageIDs {
+		// The dispatcher sends its reminders to whoever is in the group when they're due, and our other local
+		// reminders only go to the contact number.
+		if isLocalReminder(messageID) {
+			continue
+		}
+		msg, err := a.client.ReadSMS(ctx, messageID)
+		if err != nil {
+			return err
+		}
+		if !isScheduled(msg) || msg.ScheduledDatetime == nil {
+			continue
+		}
+		if _, err := a.client.DeleteSMS(ctx, messageID); err != nil {
+			return err
+		}
+		var again *sms.Message
+		err = retry(ctx, "create SMS", func() (err error) {
+			again, err = a.client.CreateSMS(ctx, branchFor(b).Originator, reminderRecipients(b), msg.Body, &sms.Params{ScheduledDatetime: *msg.ScheduledDatetime})
+			return err
+		})
+		if err != nil {
+			// The reminder is gone, so save what we've done so far before giving up.
+			b.ReminderStatuses[messageID] = reminderFailed
+			if uerr := a.store.Update(b); uerr != nil {
+				slog.Error("Couldn't save booking", "booking_id", b.ID, "err", uerr)
+			}
+			return err
+		}
+		slog.Info("Scheduled SMS reminder again without opted out number", "booking_id", b.ID, "message_id", again.ID, "phone", maskPhone(sender))
+		b.MessageIDs[i] = again.ID
+		delete(b.ReminderStatuses, messageID)
+		b.ReminderStatuses[again.ID] = reminderPending
+	}
+	return a.store.Update(b)
+}
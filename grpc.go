@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate buf generate
+
+// Metadata keys of the gRPC service. Requests can send accept-language and idempotency-key, like the JSON API's
+// headers. A failed CreateBooking has the bookingError's code and field, and the time we'd book instead, if any,
+// in its trailers, next to its status.
+const (
+	grpcLanguageKey      = "accept-language"
+	grpcIdempotencyKey   = "idempotency-key"
+	grpcErrorCodeKey     = "error-code"
+	grpcErrorFieldKey    = "error-field"
+	grpcSuggestedTimeKey = "suggested-time"
+)
+
+// newGRPCServer returns a gRPC server with the Bookings service of booking.proto, for our own services to book with.
+// It goes through createBooking, just like the JSON API, so the two can't drift apart.
+func newGRPCServer(a *app) *grpc.Server {
+	srv := grpc.NewServer(grpc.UnaryInterceptor(logRPCs))
+	RegisterBookingsServer(srv, bookingsService{a: a})
+	return srv
+}
+
+// bookingsService is the app's BookingsServer. Its messages are generated from booking.proto, into booking.pb.go and
+// booking_grpc.pb.go: run go generate after changing it.
+type bookingsService struct {
+	UnimplementedBookingsServer
+	a *app
+}
+
+// CreateBooking makes a booking, with the same validation and scheduling as the JSON API. A booking that fails
+// returns a status with the code that goes with what went wrong (see grpcCode), and the error message in the
+// request's language.
+func (s bookingsService) CreateBooking(ctx context.Context, in *CreateBookingRequest) (*CreateBookingResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var lang, key string
+	if values := md.Get(grpcLanguageKey); len(values) > 0 {
+		lang = headerLocale(values[0])
+	} else {
+		lang = defaultLocale
+	}
+	if values := md.Get(grpcIdempotencyKey); len(values) > 0 {
+		key = hashIdempotencyKey(Bookings_CreateBooking_FullMethodName, values[0])
+	}
+
+	code, response := s.a.createBooking(ctx, requestedBooking(in), key, lang)
+	if code != http.StatusCreated {
+		trailer := metadata.Pairs(grpcErrorCodeKey, string(response.Code))
+		if response.Field != "" {
+			trailer.Set(grpcErrorFieldKey, response.Field)
+		}
+		if response.SuggestedTime != nil {
+			trailer.Set(grpcSuggestedTimeKey, response.SuggestedTime.Format(time.RFC3339))
+		}
+		if err := grpc.SetTrailer(ctx, trailer); err != nil {
+			slog.Warn("Couldn't set gRPC trailer", "err", err)
+		}
+		return nil, status.Error(grpcCode(code), response.Error)
+	}
+	return createBookingResponse(response), nil
+}
+
+// grpcCode returns the gRPC status code for a booking that failed with the given HTTP status code:
+// InvalidArgument for details that don't check out, like an invalid phone number or a time outside opening hours,
+// FailedPrecondition for a slot that's taken, and Unavailable when MessageBird is down or we can't send any more.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
+
+// logRPCs logs every RPC once it's been answered, the way logRequests logs HTTP requests, and gives it an id for
+// errorID. The id is in the x-request-id response header.
+func logRPCs(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	id := newErrorID()
+	if err := grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id)); err != nil {
+		slog.Warn("Couldn't set gRPC header", "err", err)
+	}
+	resp, err := handler(context.WithValue(ctx, requestIDKey{}, id), req)
+	slog.Info("RPC", "request_id", id, "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+	return resp, err
+}
+
+// requestedBooking returns the booking in, a CreateBookingRequest, asks for. It has the fields of the JSON API's
+// booking that customers can set.
+func requestedBooking(in *CreateBookingRequest) booking {
+	b := booking{
+		Name:         in.GetName(),
+		Treatment:    in.GetTreatment(),
+		Staff:        in.GetStaff(),
+		Branch:       in.GetBranch(),
+		Notes:        in.GetNotes(),
+		Consent:      in.GetConsent(),
+		DryRun:       in.GetDryRun(),
+		Phone:        in.GetPhone(),
+		ContactPhone: in.GetContactPhone(),
+		Phones:       in.GetPhones(),
+		Country:      in.GetCountry(),
+		Email:        in.GetEmail(),
+		ReminderLead: in.GetReminderLead(),
+		Channel:      in.GetChannel(),
+		Language:     in.GetLanguage(),
+	}
+	// The timestamp is in UTC; makeBooking moves it to the branch's timezone.
+	if in.GetBookingTime() != nil {
+		bookingTime := in.GetBookingTime().AsTime()
+		b.BookingTime = &bookingTime
+	}
+	return b
+}
+
+// createBookingResponse returns r, the bookingResponse of a booking that went through, as a CreateBookingResponse.
+func createBookingResponse(r bookingResponse) *CreateBookingResponse {
+	out := &CreateBookingResponse{
+		Id:             r.ID,
+		Channel:        r.Channel,
+		Phone:          r.Phone,
+		ContactPhone:   r.ContactPhone,
+		Phones:         r.Phones,
+		RejectedPhones: r.RejectedPhones,
+		Country:        r.Country,
+		Language:       r.Language,
+		Status:         r.Status,
+		DryRun:         r.DryRun,
+		SmsSegments:    int32(r.SMSSegments),
+		EstimatedCost:  r.EstimatedCost,
+		Reference:      r.Reference,
+	}
+	if r.BookingTime != nil {
+		out.BookingTime = timestamppb.New(*r.BookingTime)
+	}
+	for _, t := range r.ReminderTimes {
+		out.ReminderTimes = append(out.ReminderTimes, timestamppb.New(t))
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newTestBookingsClient serves a's Bookings service in memory, and returns a client of it made from booking.proto,
+// the way other services make theirs.
+func newTestBookingsClient(t *testing.T, a *app) BookingsClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := newGRPCServer(a)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewBookingsClient(conn)
+}
+
+func TestGRPCCreateBooking(t *testing.T) {
+	a, client := newTestApp(t)
+	bookings := newTestBookingsClient(t, a)
+
+	bookingTime := time.Date(2026, 3, 11, 14, 0, 0, 0, loc)
+	resp, err := bookings.CreateBooking(context.Background(), &CreateBookingRequest{
+		Name:        "Jane",
+		Treatment:   "Haircut",
+		Phone:       "+31612345678",
+		Consent:     true,
+		BookingTime: timestamppb.New(bookingTime),
+		Phones:      []string{"+31611111111"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetId() == "" || resp.GetReference() == "" || resp.GetStatus() != "booked" {
+		t.Errorf("got id %q, reference %q and status %q, want a booking", resp.GetId(), resp.GetReference(), resp.GetStatus())
+	}
+	if !resp.GetBookingTime().AsTime().Equal(bookingTime) || resp.GetPhone() != "+31612345678" || len(resp.GetPhones()) != 1 {
+		t.Errorf("got booking at %v for %q and %v, want %v for +31612345678 and +31611111111", resp.GetBookingTime().AsTime(), resp.GetPhone(), resp.GetPhones(), bookingTime)
+	}
+	if len(resp.GetReminderTimes()) != len(client.Messages) || resp.GetSmsSegments() == 0 {
+		t.Errorf("got %d reminder times and %d segments, want %d reminders", len(resp.GetReminderTimes()), resp.GetSmsSegments(), len(client.Messages))
+	}
+	saved, err := a.store.Get(resp.GetId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Name != "Jane" || saved.Treatment != "Haircut" || !saved.BookingTime.Equal(bookingTime) {
+		t.Errorf("saved %+v, want Jane's Haircut at %v", saved, bookingTime)
+	}
+}
+
+func TestGRPCCreateBookingFails(t *testing.T) {
+	a, _ := newTestApp(t)
+	bookings := newTestBookingsClient(t, a)
+
+	var trailer metadata.MD
+	_, err := bookings.CreateBooking(context.Background(), &CreateBookingRequest{
+		Name:        "Jane",
+		Treatment:   "Haircut",
+		Phone:       "+31600000000",
+		Consent:     true,
+		BookingTime: timestamppb.New(time.Date(2026, 3, 11, 14, 0, 0, 0, loc)),
+	}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got %v, want %v", err, codes.InvalidArgument)
+	}
+	if code, field := trailer.Get(grpcErrorCodeKey), trailer.Get(grpcErrorFieldKey); len(code) != 1 || code[0] != string(codeInvalidPhone) || len(field) != 1 || field[0] != "phone" {
+		t.Errorf("got trailers %v, want %s for phone", trailer, codeInvalidPhone)
+	}
+}
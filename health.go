@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// healthz reports that the server is up. It doesn't check anything else, so a load balancer can tell a hung process
+// from one that's just not ready.
+func (a *app) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// readyz reports whether we're ready to take bookings: startup has finished, and we have a MessageBird client,
+// somewhere to keep bookings, a timezone and our templates. It responds with 503 Service Unavailable until then, and again once we start shutting down.
+func (a *app) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if atomic.LoadInt32(&a.ready) == 0 || a.client == nil || a.store == nil || loc == nil || templates == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultLocale is the locale we fall back to when we don't speak the customer's language,
+// or when a message hasn't been translated yet.
+const defaultLocale = "en"
+
+// locale is a language we speak: its code, as used in catalog, and its name in that language.
+type locale struct {
+	Code string
+	Name string
+}
+
+// locales are the languages we can show in the language picker, in the order they're listed.
+var locales = []locale{
+	{"en", "English"},
+	{"nl", "Nederlands"},
+	{"de", "Deutsch"},
+}
+
+// catalog holds every customer-facing message, by locale and then by message id.
+// Messages with arguments are fmt format strings; use explicit argument indexes like %[2]s,
+// so that translations can put the arguments in a different order.
+var catalog = map[string]map[string]string{
+	"en": {
+		"date_format": "Mon, 02 Jan 2006 3:04 PM",
+		"time_format": "03:04 PM",
+		"and":         " and ",
+		"one_hour":    "1 hour",
+		"hours":       "%[1]d hours",
+		"one_minute":  "1 minute",
+		"minutes":     "%[1]d minutes",
+
+		"reminder_note": "Your note: %[1]s",
+		"email_subject": "Your %[1]s appointment",
+
+		"booking_done":             "Done! We've set up an appointment for you at %[1]s (%[2]s time) for %[3]s. We'll send reminders %[4]s at %[5]s. Your booking reference is %[6]s; you'll need it if you want to cancel. Thanks for booking with %[7]s!",
+		"dry_run_done":             "DRY RUN: nothing was booked, and no reminders were scheduled. This booking for %[3]s at %[1]s (%[2]s time) would go through, with reminders %[4]s at %[5]s.",
+		"booking_done_no_reminder": "Done! We've set up an appointment for you at %[1]s (%[2]s time) for %[3]s. It's too soon for a reminder, so we won't send you one. Your booking reference is %[6]s; you'll need it if you want to cancel. Thanks for booking with %[7]s!",
+		"dry_run_done_no_reminder": "DRY RUN: nothing was booked, and no reminders were scheduled. This booking for %[3]s at %[1]s (%[2]s time) would go through, but it's too soon for a reminder.",
+		"channel_sms":              "by SMS to %[1]s",
+		"channel_whatsapp":         "on WhatsApp to %[1]s",
+		"channel_voice":            "by phone call to %[1]s",
+		"channel_sms_fallback":     "by SMS, because we couldn't reach you on WhatsApp, to %[1]s",
+		"channel_email":            "%[1]s and by email to %[2]s",
+		"whatsapp_welcome":         "Hi! We'll send the %[1]s appointment reminders for %[2]s here.",
+
+		"reply_confirmed": "Thanks! Your %[1]s appointment on %[2]s is confirmed. See you then!",
+		"reply_cancelled": "Your %[1]s appointment on %[2]s has been cancelled. We hope to see you another time!",
+		"reply_unknown":   "Sorry, we didn't understand that. Reply Y to confirm your %[1]s appointment on %[2]s, or C to cancel it.",
+		"reply_opted_out": "You won't get any more text messages from %[1]s. Reply %[2]s to get them again.",
+		"reply_opted_in":  "Welcome back! %[1]s will text you about your appointments again. Reply %[2]s to stop.",
+
+		"invalid_form":                "Sorry, we couldn't read your booking. Please try again.",
+		"invalid_booking_time":        "Please enter a valid date and time.",
+		"invalid_name":                "Please enter your name.",
+		"name_too_long":               "Please enter a name of at most %[1]d characters.",
+		"notes_too_long":              "Please keep your notes to at most %[1]d characters.",
+		"consent_required":            "Please agree to get our reminders, so that we can send them to you.",
+		"opted_out":                   "You've asked us not to text this number. To get our reminders again, text %[1]s to us first.",
+		"invalid_treatment":           "Please choose a treatment.",
+		"invalid_staff":               "Please choose a stylist.",
+		"invalid_branch":              "Please choose one of our branches.",
+		"staff_unavailable":           "Sorry, %[1]s is already booked at that time. Please choose another time or stylist.",
+		"day_full":                    "Sorry, we're fully booked that day. Please choose another day.",
+		"slot_taken":                  "Sorry, that time is already taken. Please choose another time.",
+		"invalid_reminder_lead":       "Please choose a valid reminder time.",
+		"reminder_lead_range":         "Reminders can be sent between %[1]v minutes and %[2]v hours before your appointment.",
+		"whatsapp_unavailable":        "Sorry, we can't send reminders on WhatsApp yet. Please choose SMS.",
+		"voice_unavailable":           "Sorry, we can't call you with reminders yet. Please choose SMS.",
+		"invalid_channel":             "Please choose how you'd like to get your reminders.",
+		"invalid_recurrence":          "Please choose how often you'd like to come back.",
+		"invalid_occurrences":         "Please choose between 2 and %[1]d appointments.",
+		"email_unavailable":           "Sorry, we can't send reminders by email yet.",
+		"invalid_email":               "Please enter a valid email address.",
+		"invalid_language":            "Please choose a language for your reminders.",
+		"invalid_phone":               "Please enter a valid phone number.",
+		"too_many_phones":             "Please enter at most %[1]d more phone numbers for your group.",
+		"phones_sms_only":             "We can only send your group's reminders by SMS.",
+		"not_mobile":                  "Please enter a mobile number, so that we can text you your reminders.",
+		"invalid_country":             "Please enter a valid two-letter country code, like NL.",
+		"sms_failed":                  "Sorry, we couldn't schedule your reminders. Please try again later, or contact us and mention error %[1]s.",
+		"email_failed":                "We couldn't schedule your email reminder. Please try again!",
+		"timeout":                     "Our SMS provider is slow to respond right now. Please try again in a moment.",
+		"lookup_unavailable":          "We can't check phone numbers right now. Please try again in a few minutes.",
+		"lookup_unavailable_national": "We can't check phone numbers right now. Please enter your number with its country code, like +31612345678.",
+		"store_failed":                "We scheduled your reminders, but couldn't save your booking. Please contact us to confirm your appointment.",
+		"internal_error":              "Something went wrong on our side, so we couldn't make the booking. Nothing was scheduled, so please try again.",
+
+		"in_past":              "Cannot make a booking before now. Please try again!",
+		"too_far":              "Sorry, we only take bookings up to %[1]d days in advance.",
+		"closed_day":           "We're closed on %[1]ss! Please book your appointment on another day.",
+		"before_opening":       "We're not open yet! Please book your appointment between %[1]s and %[2]s.",
+		"after_closing":        "We're closed! Please book your appointment between %[1]s and %[2]s.",
+		"runs_past_closing":    "This treatment takes %[1]d minutes, so it has to start by %[2]s to be finished before we close.",
+		"short_notice":         "We need at least %[1]s' notice for an appointment.",
+		"too_soon":             "Please book your appointment at least %[1]s in advance.",
+		"off_slot":             "Appointments start every %[1]s. How about %[2]s?",
+		"earliest_time":        " The earliest we can book you in is %[1]s.",
+		"invalid_time":         "Please choose a different time for your appointment.",
+		"rate_limited":         "Too many bookings for this phone number. Please try again later.",
+		"sms_budget_exhausted": "Sorry, we can't take any more bookings online today. Please try again tomorrow, or give us a call.",
+		"duplicate_request":    "We're still working on this booking. Please wait a moment.",
+		"invalid_confirmation": "This confirmation has expired. Please check your details and book again.",
+		"waitlisted":           "You're on the waitlist for %[1]s. If the slot frees up, we'll text you, and keep it for you for a while.",
+		"waitlist_failed":      "Sorry, we couldn't put you on the waitlist. Please try again later.",
+		"slots_failed":         "Sorry, we couldn't look up the free times. Please try again later.",
+
+		"Sunday":    "Sunday",
+		"Monday":    "Monday",
+		"Tuesday":   "Tuesday",
+		"Wednesday": "Wednesday",
+		"Thursday":  "Thursday",
+		"Friday":    "Friday",
+		"Saturday":  "Saturday",
+
+		"booking_not_found":       "We couldn't find a booking with that reference. Please check it and try again.",
+		"reminder_status_failed":  "We couldn't check all of your reminders right now. Please try again later.",
+		"already_cancelled":       "This booking has already been cancelled.",
+		"invalid_cancel_link":     "This cancellation link isn't valid, or has expired. Please use the link in the latest message we sent you.",
+		"invalid_reschedule_link": "This link to move your appointment isn't valid, or has expired. Please use the link in the latest message we sent you.",
+		"cancel_reminders_failed": "We couldn't cancel your reminders. Please try again later.",
+		"cancel_failed":           "We couldn't cancel your booking. Please try again later.",
+		"cancelled":               "Your appointment at %[1]s has been cancelled.",
+		"cancelled_reminder_sent": " Unfortunately it's too late to cancel the reminder we already sent, so please ignore it.",
+		"cancelled_series":        " We've also cancelled the %[1]d later appointments in this series.",
+		"cancel_series_failed":    " We couldn't cancel the later appointments in this series, though. Please try again later.",
+
+		"series_booked":   " We've also booked you in at %[1]s, with the same reminders.",
+		"name_shortened":  " To fit your reminders in a single SMS, we've shortened your name to %[1]s.",
+		"phones_rejected": " We won't send reminders to %[1]s: please check these numbers, or ask them to text START to us if they've opted out.",
+		"series_skipped":  " We couldn't book you in at %[1]s, because we're not open then or it's too far ahead.",
+		"series_failed":   " We couldn't book the rest of your appointments: %[1]s",
+
+		"invalid_date":            "Please choose a date and time.",
+		"treatment_unavailable":   "Sorry, we no longer offer this treatment, so we can't move this appointment. Please contact us.",
+		"reschedule_failed":       "We couldn't move your reminders. Please try again later.",
+		"reschedule_save_failed":  "We scheduled your new reminders, but couldn't save your new appointment time. Please contact us to confirm your appointment.",
+		"rescheduled":             "Your appointment has been moved to %[1]s. We'll send your reminders at %[2]s.",
+		"rescheduled_no_reminder": "Your appointment has been moved to %[1]s. It's too soon for a reminder, so we won't send you one.",
+	},
+	"nl": {
+		"date_format": "02-01-2006 15:04",
+		"time_format": "15:04",
+		"and":         " en ",
+		"one_hour":    "1 uur",
+		"hours":       "%[1]d uur",
+		"one_minute":  "1 minuut",
+		"minutes":     "%[1]d minuten",
+
+		"reminder_note": "Je notitie: %[1]s",
+		"email_subject": "Je afspraak bij %[1]s",
+
+		"booking_done":             "Klaar! We hebben een afspraak voor je gemaakt op %[1]s (%[2]s-tijd) voor %[3]s. We sturen je herinneringen %[4]s op %[5]s. Je boekingsnummer is %[6]s; dat heb je nodig als je wilt annuleren. Bedankt dat je bij %[7]s boekt!",
+		"dry_run_done":             "PROEFBOEKING: er is niets geboekt en er zijn geen herinneringen ingepland. Deze afspraak voor %[3]s op %[1]s (%[2]s-tijd) zou lukken, met herinneringen %[4]s op %[5]s.",
+		"booking_done_no_reminder": "Klaar! We hebben een afspraak voor je gemaakt op %[1]s (%[2]s-tijd) voor %[3]s. Het is te laat voor een herinnering, dus we sturen je er geen. Je boekingsnummer is %[6]s; dat heb je nodig als je wilt annuleren. Bedankt dat je bij %[7]s boekt!",
+		"dry_run_done_no_reminder": "PROEFBOEKING: er is niets geboekt en er zijn geen herinneringen ingepland. Deze afspraak voor %[3]s op %[1]s (%[2]s-tijd) zou lukken, maar het is te laat voor een herinnering.",
+		"channel_sms":              "per sms naar %[1]s",
+		"channel_whatsapp":         "via WhatsApp naar %[1]s",
+		"channel_voice":            "telefonisch op %[1]s",
+		"channel_sms_fallback":     "per sms, omdat we je niet via WhatsApp konden bereiken, naar %[1]s",
+		"channel_email":            "%[1]s en per e-mail naar %[2]s",
+		"whatsapp_welcome":         "Hoi! We sturen de afspraakherinneringen van %[1]s voor %[2]s hierheen.",
+
+		"reply_confirmed": "Bedankt! Je afspraak bij %[1]s op %[2]s is bevestigd. Tot dan!",
+		"reply_cancelled": "Je afspraak bij %[1]s op %[2]s is geannuleerd. We zien je graag een andere keer!",
+		"reply_unknown":   "Sorry, dat begrepen we niet. Antwoord Y om je afspraak bij %[1]s op %[2]s te bevestigen, of C om hem te annuleren.",
+		"reply_opted_out": "Je krijgt geen sms'jes meer van %[1]s. Antwoord %[2]s om ze weer te krijgen.",
+		"reply_opted_in":  "Welkom terug! %[1]s stuurt je weer sms'jes over je afspraken. Antwoord %[2]s om te stoppen.",
+
+		"invalid_form":                "Sorry, we konden je boeking niet lezen. Probeer het opnieuw.",
+		"invalid_booking_time":        "Vul een geldige datum en tijd in.",
+		"invalid_name":                "Vul je naam in.",
+		"name_too_long":               "Vul een naam in van maximaal %[1]d tekens.",
+		"notes_too_long":              "Houd je opmerkingen kort: maximaal %[1]d tekens.",
+		"consent_required":            "Geef toestemming voor onze herinneringen, zodat we ze je kunnen sturen.",
+		"opted_out":                   "Je hebt ons gevraagd dit nummer geen sms meer te sturen. Wil je onze herinneringen weer ontvangen? Stuur ons dan eerst %[1]s.",
+		"invalid_treatment":           "Kies een behandeling.",
+		"invalid_staff":               "Kies een stylist.",
+		"invalid_branch":              "Kies een van onze vestigingen.",
+		"staff_unavailable":           "Sorry, %[1]s is op dat moment al geboekt. Kies een andere tijd of stylist.",
+		"day_full":                    "Sorry, we zitten die dag vol. Kies een andere dag.",
+		"slot_taken":                  "Sorry, dat tijdstip is al bezet. Kies een andere tijd.",
+		"invalid_reminder_lead":       "Kies een geldige tijd voor je herinnering.",
+		"reminder_lead_range":         "Herinneringen kunnen tussen %[1]v minuten en %[2]v uur voor je afspraak worden verstuurd.",
+		"whatsapp_unavailable":        "Sorry, we kunnen nog geen herinneringen via WhatsApp versturen. Kies alsjeblieft sms.",
+		"voice_unavailable":           "Sorry, we kunnen je nog niet bellen met herinneringen. Kies alsjeblieft sms.",
+		"invalid_channel":             "Kies hoe je je herinneringen wilt ontvangen.",
+		"invalid_recurrence":          "Kies hoe vaak je terug wilt komen.",
+		"invalid_occurrences":         "Kies tussen 2 en %[1]d afspraken.",
+		"email_unavailable":           "Sorry, we kunnen nog geen herinneringen per e-mail versturen.",
+		"invalid_email":               "Vul een geldig e-mailadres in.",
+		"invalid_language":            "Kies een taal voor je herinneringen.",
+		"invalid_phone":               "Vul een geldig telefoonnummer in.",
+		"too_many_phones":             "Vul maximaal %[1]d extra telefoonnummers voor je groep in.",
+		"phones_sms_only":             "We kunnen de herinneringen voor je groep alleen per sms sturen.",
+		"not_mobile":                  "Vul een mobiel nummer in, zodat we je herinneringen per sms kunnen sturen.",
+		"invalid_country":             "Vul een geldige landcode van twee letters in, zoals NL.",
+		"sms_failed":                  "Sorry, we konden je herinneringen niet inplannen. Probeer het later opnieuw, of neem contact met ons op en noem foutcode %[1]s.",
+		"email_failed":                "We konden je herinnering per e-mail niet inplannen. Probeer het opnieuw!",
+		"timeout":                     "Onze sms-provider reageert op dit moment traag. Probeer het zo opnieuw.",
+		"lookup_unavailable":          "We kunnen telefoonnummers op dit moment niet controleren. Probeer het over een paar minuten opnieuw.",
+		"lookup_unavailable_national": "We kunnen telefoonnummers op dit moment niet controleren. Vul je nummer in met landcode, zoals +31612345678.",
+		"store_failed":                "We hebben je herinneringen ingepland, maar konden je boeking niet opslaan. Neem contact met ons op om je afspraak te bevestigen.",
+		"internal_error":              "Er ging bij ons iets mis, waardoor we de boeking niet konden maken. Er is niets ingepland, dus probeer het opnieuw.",
+
+		"in_past":              "Je kunt geen afspraak in het verleden maken. Probeer het opnieuw!",
+		"too_far":              "Sorry, je kunt maximaal %[1]d dagen van tevoren boeken.",
+		"closed_day":           "Op %[1]s zijn we gesloten! Boek je afspraak op een andere dag.",
+		"before_opening":       "We zijn nog niet open! Boek je afspraak tussen %[1]s en %[2]s.",
+		"after_closing":        "We zijn gesloten! Boek je afspraak tussen %[1]s en %[2]s.",
+		"runs_past_closing":    "Deze behandeling duurt %[1]d minuten, dus hij moet uiterlijk om %[2]s beginnen om klaar te zijn voordat we sluiten.",
+		"short_notice":         "We hebben minstens %[1]s van tevoren nodig voor een afspraak.",
+		"too_soon":             "Boek je afspraak minstens %[1]s van tevoren.",
+		"off_slot":             "Afspraken beginnen elke %[1]s. Wat dacht je van %[2]s?",
+		"earliest_time":        " Het eerste moment waarop we je kunnen inplannen is %[1]s.",
+		"invalid_time":         "Kies een andere tijd voor je afspraak.",
+		"rate_limited":         "Er zijn te veel boekingen voor dit telefoonnummer gemaakt. Probeer het later opnieuw.",
+		"sms_budget_exhausted": "Sorry, we kunnen vandaag geen boekingen meer online aannemen. Probeer het morgen opnieuw, of bel ons.",
+		"duplicate_request":    "We zijn nog met deze boeking bezig. Een ogenblik geduld.",
+		"invalid_confirmation": "Deze bevestiging is verlopen. Controleer je gegevens en boek opnieuw.",
+		"waitlisted":           "Je staat op de wachtlijst voor %[1]s. Als het tijdstip vrijkomt, sturen we je een sms en houden we het even voor je vrij.",
+		"waitlist_failed":      "Sorry, we konden je niet op de wachtlijst zetten. Probeer het later opnieuw.",
+		"slots_failed":         "Sorry, we konden de vrije tijden niet opzoeken. Probeer het later opnieuw.",
+
+		"Sunday":    "zondag",
+		"Monday":    "maandag",
+		"Tuesday":   "dinsdag",
+		"Wednesday": "woensdag",
+		"Thursday":  "donderdag",
+		"Friday":    "vrijdag",
+		"Saturday":  "zaterdag",
+
+		"booking_not_found":       "We konden geen boeking met dat nummer vinden. Controleer het en probeer het opnieuw.",
+		"reminder_status_failed":  "We konden je herinneringen nu niet allemaal controleren. Probeer het later opnieuw.",
+		"already_cancelled":       "Deze boeking is al geannuleerd.",
+		"invalid_cancel_link":     "Deze annuleringslink is ongeldig of verlopen. Gebruik de link in het laatste bericht dat we je hebben gestuurd.",
+		"invalid_reschedule_link": "Deze link om je afspraak te verzetten is ongeldig of verlopen. Gebruik de link in het laatste bericht dat we je hebben gestuurd.",
+		"cancel_reminders_failed": "We konden je herinneringen niet annuleren. Probeer het later opnieuw.",
+		"cancel_failed":           "We konden je boeking niet annuleren. Probeer het later opnieuw.",
+		"cancelled":               "Je afspraak op %[1]s is geannuleerd.",
+		"cancelled_reminder_sent": " Helaas is de herinnering die we al hebben verstuurd niet meer te annuleren, dus die kun je negeren.",
+		"cancelled_series":        " We hebben ook de %[1]d latere afspraken in deze reeks geannuleerd.",
+		"cancel_series_failed":    " We konden de latere afspraken in deze reeks helaas niet annuleren. Probeer het later opnieuw.",
+
+		"series_booked":   " We hebben je ook ingepland op %[1]s, met dezelfde herinneringen.",
+		"name_shortened":  " Om je herinneringen in één sms te laten passen, hebben we je naam ingekort tot %[1]s.",
+		"phones_rejected": " We sturen geen herinneringen naar %[1]s: controleer deze nummers, of vraag ze ons START te sms'en als ze zich hebben afgemeld.",
+		"series_skipped":  " We konden je niet inplannen op %[1]s, omdat we dan niet open zijn of het te ver vooruit is.",
+		"series_failed":   " We konden de rest van je afspraken niet boeken: %[1]s",
+
+		"invalid_date":            "Kies een datum en tijd.",
+		"treatment_unavailable":   "Sorry, we bieden deze behandeling niet meer aan, dus we kunnen deze afspraak niet verzetten. Neem contact met ons op.",
+		"reschedule_failed":       "We konden je herinneringen niet verzetten. Probeer het later opnieuw.",
+		"reschedule_save_failed":  "We hebben je nieuwe herinneringen ingepland, maar konden de nieuwe tijd van je afspraak niet opslaan. Neem contact met ons op om je afspraak te bevestigen.",
+		"rescheduled":             "Je afspraak is verzet naar %[1]s. We sturen je herinneringen op %[2]s.",
+		"rescheduled_no_reminder": "Je afspraak is verzet naar %[1]s. Het is te laat voor een herinnering, dus we sturen je er geen.",
+	},
+	"de": {
+		"date_format": "02.01.2006 15:04",
+		"time_format": "15:04",
+		"and":         " und ",
+		"one_hour":    "1 Stunde",
+		"hours":       "%[1]d Stunden",
+		"one_minute":  "1 Minute",
+		"minutes":     "%[1]d Minuten",
+
+		"reminder_note": "Deine Notiz: %[1]s",
+		"email_subject": "Dein Termin bei %[1]s",
+
+		"booking_done":             "Fertig! Wir haben einen Termin für %[3]s am %[1]s (%[2]s-Zeit) für dich eingetragen. Wir schicken dir Erinnerungen %[4]s am %[5]s. Deine Buchungsnummer ist %[6]s; du brauchst sie, wenn du absagen möchtest. Danke, dass du bei %[7]s buchst!",
+		"dry_run_done":             "PROBELAUF: Es wurde nichts gebucht und keine Erinnerung geplant. Dieser Termin für %[3]s am %[1]s (%[2]s-Zeit) würde klappen, mit Erinnerungen %[4]s am %[5]s.",
+		"booking_done_no_reminder": "Fertig! Wir haben einen Termin für %[3]s am %[1]s (%[2]s-Zeit) für dich eingetragen. Für eine Erinnerung ist es zu spät, deshalb schicken wir dir keine. Deine Buchungsnummer ist %[6]s; du brauchst sie, wenn du absagen möchtest. Danke, dass du bei %[7]s buchst!",
+		"dry_run_done_no_reminder": "PROBELAUF: Es wurde nichts gebucht und keine Erinnerung geplant. Dieser Termin für %[3]s am %[1]s (%[2]s-Zeit) würde klappen, aber für eine Erinnerung ist es zu spät.",
+		"channel_sms":              "per SMS an %[1]s",
+		"channel_whatsapp":         "über WhatsApp an %[1]s",
+		"channel_voice":            "per Anruf unter %[1]s",
+		"channel_sms_fallback":     "per SMS, weil wir dich über WhatsApp nicht erreichen konnten, an %[1]s",
+		"channel_email":            "%[1]s und per E-Mail an %[2]s",
+		"whatsapp_welcome":         "Hallo! Wir schicken die Terminerinnerungen von %[1]s für %[2]s hierher.",
+
+		"reply_confirmed": "Danke! Dein Termin bei %[1]s am %[2]s ist bestätigt. Bis dann!",
+		"reply_cancelled": "Dein Termin bei %[1]s am %[2]s wurde abgesagt. Wir hoffen, dich ein anderes Mal zu sehen!",
+		"reply_unknown":   "Das haben wir leider nicht verstanden. Antworte Y, um deinen Termin bei %[1]s am %[2]s zu bestätigen, oder C, um ihn abzusagen.",
+		"reply_opted_out": "Du bekommst keine SMS mehr von %[1]s. Antworte %[2]s, um sie wieder zu bekommen.",
+		"reply_opted_in":  "Willkommen zurück! %[1]s schickt dir wieder SMS zu deinen Terminen. Antworte %[2]s, um sie abzubestellen.",
+
+		"invalid_form":                "Leider konnten wir deine Buchung nicht lesen. Bitte versuche es erneut.",
+		"invalid_booking_time":        "Bitte gib ein gültiges Datum und eine gültige Uhrzeit ein.",
+		"invalid_name":                "Bitte gib deinen Namen ein.",
+		"name_too_long":               "Bitte gib einen Namen mit höchstens %[1]d Zeichen ein.",
+		"notes_too_long":              "Bitte fasse deine Anmerkungen in höchstens %[1]d Zeichen.",
+		"consent_required":            "Bitte stimme unseren Erinnerungen zu, damit wir sie dir schicken können.",
+		"opted_out":                   "Du hast uns gebeten, dieser Nummer keine SMS mehr zu schicken. Um unsere Erinnerungen wieder zu bekommen, schicke uns zuerst %[1]s.",
+		"invalid_treatment":           "Bitte wähle eine Behandlung.",
+		"invalid_staff":               "Bitte wähle, bei wem du deinen Termin möchtest.",
+		"invalid_branch":              "Bitte wähle eine unserer Filialen.",
+		"staff_unavailable":           "Leider ist %[1]s zu dieser Zeit schon ausgebucht. Bitte wähle eine andere Zeit oder jemand anderen aus unserem Team.",
+		"day_full":                    "Leider sind wir an diesem Tag ausgebucht. Bitte wähle einen anderen Tag.",
+		"slot_taken":                  "Leider ist diese Uhrzeit schon vergeben. Bitte wähle eine andere Uhrzeit.",
+		"invalid_reminder_lead":       "Bitte wähle eine gültige Erinnerungszeit.",
+		"reminder_lead_range":         "Erinnerungen können zwischen %[1]v Minuten und %[2]v Stunden vor deinem Termin verschickt werden.",
+		"whatsapp_unavailable":        "Leider können wir noch keine Erinnerungen über WhatsApp verschicken. Bitte wähle SMS.",
+		"voice_unavailable":           "Leider können wir dich noch nicht mit Erinnerungen anrufen. Bitte wähle SMS.",
+		"invalid_channel":             "Bitte wähle, wie du deine Erinnerungen erhalten möchtest.",
+		"invalid_recurrence":          "Bitte wähle, wie oft du wiederkommen möchtest.",
+		"invalid_occurrences":         "Bitte wähle zwischen 2 und %[1]d Terminen.",
+		"email_unavailable":           "Leider können wir noch keine Erinnerungen per E-Mail verschicken.",
+		"invalid_email":               "Bitte gib eine gültige E-Mail-Adresse ein.",
+		"invalid_language":            "Bitte wähle eine Sprache für deine Erinnerungen.",
+		"invalid_phone":               "Bitte gib eine gültige Telefonnummer ein.",
+		"too_many_phones":             "Bitte gib höchstens %[1]d weitere Telefonnummern für deine Gruppe ein.",
+		"phones_sms_only":             "Die Erinnerungen für deine Gruppe können wir nur per SMS schicken.",
+		"not_mobile":                  "Bitte gib eine Handynummer ein, damit wir dir deine Erinnerungen per SMS schicken können.",
+		"invalid_country":             "Bitte gib einen gültigen Ländercode aus zwei Buchstaben ein, z. B. DE.",
+		"sms_failed":                  "Leider konnten wir deine Erinnerungen nicht planen. Bitte versuche es später erneut, oder kontaktiere uns und nenne den Fehlercode %[1]s.",
+		"email_failed":                "Wir konnten deine E-Mail-Erinnerung nicht planen. Bitte versuche es erneut!",
+		"timeout":                     "Unser SMS-Anbieter antwortet gerade nur langsam. Bitte versuche es gleich noch einmal.",
+		"lookup_unavailable":          "Wir können Telefonnummern gerade nicht prüfen. Bitte versuche es in ein paar Minuten noch einmal.",
+		"lookup_unavailable_national": "Wir können Telefonnummern gerade nicht prüfen. Bitte gib deine Nummer mit Ländervorwahl ein, wie +31612345678.",
+		"store_failed":                "Wir haben deine Erinnerungen geplant, konnten deine Buchung aber nicht speichern. Bitte kontaktiere uns, um deinen Termin zu bestätigen.",
+		"internal_error":              "Bei uns ist etwas schiefgelaufen, deshalb konnten wir die Buchung nicht vornehmen. Es wurde nichts geplant, also versuche es bitte erneut.",
+
+		"in_past":              "Du kannst keinen Termin in der Vergangenheit buchen. Bitte versuche es erneut!",
+		"too_far":              "Leider kannst du höchstens %[1]d Tage im Voraus buchen.",
+		"closed_day":           "Am %[1]s haben wir geschlossen! Bitte buche deinen Termin an einem anderen Tag.",
+		"before_opening":       "Wir haben noch nicht geöffnet! Bitte buche deinen Termin zwischen %[1]s und %[2]s.",
+		"after_closing":        "Wir haben schon geschlossen! Bitte buche deinen Termin zwischen %[1]s und %[2]s.",
+		"runs_past_closing":    "Diese Behandlung dauert %[1]d Minuten, sie muss also spätestens um %[2]s beginnen, damit sie vor Ladenschluss fertig ist.",
+		"short_notice":         "Wir brauchen für einen Termin mindestens %[1]s Vorlauf.",
+		"too_soon":             "Bitte buche deinen Termin mindestens %[1]s im Voraus.",
+		"off_slot":             "Termine beginnen alle %[1]s. Wie wäre es mit %[2]s?",
+		"earliest_time":        " Der früheste Termin, den wir dir geben können, ist %[1]s.",
+		"invalid_time":         "Bitte wähle eine andere Zeit für deinen Termin.",
+		"rate_limited":         "Zu viele Buchungen für diese Telefonnummer. Bitte versuche es später erneut.",
+		"sms_budget_exhausted": "Leider können wir heute keine Online-Buchungen mehr annehmen. Bitte versuche es morgen wieder, oder ruf uns an.",
+		"duplicate_request":    "Wir bearbeiten diese Buchung noch. Bitte warte einen Moment.",
+		"invalid_confirmation": "Diese Bestätigung ist abgelaufen. Bitte prüfe deine Angaben und buche noch einmal.",
+		"waitlisted":           "Du stehst auf der Warteliste für %[1]s. Wenn der Termin frei wird, schicken wir dir eine SMS und halten ihn eine Weile für dich frei.",
+		"waitlist_failed":      "Leider konnten wir dich nicht auf die Warteliste setzen. Bitte versuche es später erneut.",
+		"slots_failed":         "Leider konnten wir die freien Zeiten nicht nachschlagen. Bitte versuche es später erneut.",
+
+		"Sunday":    "Sonntag",
+		"Monday":    "Montag",
+		"Tuesday":   "Dienstag",
+		"Wednesday": "Mittwoch",
+		"Thursday":  "Donnerstag",
+		"Friday":    "Freitag",
+		"Saturday":  "Samstag",
+
+		"booking_not_found":       "Wir konnten keine Buchung mit dieser Nummer finden. Bitte überprüfe sie und versuche es erneut.",
+		"reminder_status_failed":  "Wir konnten gerade nicht alle deine Erinnerungen prüfen. Bitte versuche es später noch einmal.",
+		"already_cancelled":       "Diese Buchung wurde bereits storniert.",
+		"invalid_cancel_link":     "Dieser Stornierungslink ist ungültig oder abgelaufen. Bitte nutze den Link aus der letzten Nachricht, die wir dir geschickt haben.",
+		"invalid_reschedule_link": "Dieser Link zum Verschieben deines Termins ist ungültig oder abgelaufen. Bitte nutze den Link aus der letzten Nachricht, die wir dir geschickt haben.",
+		"cancel_reminders_failed": "Wir konnten deine Erinnerungen nicht stornieren. Bitte versuche es später erneut.",
+		"cancel_failed":           "Wir konnten deine Buchung nicht stornieren. Bitte versuche es später erneut.",
+		"cancelled":               "Dein Termin am %[1]s wurde storniert.",
+		"cancelled_reminder_sent": " Leider ist es zu spät, die bereits verschickte Erinnerung zurückzunehmen, du kannst sie einfach ignorieren.",
+		"cancelled_series":        " Wir haben auch die %[1]d späteren Termine dieser Serie storniert.",
+		"cancel_series_failed":    " Die späteren Termine dieser Serie konnten wir leider nicht stornieren. Bitte versuche es später erneut.",
+
+		"series_booked":   " Wir haben dich außerdem am %[1]s eingetragen, mit denselben Erinnerungen.",
+		"name_shortened":  " Damit deine Erinnerungen in eine SMS passen, haben wir deinen Namen auf %[1]s gekürzt.",
+		"phones_rejected": " An %[1]s schicken wir keine Erinnerungen: Bitte prüfe diese Nummern, oder bitte sie, uns START zu schicken, falls sie sich abgemeldet haben.",
+		"series_skipped":  " Am %[1]s konnten wir dich nicht eintragen, weil wir dann nicht geöffnet haben oder es zu weit in der Zukunft liegt.",
+		"series_failed":   " Den Rest deiner Termine konnten wir nicht buchen: %[1]s",
+
+		"invalid_date":            "Bitte wähle ein Datum und eine Uhrzeit.",
+		"treatment_unavailable":   "Leider bieten wir diese Behandlung nicht mehr an, daher können wir diesen Termin nicht verschieben. Bitte kontaktiere uns.",
+		"reschedule_failed":       "Wir konnten deine Erinnerungen nicht verschieben. Bitte versuche es später erneut.",
+		"reschedule_save_failed":  "Wir haben deine neuen Erinnerungen geplant, konnten die neue Zeit deines Termins aber nicht speichern. Bitte kontaktiere uns, um deinen Termin zu bestätigen.",
+		"rescheduled":             "Dein Termin wurde auf %[1]s verschoben. Wir schicken dir deine Erinnerungen am %[2]s.",
+		"rescheduled_no_reminder": "Dein Termin wurde auf %[1]s verschoben. Für eine Erinnerung ist es zu spät, deshalb schicken wir dir keine.",
+	},
+}
+
+// translate looks up the message with id key in locale, and formats it with args.
+// Messages that haven't been translated into locale fall back to defaultLocale.
+func translate(locale, key string, args ...interface{}) string {
+	message, ok := catalog[locale][key]
+	if !ok {
+		message, ok = catalog[defaultLocale][key]
+	}
+	if !ok {
+		// A missing message is a bug, but showing its id is better than showing nothing.
+		message = key
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// formatDuration formats d in the locale lang, in whole hours and minutes, like "1 hour 30 minutes".
+// Seconds are dropped, and a duration of less than a minute is "0 minutes".
+func formatDuration(d time.Duration, lang string) string {
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	var parts []string
+	switch {
+	case hours == 1:
+		parts = append(parts, translate(lang, "one_hour"))
+	case hours > 1:
+		parts = append(parts, translate(lang, "hours", hours))
+	}
+	switch {
+	case minutes == 1:
+		parts = append(parts, translate(lang, "one_minute"))
+	case minutes > 1 || hours == 0:
+		parts = append(parts, translate(lang, "minutes", minutes))
+	}
+	return strings.Join(parts, " ")
+}
+
+// requestLocale picks the locale to answer r in: the "lang" form field if it names a locale we support,
+// otherwise the first supported language in the Accept-Language header, and defaultLocale if neither matches.
+func requestLocale(r *http.Request) string {
+	if lang := strings.ToLower(strings.TrimSpace(r.FormValue("lang"))); catalog[lang] != nil {
+		return lang
+	}
+	return headerLocale(r.Header.Get("Accept-Language"))
+}
+
+// headerLocale returns the first language in an Accept-Language header that we have a catalog for,
+// or defaultLocale if there isn't any.
+func headerLocale(header string) string {
+	// Browsers list languages in order of preference, so we don't need to look at the q values.
+	for _, lang := range strings.Split(header, ",") {
+		lang = strings.TrimSpace(strings.SplitN(lang, ";", 2)[0])
+		// We don't distinguish regional variants, so "nl-BE" is just "nl".
+		lang = strings.ToLower(strings.SplitN(lang, "-", 2)[0])
+		if catalog[lang] != nil {
+			return lang
+		}
+	}
+	return defaultLocale
+}
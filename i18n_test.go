@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		lang string
+		want string
+	}{
+		{30 * time.Minute, "en", "30 minutes"},
+		{90 * time.Minute, "en", "1 hour 30 minutes"},
+		{3 * time.Hour, "en", "3 hours"},
+		{24 * time.Hour, "en", "24 hours"},
+		{time.Hour + time.Minute, "en", "1 hour 1 minute"},
+		{90 * time.Minute, "nl", "1 uur 30 minuten"},
+		{3 * time.Hour, "de", "3 Stunden"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d, tt.lang); got != tt.want {
+			t.Errorf("formatDuration(%v, %q) = %q, want %q", tt.d, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestTooSoonMessage(t *testing.T) {
+	newTestApp(t)
+	tests := []struct {
+		reminderDiff time.Duration
+		want         string
+	}{
+		{30 * time.Minute, "Please book your appointment at least 30 minutes in advance."},
+		{90 * time.Minute, "Please book your appointment at least 1 hour 30 minutes in advance."},
+		{3 * time.Hour, "Please book your appointment at least 3 hours in advance."},
+		{24 * time.Hour, "Please book your appointment at least 24 hours in advance."},
+	}
+	for _, tt := range tests {
+		// A booking a minute too soon for its reminder.
+		bookingTime := testNow.Add(tt.reminderDiff - time.Minute)
+		terrs, _ := checkTime(cfg.Branches[0], bookingTime, 0, tt.reminderDiff, testNow)
+		var got string
+		for _, terr := range terrs {
+			if terr.Code == codeTooSoon {
+				got = timeErrorMessage(terr, "en")
+			}
+		}
+		if got != tt.want {
+			t.Errorf("with a %v reminder, got %q, want %q", tt.reminderDiff, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idempotencyWindow is how long we remember the result of a request with an idempotency key.
+// Someone who goes back to the booking form a day later and posts it again probably does want another booking.
+const idempotencyWindow = 24 * time.Hour
+
+// idempotencyKey returns the idempotency key of r: the Idempotency-Key header, or the idempotency_key form field
+// the booking form sends. It's empty if r has neither. Keys are hashed together with the path, so that they take up
+// the same room however long they are, and a key used on one endpoint doesn't replay a result from another.
+func idempotencyKey(r *http.Request) string {
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if key == "" {
+		key = strings.TrimSpace(r.FormValue("idempotency_key"))
+	}
+	return hashIdempotencyKey(r.URL.Path, key)
+}
+
+// hashIdempotencyKey returns key, as a client sent it to path, the way idempotencyCache keeps it, or "" if key is empty.
+func hashIdempotencyKey(path, key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(path + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newIdempotencyKey returns a new random idempotency key for the booking form.
+// If there's no randomness to be had, it returns an empty key, and the form just isn't protected.
+func newIdempotencyKey() string {
+	key, _ := newBookingID()
+	return key
+}
+
+// idempotentResult is what we replay when a request with the same idempotency key comes in again.
+type idempotentResult struct {
+	status   int
+	booking  booking
+	response bookingResponse
+}
+
+// idempotencyCache remembers the results of requests by idempotency key, for window after they finished,
+// so that a repeated request gets the original result instead of making a second booking.
+type idempotencyCache struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	// done is false while the first request with this key is still being processed.
+	done    bool
+	result  idempotentResult
+	expires time.Time
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{window: window, entries: make(map[string]*idempotencyEntry)}
+}
+
+// start claims key for a request at time now. If a request with key already finished,
+// it returns that request's result. If one is still being processed, busy is true.
+// Otherwise, the caller must call finish or abort once it's done.
+func (c *idempotencyCache) start(key string, now time.Time) (previous *idempotentResult, busy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep(now)
+	if e, ok := c.entries[key]; ok && !(e.done && now.After(e.expires)) {
+		if !e.done {
+			return nil, true
+		}
+		result := e.result
+		return &result, false
+	}
+	c.entries[key] = &idempotencyEntry{}
+	return nil, false
+}
+
+// finish records result for key at time now, so that repeated requests get it too.
+func (c *idempotencyCache) finish(key string, result idempotentResult, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &idempotencyEntry{done: true, result: result, expires: now.Add(c.window)}
+}
+
+// abort releases key if its request didn't finish, so that it can be tried again.
+func (c *idempotencyCache) abort(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok && !e.done {
+		delete(c.entries, key)
+	}
+}
+
+// sweep forgets results that have expired. It runs at most once per window, like memoryRateLimiter.sweep.
+func (c *idempotencyCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.window {
+		return
+	}
+	for key, e := range c.entries {
+		if e.done && now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.lastSweep = now
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxImportSize is the largest CSV file operators can upload to /admin/import, in bytes.
+const maxImportSize = 1 << 20
+
+// maxImportRows is how many appointments a single import can book. Each of them costs a lookup and its reminders.
+const maxImportRows = 1000
+
+// importSkipped is the status, in an import's results, of a row that's in the past. It isn't booked, because
+// there's nothing left to remind anyone of.
+const importSkipped = "skipped"
+
+// importColumns are the columns an import needs. It can also have these columns of the JSON API: staff, branch,
+// notes, email, country, channel, reminder_lead and language, and phones, as a comma separated list. Columns can come
+// in any order, and others are ignored.
+var importColumns = []string{"name", "treatment", "phone", "datetime"}
+
+// adminImportPage is the data for views/admin/import.gohtml.
+type adminImportPage struct {
+	Columns []string
+	Message string
+}
+
+// adminImport books the appointments in an uploaded CSV file, like from a paper appointment book, and schedules
+// their reminders. Operators post the file in "file", with a header row naming the columns, and "consent" to confirm
+// the customers agreed to get reminders. Each row goes through makeBooking like any other booking, except that
+// rows in the past are skipped. The response is the file again, with each row's status, booking id and error added.
+func (a *app) adminImport(w http.ResponseWriter, r *http.Request) {
+	page := adminImportPage{Columns: importColumns}
+	switch r.Method {
+	case "GET":
+		renderPageIn(w, http.StatusOK, adminLayout, "views/admin/import.gohtml", page)
+		return
+	case "POST":
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		page.Message = fmt.Sprintf("Please choose a CSV file of at most %d KB.", maxImportSize>>10)
+		renderPageIn(w, http.StatusBadRequest, adminLayout, "views/admin/import.gohtml", page)
+		return
+	}
+	defer file.Close()
+	if r.FormValue("consent") == "" {
+		page.Message = "Please confirm that these customers agreed to get reminders."
+		renderPageIn(w, http.StatusBadRequest, adminLayout, "views/admin/import.gohtml", page)
+		return
+	}
+
+	// Read the whole file before booking anything, so that a broken file doesn't leave half of it booked.
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err == nil && len(rows) < 2 {
+		err = fmt.Errorf("there's nothing to import: the first row has to name the columns, like %s", strings.Join(importColumns, ","))
+	}
+	if err == nil && len(rows)-1 > maxImportRows {
+		err = fmt.Errorf("it has %d appointments; please import at most %d at a time", len(rows)-1, maxImportRows)
+	}
+	var columns map[string]int
+	if err == nil {
+		columns, err = importHeader(rows[0])
+	}
+	if err != nil {
+		page.Message = "We couldn't import that file: " + err.Error() + "."
+		renderPageIn(w, http.StatusBadRequest, adminLayout, "views/admin/import.gohtml", page)
+		return
+	}
+
+	var booked, skipped, failed int
+	results := [][]string{append(rows[0][:len(rows[0]):len(rows[0])], "status", "booking_id", "error")}
+	for _, row := range rows[1:] {
+		status, id, message := a.importRow(r.Context(), columns, row)
+		switch status {
+		case importSkipped:
+			skipped++
+		case statusFailed:
+			failed++
+		default:
+			booked++
+		}
+		results = append(results, append(row[:len(row):len(row)], status, id, message))
+	}
+	slog.Info("Imported bookings", "booked", booked, "skipped", skipped, "failed", failed)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="import-results.csv"`)
+	if err := csv.NewWriter(w).WriteAll(results); err != nil {
+		slog.Error("Couldn't write import results", "err", err)
+	}
+}
+
+// importHeader returns the index of each column in header, by name, and checks that it has importColumns.
+func importHeader(header []string) (map[string]int, error) {
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheets like to start their CSV files with a byte order mark.
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := columns[name]; ok && name != "" {
+			return nil, fmt.Errorf("there's more than one %s column", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range importColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("it needs a %s column", name)
+		}
+	}
+	return columns, nil
+}
+
+// importRow books the appointment in row, and returns its status in the import's results, the booking's id,
+// and why it failed, if it did.
+func (a *app) importRow(ctx context.Context, columns map[string]int, row []string) (status, id, message string) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	b := booking{
+		Name:         field("name"),
+		Treatment:    field("treatment"),
+		Phone:        field("phone"),
+		Phones:       parsePhones(field("phones")),
+		Staff:        field("staff"),
+		Branch:       field("branch"),
+		Notes:        field("notes"),
+		Email:        field("email"),
+		Country:      field("country"),
+		Channel:      field("channel"),
+		ReminderLead: field("reminder_lead"),
+		Language:     field("language"),
+		Consent:      true,
+	}
+	branch, ok := findBranch(b.Branch)
+	if !ok {
+		return statusFailed, "", translate(defaultLocale, "invalid_branch")
+	}
+	bookingTime, err := parseImportTime(field("datetime"), branch.Timezone)
+	if err != nil {
+		return statusFailed, "", "Please enter the date and time like " + importTimeExample() + "."
+	}
+	if !bookingTime.After(a.now()) {
+		return importSkipped, "", ""
+	}
+	b.BookingTime = &bookingTime
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.APITimeout)
+	defer cancel()
+	b, _, berr := a.makeBooking(ctx, b, defaultLocale)
+	a.metrics.booking(berr, b.DryRun)
+	if berr != nil {
+		return statusFailed, "", berr.Message
+	}
+	if b.DryRun {
+		return statusDryRun, "", ""
+	}
+	return statusBooked, b.ID, ""
+}
+
+// importTimeExample returns how 2018-08-01 14:30 is written for parseImportTime, in the booking form's formats.
+func importTimeExample() string {
+	return time.Date(2018, 8, 1, 14, 30, 0, 0, time.UTC).Format(cfg.DateLayout + " " + cfg.TimeLayout)
+}
+
+// parseImportTime parses an import's datetime, like "2018-08-01 14:30", as a time in timezone, like parseBookingTime:
+// in the booking form's date and time formats, separated by a space.
+// It also takes times with a UTC offset, like "2018-08-01T14:30:00+02:00", as exported by other booking systems.
+func parseImportTime(value string, timezone *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	date, clock, ok := strings.Cut(strings.Replace(value, "T", " ", 1), " ")
+	if !ok {
+		return time.Time{}, fmt.Errorf("%q has no time", value)
+	}
+	return parseBookingTime(date, clock, timezone)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setupLogging sends everything we log, with slog or with the standard log package, to stderr as JSON lines.
+// Only messages at level or above are logged; level is a slog level name, like "debug" or "warn", and defaults to "info".
+func setupLogging(level string) error {
+	var minLevel slog.Level
+	if level != "" {
+		if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q: use debug, info, warn or error", level)
+		}
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: minLevel})))
+	return nil
+}
+
+// newErrorID returns a random id to log with an error, and show to the customer instead of the error itself.
+// When they contact us about it, we can find the error in our logs by its id. Errors in a request use the request's
+// id instead; see errorID.
+func newErrorID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		// Any id is better than none, and the time will do to narrow down the logs.
+		return strconv.FormatInt(time.Now().Unix(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// maskedDigits is how many digits at the end of a phone number maskPhone leaves visible.
+const maskedDigits = 2
+
+// maskPhone hides the digits of phone, so that we can show or log which number we mean without giving it away.
+// Numbers in international format, starting with + or 00, keep their country code, like +31*******78;
+// other numbers just keep their last 2 digits, like ********78.
+func maskPhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	digits := digitsOnly(phone)
+	prefix := ""
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		prefix = "+"
+	case strings.HasPrefix(digits, "00"):
+		prefix, digits = "00", digits[2:]
+	}
+	if prefix != "" {
+		codeLength := callingCodeLength(digits)
+		// Don't give away a short number just because it has a country code.
+		if len(digits)-codeLength > maskedDigits {
+			prefix, digits = prefix+digits[:codeLength], digits[codeLength:]
+		}
+	}
+	if len(digits) <= maskedDigits {
+		return prefix + strings.Repeat("*", len(digits))
+	}
+	return prefix + strings.Repeat("*", len(digits)-maskedDigits) + digits[len(digits)-maskedDigits:]
+}
+
+// callingCodeLength returns how many of the leading digits of an international phone number are its country calling code.
+// Calling codes are prefix-free, so this only takes knowing which are shorter than 3 digits.
+func callingCodeLength(digits string) int {
+	switch {
+	case digits == "":
+		return 0
+	case digits[0] == '1' || digits[0] == '7':
+		return 1
+	case len(digits) >= 2 && twoDigitCallingCodes[digits[:2]]:
+		return 2
+	case len(digits) >= 3:
+		return 3
+	default:
+		return len(digits)
+	}
+}
+
+// twoDigitCallingCodes are the ITU-T E.164 country calling codes with 2 digits. There are two with 1 digit,
+// 1 (North America) and 7 (Russia and Kazakhstan); all others have 3.
+var twoDigitCallingCodes = makeSet(strings.Fields(`
+	20 27 30 31 32 33 34 36 39 40 41 43 44 45 46 47 48 49 51 52 53 54 55 56 57 58
+	60 61 62 63 64 65 66 81 82 84 86 90 91 92 93 94 95 98
+`))
+
+// phoneNumbers matches anything in a text that looks like a phone number in international format, as MessageBird writes them.
+var phoneNumbers = regexp.MustCompile(`\+?\b\d{8,15}\b`)
+
+// maskPhones masks everything in text that looks like a phone number, like an error or a request from MessageBird,
+// so that it can be logged or shown.
+func maskPhones(text string) string {
+	return phoneNumbers.ReplaceAllStringFunc(text, maskPhone)
+}
+
+// maskedLogWriter logs each line written to it with slog, with phone numbers masked.
+// It's for libraries that log with the standard log package, like the MessageBird client, and don't know what they're logging.
+type maskedLogWriter struct {
+	source string
+}
+
+func (w maskedLogWriter) Write(p []byte) (int, error) {
+	slog.Info(w.source, "log", maskPhones(strings.TrimSpace(string(p))))
+	return len(p), nil
+}
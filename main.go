@@ -1,202 +1,2497 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	texttemplate "text/template"
 	"time"
+	// Embed the IANA Time Zone database, so that TZ works on servers without one, like minimal containers.
+	_ "time/tzdata"
+	"unicode/utf8"
 
 	"github.com/messagebird/go-rest-api"
 	"github.com/messagebird/go-rest-api/lookup"
 	"github.com/messagebird/go-rest-api/sms"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
 )
 
 // Global, because we need to share this with the handler functions
 var (
-	client *messagebird.Client
+	cfg config
+	loc *time.Location
+
+	// templates holds every view, parsed together with the default layout at startup.
+	// If reloadTemplates is set, views are parsed again on every request instead, so that you can edit them while the application runs.
+	templates       map[string]*template.Template
+	reloadTemplates bool
+)
+
+// views lists every view template, so that we can parse them all at startup.
+var views = []string{
+	"views/booking.gohtml",
+	"views/confirm.gohtml",
+	"views/cancel.gohtml",
+	"views/reschedule.gohtml",
+	"views/status.gohtml",
+	"views/admin/bookings.gohtml",
+	"views/admin/audit.gohtml",
+	"views/admin/import.gohtml",
+	"views/admin/balance.gohtml",
+}
+
+// Layouts that views can be rendered in. Each defines a template named after its file, like "default".
+const (
+	defaultLayout = "views/layouts/default.gohtml"
+	adminLayout   = "views/layouts/admin.gohtml"
+)
+
+// layouts lists every layout, which are parsed along with each view, so that any view can be rendered in any of them.
+var layouts = []string{defaultLayout, adminLayout}
+
+// config holds the settings operators can change without touching the booking logic.
+type config struct {
+	// Branches lists the salon's locations, each with its own timezone, opening hours and SMS sender.
+	// There's always at least one, and the first is where bookings go if customers don't choose.
+	Branches []Branch
+	// Treatments lists the treatments customers can book.
+	Treatments []Treatment
+	// Staff lists the names of our stylists, who each have their own calendar.
+	// If empty, customers don't choose a stylist, and bookings may overlap, up to their branch's Chairs.
+	Staff []string
+	// SigningKey verifies that webhook requests come from MessageBird. If empty, requests aren't verified.
+	SigningKey string
+	// CancelSecret signs the cancellation links we send customers. If empty, bookings are cancelled by their id.
+	CancelSecret []byte
+	// PublicURL is where customers reach the application, like "https://book.example.com", for links in messages.
+	PublicURL string
+	// ListenAddr is the address we serve the application on, like ":8080" or "127.0.0.1:80".
+	ListenAddr string
+	// TLSDomains are the domains we get certificates for from Let's Encrypt, to serve HTTPS ourselves.
+	// TLSCertFile and TLSKeyFile are a certificate and its key to serve HTTPS with instead. If all are empty,
+	// we serve plain HTTP, for local development or behind a proxy that takes care of HTTPS. See tlsEnabled.
+	TLSDomains  []string
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSCacheDir is where we keep the certificates for TLSDomains, and TLSEmail is where Let's Encrypt writes
+	// to about them, like when one is about to expire. TLSEmail is optional.
+	TLSCacheDir string
+	TLSEmail    string
+	// RedirectAddr is the address we redirect plain HTTP to HTTPS from, with TLS.
+	RedirectAddr string
+	// GRPCAddr is the address we serve the gRPC service of booking.proto on, like ":9090". If empty, there's no gRPC.
+	GRPCAddr string
+	// WhatsAppChannelID is the MessageBird channel we send WhatsApp reminders on. If empty, WhatsApp reminders are disabled.
+	WhatsAppChannelID string
+	// VoiceOriginator is the phone number we call voice reminders from. If empty, voice reminders are disabled.
+	VoiceOriginator string
+	// CountryCode is the ISO 3166-1 alpha-2 country that phone numbers without a country code are assumed to be in.
+	CountryCode string
+	// PhoneTypes are the kinds of phone numbers we take bookings for, as MessageBird's lookup reports them.
+	// If empty, we take any kind.
+	PhoneTypes []string
+	// APITimeout is how long a request may spend waiting for MessageBird before we give up on it.
+	APITimeout time.Duration
+	// AdminPassword protects the admin pages. If empty, the admin pages are disabled.
+	AdminPassword string
+	// BookingHorizon is how far in advance customers can book. If 0, there's no limit.
+	BookingHorizon time.Duration
+	// SlotGranularity is how far apart appointments can start, counting from opening time. If 0, they can start at any minute.
+	SlotGranularity time.Duration
+	// LateBookingGrace is how much less than their reminder lead ahead customers can still book, for walk-ins and
+	// last-minute bookings. Those bookings don't get the reminder, which it's too late for. If 0, every booking has
+	// to be at least its reminder lead ahead. See minNotice.
+	LateBookingGrace time.Duration
+	// MinAdvance is how far ahead every booking has to be, to give the salon notice, whatever its reminder lead.
+	// If 0, the reminder lead is all that counts.
+	MinAdvance time.Duration
+	// AppointmentBuffer is how long a stylist is kept free after each appointment, to clean up before the next client.
+	AppointmentBuffer time.Duration
+	// DateLayout and TimeLayout are how customers enter the date and time of a booking, as layouts for time.Parse.
+	DateLayout string
+	TimeLayout string
+	// SalonName is the name of the salon, as used in messages to customers.
+	SalonName string
+	// Reminder is the template of our reminders, in the salon's own language.
+	Reminder *texttemplate.Template
+	// Reminders holds the template of reminders in each locale that has its own, by locale code. Reminders in the
+	// other locales use Reminder. See reminderTemplate.
+	Reminders map[string]*texttemplate.Template
+	// Confirmation is the template of the SMS we send right after a booking to confirm it. If nil, we don't send one.
+	Confirmation *texttemplate.Template
+	// DryRun makes every booking a dry run: see booking.DryRun.
+	DryRun bool
+	// LocalDispatch makes us send SMS reminders ourselves when they're due, with runDispatcher, instead of
+	// having MessageBird schedule them.
+	LocalDispatch bool
+	// LookupFallback makes us take phone numbers in international format without checking them when MessageBird
+	// can't look them up, instead of turning the booking away. See lookupPhone.
+	LookupFallback bool
+	// SMSPrice is what a single SMS segment costs, in whatever currency the operator pays in, to estimate what reminders cost.
+	// If 0, we don't estimate costs.
+	SMSPrice float64
+	// SMSDailyLimit is the most SMS segments we send or schedule in a day, counting from midnight in our timezone.
+	// Once we have, we stop taking bookings until the next day. If 0, there's no limit.
+	SMSDailyLimit int
+	// LowBalance is the MessageBird balance, in the credits or euros it's counted in, below which /admin/balance warns
+	// operators to top up. If 0, it never warns.
+	LowBalance float64
+}
+
+// Reminder lead times. Customers can choose how far in advance their reminder is sent,
+// within these bounds. When they don't choose, we use defaultReminderDiff.
+const (
+	defaultReminderDiff = 3 * time.Hour
+	minReminderDiff     = 30 * time.Minute
+	maxReminderDiff     = 48 * time.Hour
+)
+
+// defaultOriginator is the sender we show when MESSAGEBIRD_ORIGINATOR is not set.
+const defaultOriginator = "BeautyBird"
+
+// defaultListenAddr is the address we serve the application on when LISTEN_ADDR is not set: port 8080 on every interface.
+const defaultListenAddr = ":8080"
+
+// defaultCountryCode is the country we look up phone numbers in when MESSAGEBIRD_COUNTRY_CODE is not set.
+const defaultCountryCode = "NL"
+
+// phoneTypes are the kinds of phone numbers MessageBird's lookup can report.
+var phoneTypes = []string{
+	"fixed line", "mobile", "fixed line or mobile", "toll free", "premium rate", "shared cost", "voip",
+	"personal number", "pager", "universal access number", "voice mail", "unknown",
+}
+
+// defaultPhoneTypes are the phone numbers we take bookings for when PHONE_TYPES is not set: those that can get an SMS.
+var defaultPhoneTypes = []string{"mobile", "fixed line or mobile"}
+
+// shutdownTimeout is how long we wait for in-flight requests to finish when shutting down.
+const shutdownTimeout = 10 * time.Second
+
+// Each phone number can make defaultRateLimit bookings per defaultRateLimitWindow,
+// unless BOOKING_RATE_LIMIT and BOOKING_RATE_LIMIT_WINDOW say otherwise.
+const (
+	defaultRateLimit       = 5
+	defaultRateLimitWindow = time.Hour
+)
+
+// defaultBookingHorizonDays is how many days in advance customers can book when BOOKING_HORIZON_DAYS is not set.
+const defaultBookingHorizonDays = 90
+
+// defaultSlotMinutes is how far apart appointments can start when SLOT_MINUTES is not set.
+const defaultSlotMinutes = 30
+
+// isoDateLayout and isoTimeLayout are the date and time formats of the booking form when DATE_INPUT_FORMAT and
+// TIME_INPUT_FORMAT aren't set, like "2018-08-01" and "14:30". They're the formats browsers' own pickers send.
+const (
+	isoDateLayout = "2006-01-02"
+	isoTimeLayout = "15:04"
+)
+
+// inputLayoutSamples are the times we try DATE_INPUT_FORMAT and TIME_INPUT_FORMAT with. Between them, they tell days
+// from months, and mornings from evenings.
+var inputLayoutSamples = []time.Time{
+	time.Date(2018, 12, 31, 21, 45, 0, 0, time.UTC),
+	time.Date(2019, 1, 2, 9, 5, 0, 0, time.UTC),
+}
+
+// defaultAPITimeout is how long a request waits for MessageBird when MESSAGEBIRD_TIMEOUT is not set.
+const defaultAPITimeout = 10 * time.Second
+
+// maxNameLength is the longest customer name we accept, in characters.
+const maxNameLength = 100
+
+// maxNotesLength is the longest note we accept with a booking, in characters.
+const maxNotesLength = 200
+
+// earlyReminderDiffs are extra reminders we send on top of the one the customer chose,
+// because a single reminder is easy to miss.
+var earlyReminderDiffs = []time.Duration{24 * time.Hour}
+
+// Data structures
+type booking struct {
+	ID string `json:"id"`
+	// Reference is what the customer quotes to cancel or reschedule, like "7KQ2-M9XD-4HRT": see newBookingReference.
+	// Bookings from before we gave them out have none, and go by their id.
+	Reference string `json:"reference,omitempty"`
+	Name      string `json:"name"`
+	Treatment string `json:"treatment"`
+	Phone     string `json:"phone"`
+	// ContactPhone is where we send reminders and other messages. It's Phone, unless someone booked on someone else's
+	// behalf, like a parent for their child, and wants the reminders themselves.
+	ContactPhone string `json:"contact_phone,omitempty"`
+	// Phones are more numbers that get the SMS reminders, for group appointments like a bridal party's. Once they've
+	// been looked up, they're the numbers MessageBird gave us, without ContactPhone or any that didn't check out.
+	Phones []string `json:"phones,omitempty"`
+	// RejectedPhones are the numbers makeBooking left out of Phones, so that we can tell the customer. They aren't saved.
+	RejectedPhones []string `json:"-"`
+	// SuggestedTime is the earliest time makeBooking would take instead of BookingTime, if it turned that down.
+	// It isn't saved either.
+	SuggestedTime *time.Time `json:"-"`
+	// Country is the ISO country code Phone is in, if it doesn't start with a country code. It defaults to cfg.CountryCode.
+	// Once MessageBird has looked Phone up, it's the country MessageBird says the number is in.
+	Country string `json:"country,omitempty"`
+	// Email is where we send email reminders, on top of the SMS or WhatsApp ones. It's optional.
+	Email        string     `json:"email,omitempty"`
+	BookingTime  *time.Time `json:"booking_time"`
+	ReminderLead string     `json:"reminder_lead,omitempty"`
+	// Channel is how reminders are sent: channelSMS, channelWhatsApp or channelVoice.
+	Channel string `json:"channel,omitempty"`
+	// Staff is the stylist the customer booked, one of cfg.Staff. It's empty if we have no staff configured.
+	Staff string `json:"staff,omitempty"`
+	// Branch is the name of the branch the booking is at, one of cfg.Branches. See branchFor.
+	Branch string `json:"branch,omitempty"`
+	// Notes is anything the customer wants us to know, like "bringing my own color". It's optional.
+	Notes string `json:"notes,omitempty"`
+	// Language is the locale the customer's reminders are in, one of locales. It's the language they booked in,
+	// unless they chose another. Bookings from before we asked have none, and get reminders in the default one.
+	Language string `json:"language,omitempty"`
+	// Consent is set when the customer agrees to get our reminders, which they have to for us to book.
+	Consent bool `json:"consent"`
+	// ConsentedAt is when they agreed: when we booked it.
+	ConsentedAt *time.Time `json:"consented_at,omitempty"`
+	// LookedUp is set once makeBooking has looked up Phone, ContactPhone and Phones, and they're the numbers MessageBird
+	// gave us, so that it doesn't look them up again. It isn't saved, and customers can't set it: only a confirmation
+	// carries it, under its signature.
+	LookedUp bool `json:"-"`
+	// DryRun checks the booking like any other, including the phone number lookup, but doesn't send or schedule
+	// any messages, and doesn't save it. It's for testing an integration without spending SMS credits.
+	DryRun bool `json:"dry_run,omitempty"`
+	// MinDate and MaxDate are the first and last dates the date picker allows, as set by bookableDates.
+	MinDate string `json:"-"`
+	MaxDate string `json:"-"`
+	// MessageIDs are the MessageBird ids of the reminders scheduled for this booking.
+	MessageIDs []string `json:"-"`
+	// StaleMessageIDs are reminders a reschedule replaced, but couldn't cancel, so that they may still go out with
+	// the old time. reconcileReminders keeps trying to cancel them.
+	StaleMessageIDs []string `json:"-"`
+	// ReminderStatuses holds the delivery status of each reminder, by message id:
+	// one of reminderPending, reminderDelivered or reminderFailed.
+	ReminderStatuses map[string]string `json:"reminder_statuses,omitempty"`
+	Cancelled        bool              `json:"cancelled"`
+	// Confirmed is set when the customer replies to confirm their appointment.
+	Confirmed bool `json:"confirmed"`
+	// SeriesID links recurring appointments that were booked together, so they can be cancelled together.
+	// It's empty for a single appointment.
+	SeriesID string `json:"series_id,omitempty"`
+}
+
+// app holds the dependencies of our handlers.
+type app struct {
+	// client is how we talk to MessageBird.
+	client messagingClient
+	// store keeps our bookings.
+	store Store
+	// timers keeps track of reminders MessageBird can't schedule for us, until it's time to send them.
+	timers *timerScheduler
+	// mailer sends email reminders. If nil, email reminders are disabled.
+	mailer mailer
+	// limiter limits how many bookings each phone number can make. If nil, there's no limit.
+	limiter RateLimiter
+	// balance keeps the MessageBird balance for /admin/balance. If nil, there's no balance page.
+	balance *balanceCache
+	// smsBudget stops bookings once we've sent cfg.SMSDailyLimit SMS segments in a day. If nil, there's no limit.
+	smsBudget *smsBudget
+	// metrics counts bookings and MessageBird calls for /metrics. If nil, nothing is counted.
+	metrics *metrics
+	// idempotency remembers booking requests by idempotency key, so that posting the same one twice books it once.
+	// If nil, every request makes a new booking.
+	idempotency *idempotencyCache
+	// confirmationKey signs the booking form's confirmations. If nil, the form books right away, without a confirmation step.
+	confirmationKey []byte
+	// audit records every SMS we send, for /admin/audit.
+	audit auditLog
+	// optOuts keeps the numbers that texted us STOP. If nil, customers can't opt out.
+	optOuts OptOuts
+	// waitlist keeps customers waiting for a slot that was taken, to offer it to them if it frees up.
+	// If nil, customers can't join a waitlist.
+	waitlist Waitlist
+	// reschedules lets one reschedule at a time change a booking's reminders.
+	reschedules *bookingLocks
+	// now returns the current time. It's time.Now, except in tests that need to freeze the clock.
+	now func() time.Time
+	// ready is 1 once startup has finished and we can take bookings, and 0 before that and while shutting down.
+	// Use sync/atomic to access it; it's read by /readyz while main is still running.
+	ready int32
+}
+
+type bookingContainer struct {
+	Booking booking
+	Message string
+	// Field is the name of the form field that Message is about, if any, so that the template can highlight it.
+	Field string
+	// Errors lists what's wrong with each field, when it's more than one, and Message is just the first.
+	Errors []fieldError
+	// Lang is the locale the page is shown in, so that the language picker can keep it selected.
+	Lang string
+	// IdempotencyKey is sent along with the booking form, so that posting it twice doesn't book twice.
+	IdempotencyKey string
+	// Waitlist is set when the slot the customer asked for is taken: it's the signed booking that the
+	// "join the waitlist" button posts to /waitlist.
+	Waitlist string
+	// CancelToken is the signed cancellation link's token, which the cancel form posts back.
+	CancelToken string
+}
+
+// Invalid reports whether field is one of the form fields the page's errors are about, so that the template can highlight it.
+func (c bookingContainer) Invalid(field string) bool {
+	if field == c.Field {
+		return field != ""
+	}
+	for _, e := range c.Errors {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Treatment is a treatment customers can book, and how long it takes.
+type Treatment struct {
+	Name     string
+	Duration time.Duration
+	// ReminderLead is how long before the appointment its reminder goes out, unless the customer chooses.
+	// If 0, it's defaultReminderDiff.
+	ReminderLead time.Duration
+}
+
+// findTreatment returns the treatment in cfg.Treatments called name, and false if there's no such treatment.
+func findTreatment(name string) (Treatment, bool) {
+	for _, treatment := range cfg.Treatments {
+		if treatment.Name == name {
+			return treatment, true
+		}
+	}
+	return Treatment{}, false
+}
+
+// BusinessHours holds the opening hours for each day of the week.
+// Days without an entry in Days are days we're closed.
+type BusinessHours struct {
+	Days map[time.Weekday]OpeningHours
+}
+
+// OpeningHours is the time we open and close on a single day.
+type OpeningHours struct {
+	Open  ClockTime
+	Close ClockTime
+}
+
+// ClockTime is a time of day, independent of the date.
+type ClockTime struct {
+	Hour   int
+	Minute int
+}
+
+// On returns the opening and closing times on the date of day, in the location of day.
+// If we're closed on that day, ok is false.
+func (bh BusinessHours) On(day time.Time) (openingTime, closingTime time.Time, ok bool) {
+	hours, ok := bh.Days[day.Weekday()]
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return hours.Open.On(day), hours.Close.On(day), true
+}
+
+// Validate checks that every day opens before it closes, at a valid time of day.
+func (bh BusinessHours) Validate() error {
+	for day, hours := range bh.Days {
+		if !hours.Open.valid() || !hours.Close.valid() {
+			return fmt.Errorf("invalid opening hours on %v", day)
+		}
+		if !hours.Open.before(hours.Close) {
+			return fmt.Errorf("opening time must be before closing time on %v", day)
+		}
+	}
+	return nil
+}
+
+// On returns the time of day ct on the date of day, in the location of day.
+func (ct ClockTime) On(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), ct.Hour, ct.Minute, 0, 0, day.Location())
+}
+
+func (ct ClockTime) valid() bool {
+	return ct.Hour >= 0 && ct.Hour < 24 && ct.Minute >= 0 && ct.Minute < 60
+}
+
+func (ct ClockTime) before(other ClockTime) bool {
+	return ct.Hour < other.Hour || (ct.Hour == other.Hour && ct.Minute < other.Minute)
+}
+
+func main() {
+	// Log JSON lines, so that our logs are easy to search.
+	if err := setupLogging(strings.TrimSpace(os.Getenv("LOG_LEVEL"))); err != nil {
+		log.Fatal(err)
+	}
+
+	// Treatments, staff, LOOKUP_FALLBACK and MESSAGEBIRD_TIMEOUT, which limits how long we wait for MessageBird while
+	// handling a request.
+	if err := loadConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Read the API key from the environment instead of hardcoding it.
+	// Trim whitespace so that a trailing newline from a .env file doesn't break authentication.
+	// If MESSAGEBIRD_TEST_KEY is set, we use it instead and log every API request, which is handy for local development.
+	// If MESSAGEBIRD_OFFLINE is set, we don't call MessageBird at all, and only log what we would have sent.
+	a := app{now: time.Now, timers: newTimerScheduler(), reschedules: newBookingLocks()}
+	apiKey := strings.TrimSpace(os.Getenv("MESSAGEBIRD_API_KEY"))
+	testKey := strings.TrimSpace(os.Getenv("MESSAGEBIRD_TEST_KEY"))
+	switch {
+	case envBool("MESSAGEBIRD_OFFLINE"):
+		a.client = &fakeClient{}
+		slog.Warn("MESSAGEBIRD_OFFLINE set; MessageBird is not called and no messages will be sent.")
+	case testKey != "":
+		client := newMBClient(testKey, cfg.APITimeout)
+		client.client.DebugLog = log.New(maskedLogWriter{source: "MessageBird API"}, "", 0)
+		a.client = client
+		slog.Warn("MESSAGEBIRD_TEST_KEY set; using test key. Requests are logged, and no real messages will be sent.")
+	case apiKey != "":
+		a.client = newMBClient(apiKey, cfg.APITimeout)
+	default:
+		log.Fatal("MESSAGEBIRD_API_KEY is not set. Get your API key from https://dashboard.messagebird.com/en/developers/access and run the application with MESSAGEBIRD_API_KEY=<your-api-key>.")
+	}
+	// If METRICS is set, we count bookings and time MessageBird calls, for Prometheus to scrape from /metrics.
+	if envBool("METRICS") {
+		a.metrics = newMetrics()
+		a.client = instrumentedClient{client: a.client, metrics: a.metrics}
+	}
+	// Record every SMS we send. Set AUDIT_LOG_PATH to keep the records in a file, which is rotated once it's grown
+	// to AUDIT_LOG_MAX_SIZE bytes; otherwise, only the latest ones are kept in memory.
+	if auditPath := strings.TrimSpace(os.Getenv("AUDIT_LOG_PATH")); auditPath != "" {
+		maxSize := int64(defaultAuditLogSize)
+		if size := strings.TrimSpace(os.Getenv("AUDIT_LOG_MAX_SIZE")); size != "" {
+			var err error
+			if maxSize, err = strconv.ParseInt(size, 10, 64); err != nil || maxSize <= 0 {
+				log.Fatalf("Invalid AUDIT_LOG_MAX_SIZE %q: use a number of bytes, like 10485760.", size)
+			}
+		}
+		audit, err := newFileAuditLog(auditPath, maxSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+		a.audit = audit
+	} else {
+		a.audit = newMemoryAuditLog(defaultAuditRecords)
+	}
+	a.client = auditedClient{client: a.client, log: a.audit, now: a.now}
+
+	// Set locale. Bookings are made in the timezone of their branch. With a single branch, that defaults to Amsterdam.
+	// Set TZ to any name from the IANA Time Zone database, such as "Europe/Berlin", to change it.
+	// We load it once here, so that a bad zone name stops the application right away instead of breaking every booking.
+	var err error
+	loc, err = loadTimezone(os.Getenv("TZ"))
+	if err != nil {
+		log.Fatalf("Invalid TZ %q: %v", os.Getenv("TZ"), err)
+	}
+	slog.Info("Taking bookings", "timezone", loc.String())
+
+	// Opening hours. Change these to match your salon; days left out of the map are closed.
+	everyDay := OpeningHours{Open: ClockTime{9, 0}, Close: ClockTime{18, 0}}
+	businessHours := BusinessHours{
+		Days: map[time.Weekday]OpeningHours{
+			time.Monday:    everyDay,
+			time.Tuesday:   everyDay,
+			time.Wednesday: everyDay,
+			time.Thursday:  everyDay,
+			time.Friday:    everyDay,
+			time.Saturday:  everyDay,
+			time.Sunday:    everyDay,
+		},
+	}
+	// The sender shown on our reminders. This has to be a phone number, or at most 11 letters and digits.
+	originator := strings.TrimSpace(os.Getenv("MESSAGEBIRD_ORIGINATOR"))
+	if originator == "" {
+		originator = defaultOriginator
+		slog.Warn("MESSAGEBIRD_ORIGINATOR not set; using the default originator.", "originator", originator)
+	}
+	if !validOriginator(originator) {
+		log.Fatalf("Invalid MESSAGEBIRD_ORIGINATOR %q: use a phone number, or at most 11 letters and digits.", originator)
+	}
+
+	// Branches of the salon. With a single branch, customers don't choose one, and it doesn't need a name.
+	// To take bookings at more branches, give each of them a name, its own timezone, opening hours and originator, like:
+	//
+	//	berlin, _ := time.LoadLocation("Europe/Berlin")
+	//	cfg.Branches = []Branch{
+	//		{Name: "Amsterdam", Timezone: loc, BusinessHours: businessHours, Originator: originator},
+	//		{Name: "Berlin", Timezone: berlin, BusinessHours: berlinHours, Originator: "BeautyBirdDE", MaxBookingsPerDay: 20},
+	//	}
+	//
+	// The salon's address is for the calendar events customers can download. Set MAX_BOOKINGS_PER_DAY to cap how many
+	// appointments it takes on a day, and CHAIRS to cap how many it takes at the same time.
+	maxBookingsPerDay := 0
+	if limit := strings.TrimSpace(os.Getenv("MAX_BOOKINGS_PER_DAY")); limit != "" {
+		if maxBookingsPerDay, err = strconv.Atoi(limit); err != nil || maxBookingsPerDay < 0 {
+			log.Fatalf("Invalid MAX_BOOKINGS_PER_DAY %q: use a number of bookings, or 0 for no cap.", limit)
+		}
+	}
+	chairs := 0
+	if limit := strings.TrimSpace(os.Getenv("CHAIRS")); limit != "" {
+		if chairs, err = strconv.Atoi(limit); err != nil || chairs < 0 {
+			log.Fatalf("Invalid CHAIRS %q: use how many appointments the salon takes at the same time, or 0 for no limit.", limit)
+		}
+	}
+	cfg.Branches = []Branch{
+		{Timezone: loc, BusinessHours: businessHours, Originator: originator, Address: strings.TrimSpace(os.Getenv("SALON_LOCATION")), MaxBookingsPerDay: maxBookingsPerDay, Chairs: chairs},
+	}
+	if err := validateBranches(cfg.Branches); err != nil {
+		log.Fatal(err)
+	}
+
+	// Phone numbers entered without a country code, like 0612345678, are looked up in this country.
+	cfg.CountryCode = defaultCountryCode
+	if countryCode := os.Getenv("MESSAGEBIRD_COUNTRY_CODE"); countryCode != "" {
+		var ok bool
+		if cfg.CountryCode, ok = parseCountryCode(countryCode); !ok {
+			log.Fatalf("Invalid MESSAGEBIRD_COUNTRY_CODE %q: use a two-letter ISO country code, like NL.", countryCode)
+		}
+	}
+
+	// An SMS to a landline never arrives, so by default we only take mobile numbers.
+	cfg.PhoneTypes = defaultPhoneTypes
+	if types := os.Getenv("PHONE_TYPES"); strings.TrimSpace(types) != "" {
+		cfg.PhoneTypes = nil
+		for _, t := range strings.Split(types, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if !slices.Contains(phoneTypes, t) {
+				log.Fatalf("Invalid PHONE_TYPES %q: use a comma-separated list of %s.", types, strings.Join(phoneTypes, ", "))
+			}
+			cfg.PhoneTypes = append(cfg.PhoneTypes, t)
+		}
+	}
+
+	// Operators log in to the admin pages with this password.
+	cfg.AdminPassword = os.Getenv("ADMIN_PASSWORD")
+
+	// Webhooks are only verified if you've set a signing key. Find yours in the MessageBird Dashboard, under Developers.
+	cfg.SigningKey = strings.TrimSpace(os.Getenv("MESSAGEBIRD_SIGNING_KEY"))
+	if cfg.SigningKey == "" {
+		slog.Warn("MESSAGEBIRD_SIGNING_KEY not set; webhook requests will not be verified.")
+	}
+
+	// To serve HTTPS without a proxy, set TLS_DOMAINS to the domains to get certificates for from Let's Encrypt,
+	// like book.example.com, or TLS_CERT_FILE and TLS_KEY_FILE to a certificate and key of your own.
+	for _, domain := range strings.Split(os.Getenv("TLS_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			cfg.TLSDomains = append(cfg.TLSDomains, domain)
+		}
+	}
+	cfg.TLSCertFile = strings.TrimSpace(os.Getenv("TLS_CERT_FILE"))
+	cfg.TLSKeyFile = strings.TrimSpace(os.Getenv("TLS_KEY_FILE"))
+	switch {
+	case (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == ""):
+		log.Fatal("Set both TLS_CERT_FILE and TLS_KEY_FILE, or neither.")
+	case cfg.TLSCertFile != "" && len(cfg.TLSDomains) > 0:
+		log.Fatal("Set TLS_DOMAINS to get certificates from Let's Encrypt, or TLS_CERT_FILE and TLS_KEY_FILE to use your own, not both.")
+	}
+	cfg.TLSCacheDir = strings.TrimSpace(os.Getenv("TLS_CACHE_DIR"))
+	if cfg.TLSCacheDir == "" {
+		cfg.TLSCacheDir = defaultCertCacheDir
+	}
+	cfg.TLSEmail = strings.TrimSpace(os.Getenv("TLS_EMAIL"))
+
+	// Where to serve. In a container, set LISTEN_ADDR to the port it maps; to only take requests from a proxy on the
+	// same host, bind to the loopback interface, like LISTEN_ADDR=127.0.0.1:8080. With TLS, we serve HTTPS on
+	// port 443, and redirect plain HTTP from port 80, or HTTP_REDIRECT_ADDR.
+	cfg.ListenAddr = defaultListenAddr
+	if tlsEnabled() {
+		cfg.ListenAddr = defaultTLSListenAddr
+		cfg.RedirectAddr = defaultRedirectAddr
+		if redirectAddr := strings.TrimSpace(os.Getenv("HTTP_REDIRECT_ADDR")); redirectAddr != "" {
+			if !validListenAddr(redirectAddr) {
+				log.Fatalf("Invalid HTTP_REDIRECT_ADDR %q: use a host and port, like 127.0.0.1:80, or just a port, like :80.", redirectAddr)
+			}
+			cfg.RedirectAddr = redirectAddr
+		}
+	}
+	if listenAddr := strings.TrimSpace(os.Getenv("LISTEN_ADDR")); listenAddr != "" {
+		if !validListenAddr(listenAddr) {
+			log.Fatalf("Invalid LISTEN_ADDR %q: use a host and port, like 127.0.0.1:8080, or just a port, like :8080.", listenAddr)
+		}
+		cfg.ListenAddr = listenAddr
+	}
+	// Our own services can book over gRPC too. Like the JSON API, it takes bookings from anyone who can reach it, so
+	// only serve it where just they can, like GRPC_ADDR=10.0.0.5:9090 on the internal network.
+	if grpcAddr := strings.TrimSpace(os.Getenv("GRPC_ADDR")); grpcAddr != "" {
+		if !validListenAddr(grpcAddr) {
+			log.Fatalf("Invalid GRPC_ADDR %q: use a host and port, like 127.0.0.1:9090, or just a port, like :9090.", grpcAddr)
+		}
+		cfg.GRPCAddr = grpcAddr
+	}
+
+	// With a secret to sign them, messages carry a link that cancels the booking, and /cancel only takes those links.
+	// Keep it the same across restarts, or the links in messages we've already sent stop working.
+	cfg.CancelSecret = []byte(strings.TrimSpace(os.Getenv("CANCEL_LINK_SECRET")))
+	cfg.PublicURL = strings.TrimRight(strings.TrimSpace(os.Getenv("PUBLIC_URL")), "/")
+	if cfg.PublicURL != "" {
+		if u, err := url.Parse(cfg.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("Invalid PUBLIC_URL %q: use an http or https URL, like https://book.example.com.", cfg.PublicURL)
+		}
+	}
+	if len(cfg.CancelSecret) > 0 && cfg.PublicURL == "" {
+		slog.Warn("CANCEL_LINK_SECRET set without PUBLIC_URL; messages will not include cancellation links.")
+	}
+
+	// WhatsApp reminders need a WhatsApp channel. Find its id in the MessageBird Dashboard, under Channels.
+	cfg.WhatsAppChannelID = strings.TrimSpace(os.Getenv("MESSAGEBIRD_WHATSAPP_CHANNEL_ID"))
+
+	// Voice reminders are calls, which can only come from a phone number: one of your MessageBird numbers.
+	if cfg.VoiceOriginator = strings.TrimSpace(os.Getenv("MESSAGEBIRD_VOICE_ORIGINATOR")); cfg.VoiceOriginator != "" {
+		if digits := strings.TrimPrefix(cfg.VoiceOriginator, "+"); digits == "" || strings.Trim(digits, "0123456789") != "" {
+			log.Fatalf("Invalid MESSAGEBIRD_VOICE_ORIGINATOR %q: use a phone number, like +31201234567.", cfg.VoiceOriginator)
+		}
+	}
+
+	// Don't let customers book so far ahead that we'd be sitting on scheduled reminders for years.
+	horizonDays := defaultBookingHorizonDays
+	if days := strings.TrimSpace(os.Getenv("BOOKING_HORIZON_DAYS")); days != "" {
+		if horizonDays, err = strconv.Atoi(days); err != nil || horizonDays < 0 {
+			log.Fatalf("Invalid BOOKING_HORIZON_DAYS %q: use a number of days, or 0 for no limit.", days)
+		}
+	}
+	cfg.BookingHorizon = time.Duration(horizonDays) * 24 * time.Hour
+
+	// Keep the schedule tidy: appointments start on the half hour, unless SLOT_MINUTES says otherwise.
+	slotMinutes := defaultSlotMinutes
+	if minutes := strings.TrimSpace(os.Getenv("SLOT_MINUTES")); minutes != "" {
+		if slotMinutes, err = strconv.Atoi(minutes); err != nil || slotMinutes < 0 || slotMinutes > 24*60 {
+			log.Fatalf("Invalid SLOT_MINUTES %q: use a number of minutes, like 15, or 0 to allow any time.", minutes)
+		}
+	}
+	cfg.SlotGranularity = time.Duration(slotMinutes) * time.Minute
+
+	// Bookings have to be at least their reminder lead ahead, so that there's time to remind the customer. To take
+	// later bookings anyway, without the reminder, set LATE_BOOKING_GRACE to how much later, like 3h.
+	if grace := strings.TrimSpace(os.Getenv("LATE_BOOKING_GRACE")); grace != "" {
+		if cfg.LateBookingGrace, err = time.ParseDuration(grace); err != nil || cfg.LateBookingGrace < 0 {
+			log.Fatalf("Invalid LATE_BOOKING_GRACE %q: use a duration, like 3h, or 0 to turn late bookings away.", grace)
+		}
+	}
+	// However late the reminder lead lets customers book, the salon may need notice of its own, like MIN_ADVANCE=2h.
+	if minAdvance := strings.TrimSpace(os.Getenv("MIN_ADVANCE")); minAdvance != "" {
+		if cfg.MinAdvance, err = time.ParseDuration(minAdvance); err != nil || cfg.MinAdvance < 0 {
+			log.Fatalf("Invalid MIN_ADVANCE %q: use a duration, like 2h, or 0 for no minimum besides the reminder lead.", minAdvance)
+		}
+		if cfg.BookingHorizon > 0 && cfg.MinAdvance >= cfg.BookingHorizon {
+			log.Fatalf("MIN_ADVANCE %s leaves nothing to book within BOOKING_HORIZON_DAYS %d.", cfg.MinAdvance, horizonDays)
+		}
+	}
+
+	// Stylists may need a few minutes between clients. By default, appointments can follow each other right away.
+	if minutes := strings.TrimSpace(os.Getenv("BUFFER_MINUTES")); minutes != "" {
+		bufferMinutes, err := strconv.Atoi(minutes)
+		if err != nil || bufferMinutes < 0 || bufferMinutes > 24*60 {
+			log.Fatalf("Invalid BUFFER_MINUTES %q: use a number of minutes, like 10, or 0 for no gap.", minutes)
+		}
+		cfg.AppointmentBuffer = time.Duration(bufferMinutes) * time.Minute
+	}
+
+	// Customers enter dates like 2018-08-01 and times like 14:30, unless DATE_INPUT_FORMAT and TIME_INPUT_FORMAT say
+	// otherwise, like "01/02/2006" and "3:04 PM" in the US. A format that loses part of the date or time stops us here,
+	// rather than booking customers on the wrong day.
+	if cfg.DateLayout = os.Getenv("DATE_INPUT_FORMAT"); cfg.DateLayout == "" {
+		cfg.DateLayout = isoDateLayout
+	} else if !validDateLayout(cfg.DateLayout) {
+		log.Fatalf("Invalid DATE_INPUT_FORMAT %q: use a Go time layout with a day, month and year, like 01/02/2006.", cfg.DateLayout)
+	}
+	if cfg.TimeLayout = os.Getenv("TIME_INPUT_FORMAT"); cfg.TimeLayout == "" {
+		cfg.TimeLayout = isoTimeLayout
+	} else if !validTimeLayout(cfg.TimeLayout) {
+		log.Fatalf("Invalid TIME_INPUT_FORMAT %q: use a Go time layout with hours and minutes, and PM for a 12-hour clock, like 3:04 PM.", cfg.TimeLayout)
+	}
+
+	// Operators can change the wording of the reminders without recompiling. A template that doesn't work stops us right here.
+	cfg.SalonName = strings.TrimSpace(os.Getenv("SALON_NAME"))
+	if cfg.SalonName == "" {
+		cfg.SalonName = defaultSalonName
+	}
+	reminderTemplate := os.Getenv("REMINDER_TEMPLATE")
+	customReminder := reminderTemplate != ""
+	if !customReminder {
+		reminderTemplate = defaultReminderTemplate
+	}
+	if cfg.Reminder, err = parseMessageTemplate("reminder", reminderTemplate); err != nil {
+		log.Fatalf("Invalid REMINDER_TEMPLATE: %v", err)
+	}
+	// Reminders go out in the language the customer booked in. Set REMINDER_TEMPLATE_NL and the like for the wording
+	// in each language. Without them, we use our own translations, unless REMINDER_TEMPLATE changed the wording:
+	// then customers get that, rather than a translation that says something else.
+	cfg.Reminders = make(map[string]*texttemplate.Template)
+	for _, l := range locales {
+		name := "REMINDER_TEMPLATE_" + strings.ToUpper(l.Code)
+		text := os.Getenv(name)
+		if text == "" && !customReminder {
+			text = defaultReminderTemplates[l.Code]
+		}
+		if text == "" {
+			continue
+		}
+		if cfg.Reminders[l.Code], err = parseMessageTemplate("reminder_"+l.Code, text); err != nil {
+			log.Fatalf("Invalid %s: %v", name, err)
+		}
+	}
+
+	// Long messages, or messages with characters outside the GSM 7-bit alphabet, are sent in several SMS segments,
+	// each of which MessageBird charges for. With a price per segment, we can tell operators what the reminders cost.
+	if price := strings.TrimSpace(os.Getenv("SMS_PRICE")); price != "" {
+		if cfg.SMSPrice, err = strconv.ParseFloat(price, 64); err != nil || cfg.SMSPrice < 0 {
+			log.Fatalf("Invalid SMS_PRICE %q: use the price of a single SMS, like 0.07.", price)
+		}
+	}
+	// To keep abuse or a bug from running up the bill, set a daily budget: SMS_DAILY_LIMIT in SMS segments,
+	// or SMS_DAILY_BUDGET in money, which SMS_PRICE turns into segments. With both, the lower one counts.
+	if limit := strings.TrimSpace(os.Getenv("SMS_DAILY_LIMIT")); limit != "" {
+		if cfg.SMSDailyLimit, err = strconv.Atoi(limit); err != nil || cfg.SMSDailyLimit < 0 {
+			log.Fatalf("Invalid SMS_DAILY_LIMIT %q: use a number of SMS segments, or 0 for no limit.", limit)
+		}
+	}
+	if budget := strings.TrimSpace(os.Getenv("SMS_DAILY_BUDGET")); budget != "" {
+		amount, err := strconv.ParseFloat(budget, 64)
+		if err != nil || amount <= 0 {
+			log.Fatalf("Invalid SMS_DAILY_BUDGET %q: use an amount, like 25.", budget)
+		}
+		if cfg.SMSPrice == 0 {
+			log.Fatal("SMS_DAILY_BUDGET is set, but SMS_PRICE isn't: set the price of a single SMS, so that we know how many fit in the budget.")
+		}
+		segments := int(amount / cfg.SMSPrice)
+		if segments < 1 {
+			log.Fatalf("Invalid SMS_DAILY_BUDGET %q: it doesn't pay for a single SMS at SMS_PRICE.", budget)
+		}
+		if cfg.SMSDailyLimit == 0 || segments < cfg.SMSDailyLimit {
+			cfg.SMSDailyLimit = segments
+		}
+	}
+
+	// Warn operators on /admin/balance, and in the log, once the MessageBird balance drops below LOW_BALANCE.
+	a.balance = &balanceCache{}
+	if low := strings.TrimSpace(os.Getenv("LOW_BALANCE")); low != "" {
+		if cfg.LowBalance, err = strconv.ParseFloat(low, 64); err != nil || cfg.LowBalance < 0 {
+			log.Fatalf("Invalid LOW_BALANCE %q: use an amount of credits or euros, like 50, or 0 for no warning.", low)
+		}
+	}
+
+	// In a dry run, bookings are checked but never made, so that you can test against a staging environment for free.
+	if cfg.DryRun = envBool("DRY_RUN"); cfg.DryRun {
+		slog.Warn("DRY_RUN set; bookings are checked, but not saved, and no reminders are scheduled.")
+	}
+
+	// Some MessageBird accounts can't schedule messages, so we can send SMS reminders ourselves instead.
+	cfg.LocalDispatch = envBool("LOCAL_DISPATCH")
+
+	// Customers can get an SMS to confirm their booking right away, on top of their reminders.
+	if envBool("SEND_CONFIRMATION") {
+		text := os.Getenv("CONFIRMATION_TEMPLATE")
+		if text == "" {
+			text = defaultConfirmationTemplate
+		}
+		if cfg.Confirmation, err = parseMessageTemplate("confirmation", text); err != nil {
+			log.Fatalf("Invalid CONFIRMATION_TEMPLATE: %v", err)
+		}
+	}
+
+	// Email reminders need an SMTP server to send them through.
+	if smtpAddr := strings.TrimSpace(os.Getenv("SMTP_ADDR")); smtpAddr != "" {
+		host, _, err := net.SplitHostPort(smtpAddr)
+		if err != nil {
+			log.Fatalf("Invalid SMTP_ADDR %q: %v", smtpAddr, err)
+		}
+		from, ok := parseEmail(os.Getenv("SMTP_FROM"))
+		if !ok {
+			log.Fatal("SMTP_FROM must be set to the email address that reminders are sent from.")
+		}
+		m := smtpMailer{addr: smtpAddr, from: from}
+		if user := os.Getenv("SMTP_USER"); user != "" {
+			m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		a.mailer = m
+	}
+
+	// Limit how many bookings each phone number can make, so nobody can use the form to flood someone with SMS.
+	rateLimit := defaultRateLimit
+	if limit := strings.TrimSpace(os.Getenv("BOOKING_RATE_LIMIT")); limit != "" {
+		var err error
+		if rateLimit, err = strconv.Atoi(limit); err != nil || rateLimit < 0 {
+			log.Fatalf("Invalid BOOKING_RATE_LIMIT %q: use a number of bookings, or 0 for no limit.", limit)
+		}
+	}
+	rateLimitWindow := defaultRateLimitWindow
+	if window := strings.TrimSpace(os.Getenv("BOOKING_RATE_LIMIT_WINDOW")); window != "" {
+		var err error
+		if rateLimitWindow, err = time.ParseDuration(window); err != nil || rateLimitWindow <= 0 {
+			log.Fatalf("Invalid BOOKING_RATE_LIMIT_WINDOW %q: use a duration, like 1h.", window)
+		}
+	}
+	a.idempotency = newIdempotencyCache(idempotencyWindow)
+	// Customers check their details before we book, so that a typo doesn't send reminders to someone else's phone.
+	if a.confirmationKey, err = newConfirmationKey(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep bookings in Redis if REDIS_URL is set, so that several instances can share them, in a SQLite database
+	// if DB_PATH is set, and in memory otherwise. With Redis, the rate limits are shared too.
+	dbPath, redisURL := strings.TrimSpace(os.Getenv("DB_PATH")), strings.TrimSpace(os.Getenv("REDIS_URL"))
+	var smsUsage SMSUsage
+	switch {
+	case dbPath != "" && redisURL != "":
+		log.Fatal("Both DB_PATH and REDIS_URL are set: choose one place to keep bookings.")
+	case redisURL != "":
+		redisStore, err := newRedisStore(redisURL)
+		if err != nil {
+			log.Fatalf("Couldn't connect to Redis: %v", err)
+		}
+		a.store = redisStore
+		a.waitlist = redisStore.waitlist()
+		a.optOuts = redisStore.optOuts()
+		smsUsage = redisStore.smsUsage()
+		if rateLimit > 0 {
+			a.limiter = redisStore.rateLimiter(rateLimit, rateLimitWindow)
+		}
+		slog.Info("Storing bookings in Redis")
+	case dbPath != "":
+		sqlStore, err := newSQLStore(dbPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		a.store = sqlStore
+		a.waitlist = sqlStore.waitlist()
+		a.optOuts = sqlStore.optOuts()
+		smsUsage = sqlStore.smsUsage()
+		slog.Info("Storing bookings in SQLite", "path", dbPath)
+	default:
+		a.store = newMemoryStore()
+		a.waitlist = newMemoryWaitlist()
+		a.optOuts = newMemoryOptOuts()
+		smsUsage = newMemorySMSUsage()
+		slog.Warn("DB_PATH not set; bookings are kept in memory and lost when the application stops.")
+		if cfg.LocalDispatch {
+			slog.Warn("LOCAL_DISPATCH set without DB_PATH or REDIS_URL; pending SMS reminders are lost when the application stops.")
+		}
+	}
+	if a.limiter == nil && rateLimit > 0 {
+		a.limiter = newMemoryRateLimiter(rateLimit, rateLimitWindow)
+	}
+	if cfg.SMSDailyLimit > 0 {
+		a.smsBudget = newSMSBudget(smsUsage, cfg.SMSDailyLimit)
+		a.client = budgetedClient{client: a.client, usage: smsUsage, now: a.now}
+		slog.Info("Limiting SMS per day", "segments", cfg.SMSDailyLimit)
+	}
+
+	templateFuncs["emailEnabled"] = func() bool { return a.mailer != nil }
+
+	// Parse templates once, so that we don't have to read them from disk on every request.
+	reloadTemplates = envBool("RELOAD_TEMPLATES")
+	templates, err = parseTemplates()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// With arguments, we book a single appointment from the command line instead of serving the application.
+	if len(os.Args) > 1 {
+		if os.Args[1] != "schedule" {
+			log.Fatalf("Unknown command %q: run the application without arguments to serve it, or with schedule to book a single appointment.", os.Args[1])
+		}
+		os.Exit(a.scheduleCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Routes
+	// Every page that can show a booking, or the details someone just typed in, is wrapped in noIndex.
+	http.HandleFunc("/", noIndex(a.bbScheduler))
+	http.HandleFunc("/robots.txt", robotsTxt)
+	http.HandleFunc("/cancel", noIndex(a.cancelBooking))
+	http.HandleFunc("/reschedule", noIndex(a.rescheduleBooking))
+	http.HandleFunc("/bookings/", noIndex(a.bookingPages))
+	http.HandleFunc("/waitlist", noIndex(a.joinWaitlist))
+	http.HandleFunc("/slots", a.slots)
+	http.HandleFunc("/admin/bookings", noIndex(requireAdmin(a.adminBookings)))
+	http.HandleFunc("/admin/cancel-phone", noIndex(requireAdmin(a.adminCancelPhone)))
+	http.HandleFunc("/admin/resend", noIndex(requireAdmin(a.adminResend)))
+	http.HandleFunc("/admin/import", noIndex(requireAdmin(a.adminImport)))
+	http.HandleFunc("/admin/audit", noIndex(requireAdmin(a.adminAudit)))
+	http.HandleFunc("/admin/balance", noIndex(requireAdmin(a.adminBalance)))
+	http.HandleFunc("/preview", noIndex(requireAdmin(a.previewReminder)))
+	http.HandleFunc("/api/bookings", noIndex(a.apiBookings))
+	http.HandleFunc("/webhooks/status", a.statusWebhook)
+	http.HandleFunc("/webhooks/inbound", a.inboundWebhook)
+	http.HandleFunc("/healthz", a.healthz)
+	http.HandleFunc("/readyz", a.readyz)
+	if a.metrics != nil {
+		http.HandleFunc("/metrics", a.metrics.serveMetrics)
+	}
+
+	// Try again to cancel the reminders that reschedules replaced, but couldn't cancel, before we last stopped.
+	go a.reconcileReminders(context.Background())
+
+	// Send the SMS reminders that are due ourselves, from now until we stop.
+	if cfg.LocalDispatch {
+		dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+		defer stopDispatch()
+		go a.runDispatcher(dispatchCtx)
+		slog.Info("Sending SMS reminders ourselves", "interval", dispatchInterval)
+	}
+
+	// Serve
+	// Listen before we say we're ready, so that an address that's taken stops the application right away.
+	listener, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		log.Fatalf("Couldn't listen on %s: %v", cfg.ListenAddr, err)
+	}
+	srv := &http.Server{Addr: cfg.ListenAddr, Handler: logRequests(securityHeaders(http.DefaultServeMux))}
+	var redirectSrv *http.Server
+	var redirectListener net.Listener
+	if tlsEnabled() {
+		var manager *autocert.Manager
+		if len(cfg.TLSDomains) > 0 {
+			manager = newCertManager()
+		}
+		if srv.TLSConfig, err = serverTLSConfig(manager); err != nil {
+			log.Fatalf("Couldn't load TLS_CERT_FILE and TLS_KEY_FILE: %v", err)
+		}
+		if redirectListener, err = net.Listen("tcp", cfg.RedirectAddr); err != nil {
+			log.Fatalf("Couldn't listen on %s: %v", cfg.RedirectAddr, err)
+		}
+		redirectSrv = &http.Server{Addr: cfg.RedirectAddr, Handler: logRequests(redirectHandler(manager))}
+	}
+	var grpcSrv *grpc.Server
+	var grpcListener net.Listener
+	if cfg.GRPCAddr != "" {
+		if grpcListener, err = net.Listen("tcp", cfg.GRPCAddr); err != nil {
+			log.Fatalf("Couldn't listen on %s: %v", cfg.GRPCAddr, err)
+		}
+		grpcSrv = newGRPCServer(&a)
+	}
+	atomic.StoreInt32(&a.ready, 1)
+	go func() {
+		// The listener's address is the one we really got, like the port picked for ":0".
+		slog.Info("Serving application", "addr", listener.Addr().String(), "tls", tlsEnabled())
+		serve := srv.Serve
+		if tlsEnabled() {
+			// The certificates are in srv.TLSConfig already.
+			serve = func(l net.Listener) error { return srv.ServeTLS(l, "", "") }
+		}
+		if err := serve(listener); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	if redirectSrv != nil {
+		go func() {
+			slog.Info("Redirecting HTTP to HTTPS", "addr", redirectListener.Addr().String())
+			if err := redirectSrv.Serve(redirectListener); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+	if grpcSrv != nil {
+		go func() {
+			slog.Info("Serving gRPC", "addr", grpcListener.Addr().String())
+			if err := grpcSrv.Serve(grpcListener); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// Wait for Ctrl+C or SIGTERM, then give in-flight bookings a moment to finish
+	// so that we don't drop a customer halfway through scheduling their reminders.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	slog.Info("Shutting down")
+	atomic.StoreInt32(&a.ready, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if grpcSrv != nil {
+		// GracefulStop waits for every RPC to finish, so stop the rest once we've waited for them long enough.
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcSrv.Stop()
+		}
+	}
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(ctx)
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Stopped before all requests finished", "err", err)
+		return
+	}
+	slog.Info("Shut down cleanly")
+}
+
+// Routes
+func (a *app) bbScheduler(w http.ResponseWriter, r *http.Request) {
+	// Parse the form before anything reads from it: after the first read, a form we couldn't parse just looks empty.
+	var formErr error
+	if r.Method == "POST" {
+		formErr = r.ParseForm()
+	}
+
+	// Initialize &booking with only MinDate and MaxDate values so that we can pass "min" and "max" values into <input type="date"/>
+	// A link to the booking form can choose the branch, like /?branch=Berlin, and ask for a dry run, like /?dry_run=1.
+	BookingEmpty := booking{Branch: r.FormValue("branch")}
+	BookingEmpty.DryRun, _ = strconv.ParseBool(r.FormValue("dry_run"))
+	BookingEmpty.MinDate, BookingEmpty.MaxDate = a.bookableDates()
+	lang := requestLocale(r)
+
+	// Handle form submission
+	if r.Method == "POST" {
+		if formErr != nil {
+			slog.Warn("Couldn't parse booking form", "err", formErr)
+			berr := &bookingError{http.StatusBadRequest, codeInvalidRequest, translate(lang, "invalid_form"), "", nil}
+			a.metrics.booking(berr, false)
+			writeBookingResult(w, r, berr.Status, BookingEmpty, errorResponse(berr), lang)
+			return
+		}
+
+		// Going back or refreshing the page posts the form again. If we've already booked it, show the same result again.
+		key := idempotencyKey(r)
+		if key != "" && a.idempotency != nil {
+			previous, busy := a.idempotency.start(key, a.now())
+			if busy {
+				berr := &bookingError{http.StatusConflict, codeDuplicateRequest, translate(lang, "duplicate_request"), "", nil}
+				writeBookingResult(w, r, berr.Status, BookingEmpty, errorResponse(berr), lang)
+				return
+			}
+			if previous != nil {
+				writeBookingResult(w, r, previous.status, previous.booking, previous.response, lang)
+				return
+			}
+			// Unless the booking goes through, forget the key again, so that the customer can fix their details and try again.
+			defer a.idempotency.abort(key)
+		}
+
+		// A confirmed booking comes from the confirmation step, which carries the booking we checked. We don't take
+		// anything else from the form then: the customer confirmed these details, and its signature says they're ours.
+		var (
+			ThisBooking booking
+			recurrence  string
+			occurrences int
+			enteredName string
+		)
+		token := r.FormValue("confirmation")
+		if token != "" && a.confirmationKey != nil {
+			c, err := verifyConfirmation(a.confirmationKey, token, a.now())
+			if err != nil {
+				berr := &bookingError{http.StatusBadRequest, codeInvalidConfirmation, translate(lang, "invalid_confirmation"), "", nil}
+				a.metrics.booking(berr, false)
+				writeBookingResult(w, r, berr.Status, BookingEmpty, errorResponse(berr), lang)
+				return
+			}
+			ThisBooking, recurrence, occurrences = c.Booking, c.Recurrence, c.Occurrences
+			ThisBooking.LookedUp = c.LookedUp
+			ThisBooking.MinDate, ThisBooking.MaxDate = BookingEmpty.MinDate, BookingEmpty.MaxDate
+			// We already told the customer if we shortened their name, when they confirmed.
+			enteredName = ThisBooking.Name
+		} else {
+			var berr *bookingError
+			ThisBooking, recurrence, occurrences, berr = bookingFromForm(r, lang)
+			ThisBooking.MinDate, ThisBooking.MaxDate, ThisBooking.DryRun = BookingEmpty.MinDate, BookingEmpty.MaxDate, BookingEmpty.DryRun
+			if berr != nil {
+				a.metrics.booking(berr, false)
+				writeBookingResult(w, r, berr.Status, ThisBooking, errorResponse(berr), lang)
+				return
+			}
+			enteredName = sanitizeText(ThisBooking.Name)
+		}
+		requestedChannel := ThisBooking.Channel
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+		defer cancel()
+
+		// Unless the customer has confirmed, only check the booking, and ask them to confirm it before we book it.
+		// Dry runs don't book anything anyway, and clients that ask for JSON can check a booking first with a dry run.
+		if token == "" && a.confirmationKey != nil && !ThisBooking.DryRun && !cfg.DryRun && !wantsJSON(r) {
+			a.confirmBooking(ctx, w, r, ThisBooking, recurrence, occurrences, enteredName, lang)
+			return
+		}
+
+		ThisBooking, reminderTimes, berr := a.makeBooking(ctx, ThisBooking, lang)
+		a.metrics.booking(berr, ThisBooking.DryRun)
+		if berr != nil {
+			a.writeBookingError(w, r, ThisBooking, berr, lang)
+			return
+		}
+		bookingTime := *ThisBooking.BookingTime
+		var seriesBooked []booking
+		var seriesSkipped []time.Time
+		if occurrences > 1 && !ThisBooking.DryRun {
+			seriesBooked, seriesSkipped, berr = a.bookSeries(ctx, ThisBooking, recurrence, occurrences, lang)
+		}
+
+		// Set messages to display
+		var reminderTimesText []string
+		for _, reminderTime := range reminderTimes {
+			reminderTimesText = append(reminderTimesText, reminderTime.Format(translate(lang, "date_format")))
+		}
+		channelText := translate(lang, "channel_sms", strings.Join(reminderRecipients(ThisBooking), ", "))
+		if ThisBooking.Channel == channelWhatsApp {
+			channelText = translate(lang, "channel_whatsapp", ThisBooking.ContactPhone)
+		} else if ThisBooking.Channel == channelVoice {
+			channelText = translate(lang, "channel_voice", ThisBooking.ContactPhone)
+		} else if requestedChannel == channelWhatsApp {
+			channelText = translate(lang, "channel_sms_fallback", strings.Join(reminderRecipients(ThisBooking), ", "))
+		}
+		if ThisBooking.Email != "" {
+			channelText = translate(lang, "channel_email", channelText, ThisBooking.Email)
+		}
+		doneKey := "booking_done"
+		if ThisBooking.DryRun {
+			doneKey = "dry_run_done"
+		}
+		// A late booking, within cfg.LateBookingGrace, is too soon for any reminder.
+		if len(reminderTimes) == 0 {
+			doneKey += "_no_reminder"
+		}
+		successStatus := translate(lang, doneKey, bookingTime.Format(translate(lang, "date_format")), bookingTime.Location().String(),
+			ThisBooking.Treatment, channelText, strings.Join(reminderTimesText, translate(lang, "and")), ThisBooking.Reference, cfg.SalonName)
+		if len(seriesBooked) > 0 {
+			var seriesText []string
+			for _, b := range seriesBooked {
+				seriesText = append(seriesText, b.BookingTime.Format(translate(lang, "date_format")))
+			}
+			successStatus += translate(lang, "series_booked", strings.Join(seriesText, ", "))
+		}
+		if len(seriesSkipped) > 0 {
+			var skippedText []string
+			for _, t := range seriesSkipped {
+				skippedText = append(skippedText, t.Format(translate(lang, "date_format")))
+			}
+			successStatus += translate(lang, "series_skipped", strings.Join(skippedText, ", "))
+		}
+		if berr != nil {
+			successStatus += translate(lang, "series_failed", berr.Message)
+		}
+		if ThisBooking.Name != enteredName {
+			successStatus += translate(lang, "name_shortened", ThisBooking.Name)
+		}
+		if len(ThisBooking.RejectedPhones) > 0 {
+			successStatus += translate(lang, "phones_rejected", strings.Join(ThisBooking.RejectedPhones, ", "))
+		}
+
+		result := bookedResponse(ThisBooking, reminderTimes)
+		result.Message = successStatus
+		if key != "" && a.idempotency != nil {
+			a.idempotency.finish(key, idempotentResult{http.StatusOK, ThisBooking, result}, a.now())
+		}
+		writeBookingResult(w, r, http.StatusOK, ThisBooking, result, lang)
+		return
+	}
+	// By default, render page with BookingEmpty object with no message.
+	renderPage(w, http.StatusOK, "views/booking.gohtml", bookingContainer{Booking: BookingEmpty, Lang: lang, IdempotencyKey: newIdempotencyKey()})
+}
+
+// bookingFromForm returns the booking, and how often to repeat it, that the customer entered in the booking form.
+// If the form doesn't make sense, it returns as much of the booking as it could, to show the form again with.
+func bookingFromForm(r *http.Request, lang string) (booking, string, int, *bookingError) {
+	// Populate thisBooking with data to pass back into form.
+	// We can also use this to pass data into a remote database.
+	thisBooking := booking{
+		Name:         r.FormValue("name"),
+		Treatment:    r.FormValue("treatment"),
+		Staff:        r.FormValue("staff"),
+		Branch:       r.FormValue("branch"),
+		Phone:        r.FormValue("phone"),
+		ContactPhone: r.FormValue("contact_phone"),
+		Phones:       parsePhones(r.FormValue("phones")),
+		Country:      r.FormValue("country"),
+		Email:        r.FormValue("email"),
+		ReminderLead: r.FormValue("reminder_lead"),
+		Channel:      r.FormValue("channel"),
+		Notes:        r.FormValue("notes"),
+		Consent:      r.FormValue("consent") != "",
+	}
+
+	// Convert r.FormValue("date") to time.Time type, at the branch's local time.
+	// If there's no such branch, makeBooking rejects the booking anyway.
+	// A blank or malformed date or time must never get as far as scheduling, where it would look like a time long past.
+	branch, _ := findBranch(thisBooking.Branch)
+	timezone := loc
+	if branch.Timezone != nil {
+		timezone = branch.Timezone
+	}
+	bookingTime, err := parseBookingTime(r.FormValue("date"), r.FormValue("time"), timezone)
+	if err != nil {
+		slog.Debug("Couldn't parse booking time", "err", err)
+		return thisBooking, "", 0, &bookingError{http.StatusBadRequest, codeInvalidBookingTime, translate(lang, "invalid_booking_time"), "date", nil}
+	}
+	thisBooking.BookingTime = &bookingTime
+
+	// Recurring appointments are booked as a series: the first one just like a single appointment, then the rest.
+	recurrence := r.FormValue("recurrence")
+	occurrences, berr := parseRecurrence(recurrence, r.FormValue("occurrences"), lang)
+	if berr != nil {
+		return thisBooking, "", 0, berr
+	}
+	if occurrences > 1 {
+		if thisBooking.SeriesID, err = newBookingID(); err != nil {
+			slog.Error("Couldn't create series id", "err", err)
+			return thisBooking, "", 0, &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+		}
+	}
+	return thisBooking, recurrence, occurrences, nil
+}
+
+// writeBookingResult responds to a booking form submission with result, as JSON if the client asked for it,
+// and as the booking form showing b and result's message otherwise.
+func writeBookingResult(w http.ResponseWriter, r *http.Request, status int, b booking, result bookingResponse, lang string) {
+	if wantsJSON(r) {
+		writeJSON(w, status, result)
+		return
+	}
+	message := result.Message
+	if result.Error != "" {
+		message = result.Error
+	}
+	// Every time we show the form, it gets a new key: posting it again is meant to be a new booking.
+	renderPage(w, status, "views/booking.gohtml", bookingContainer{Booking: b, Message: message, Field: result.Field, Errors: result.Errors, Lang: lang, IdempotencyKey: newIdempotencyKey()})
+}
+
+// errorCode identifies why a booking failed. Codes are part of the JSON API, so never change existing ones.
+type errorCode string
+
+const (
+	codeInvalidRequest      errorCode = "invalid_request"
+	codeDuplicateRequest    errorCode = "duplicate_request"
+	codeInvalidConfirmation errorCode = "invalid_confirmation"
+	codeInvalidBookingTime  errorCode = "invalid_booking_time"
+	codeInvalidName         errorCode = "invalid_name"
+	codeInvalidNotes        errorCode = "invalid_notes"
+	codeConsentRequired     errorCode = "consent_required"
+	codeOptedOut            errorCode = "opted_out"
+	codeInvalidTreatment    errorCode = "invalid_treatment"
+	codeInvalidStaff        errorCode = "invalid_staff"
+	codeInvalidBranch       errorCode = "invalid_branch"
+	codeStaffUnavailable    errorCode = "staff_unavailable"
+	codeDayFull             errorCode = "day_full"
+	codeSlotTaken           errorCode = "slot_taken"
+	codeInvalidReminderLead errorCode = "invalid_reminder_lead"
+	codeInvalidChannel      errorCode = "invalid_channel"
+	codeInvalidRecurrence   errorCode = "invalid_recurrence"
+	codeInvalidEmail        errorCode = "invalid_email"
+	codeInvalidLanguage     errorCode = "invalid_language"
+	codeInvalidPhone        errorCode = "invalid_phone"
+	codeInvalidPhones       errorCode = "invalid_phones"
+	codeNotMobile           errorCode = "not_mobile"
+	codeInvalidCountry      errorCode = "invalid_country"
+	codeInPast              errorCode = "in_past"
+	codeTooFar              errorCode = "too_far"
+	codeClosedDay           errorCode = "closed_day"
+	codeBeforeOpening       errorCode = "before_opening"
+	codeAfterClosing        errorCode = "after_closing"
+	codeRunsPastClosing     errorCode = "runs_past_closing"
+	codeOffSlot             errorCode = "off_slot"
+	codeShortNotice         errorCode = "short_notice"
+	codeTooSoon             errorCode = "too_soon"
+	codeRateLimited         errorCode = "rate_limited"
+	codeSMSBudgetExhausted  errorCode = "sms_budget_exhausted"
+	codeSMSFailed           errorCode = "sms_failed"
+	codeTimeout             errorCode = "timeout"
+	codeLookupUnavailable   errorCode = "lookup_unavailable"
+	codeEmailFailed         errorCode = "email_failed"
+	codeStoreFailed         errorCode = "store_failed"
+	codeInternal            errorCode = "internal_error"
 )
 
-// Data structures
-type booking struct {
-	Name        string
-	Treatment   string
-	Phone       string
-	BookingTime *time.Time
-	MinDate     string
+// bookingError is the reason a booking failed: its code, a message we can show the customer, and the HTTP status code that goes with it.
+// If the failure is caused by a single field, Field is its form field name. If several fields are wrong, the others
+// are the first one's, and Errors lists all of them.
+type bookingError struct {
+	Status  int
+	Code    errorCode
+	Message string
+	Field   string
+	Errors  []fieldError
+}
+
+func (e *bookingError) Error() string {
+	return e.Message
+}
+
+// fieldError is what's wrong with one of a booking's fields.
+type fieldError struct {
+	Field   string    `json:"field"`
+	Code    errorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// fieldErrors returns every field e is about, with what's wrong with it: the fields in Errors, or e's own Field.
+func (e *bookingError) fieldErrors() []fieldError {
+	if len(e.Errors) > 0 {
+		return e.Errors
+	}
+	if e.Field == "" {
+		return nil
+	}
+	return []fieldError{{e.Field, e.Code, e.Message}}
+}
+
+// invalidFields returns the bookingError for a booking with the problems errs, each with a different field or
+// more than one with the same, so that customers can fix them all at once instead of finding out one at a time.
+func invalidFields(errs []*bookingError) *bookingError {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	berr := *errs[0]
+	for _, e := range errs {
+		berr.Errors = append(berr.Errors, fieldError{e.Field, e.Code, e.Message})
+	}
+	return &berr
+}
+
+// timeErrors returns the bookingErrors, for the form field field, that explain terrs to the customer in the locale lang.
+// If checkTime suggested the earliest time we'd take instead, the last of them ends with it.
+func timeErrors(terrs []timeError, earliest time.Time, field, lang string) []*bookingError {
+	var errs []*bookingError
+	for _, terr := range terrs {
+		errs = append(errs, &bookingError{http.StatusBadRequest, terr.Code, timeErrorMessage(terr, lang), field, nil})
+	}
+	if len(errs) > 0 && !earliest.IsZero() {
+		errs[len(errs)-1].Message += translate(lang, "earliest_time", earliest.Format(translate(lang, "date_format")))
+	}
+	return errs
+}
+
+// makeBooking validates thisBooking, schedules its reminders and saves it.
+// It's shared by the booking form and the JSON API, so that both accept and reject exactly the same bookings.
+// It returns the saved booking and the times its reminders will be sent, or a *bookingError if the booking failed.
+// Error messages are in the locale lang. ctx limits how long we wait for MessageBird.
+func (a *app) makeBooking(ctx context.Context, thisBooking booking, lang string) (booking, []time.Time, *bookingError) {
+	bookingTime := *thisBooking.BookingTime
+	thisBooking.DryRun = thisBooking.DryRun || cfg.DryRun
+
+	// Check the customer's details before we spend any API calls on the booking. Check every field before giving up,
+	// so that the customer can fix everything that's wrong in one go.
+	treatment, errs := validateDetails(&thisBooking, lang)
+	branch, branchOK := findBranch(thisBooking.Branch)
+	if branchOK {
+		thisBooking.Branch = branch.Name
+		// Work in the branch's timezone, wherever the customer is.
+		bookingTime = bookingTime.In(branch.Timezone)
+		thisBooking.BookingTime = &bookingTime
+	} else {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidBranch, translate(lang, "invalid_branch"), "branch", nil})
+	}
+
+	// Set a time.Duration value for message scheduling.
+	// By default, we set a 3 hour duration that we will use to subtract from the booking time, unless the treatment
+	// has its own. If the customer picked a reminder lead time, use it instead.
+	reminderDiff, err := reminderDiffFor(thisBooking.ReminderLead, treatment, lang)
+	if err != nil {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidReminderLead, err.Error(), "reminder_lead", nil})
+		reminderDiff = defaultReminderDiff
+	}
+
+	// Check the reminder channel. SMS is the default, WhatsApp is only available if we have a WhatsApp channel,
+	// and voice only if we have a number to call from.
+	switch thisBooking.Channel {
+	case "":
+		thisBooking.Channel = channelSMS
+	case channelSMS:
+	case channelWhatsApp:
+		if cfg.WhatsAppChannelID == "" {
+			errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidChannel, translate(lang, "whatsapp_unavailable"), "channel", nil})
+		}
+	case channelVoice:
+		if cfg.VoiceOriginator == "" {
+			errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidChannel, translate(lang, "voice_unavailable"), "channel", nil})
+		}
+	default:
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidChannel, translate(lang, "invalid_channel"), "channel", nil})
+	}
+
+	// Email reminders are optional, and only available if we can send email.
+	if thisBooking.Email = strings.TrimSpace(thisBooking.Email); thisBooking.Email != "" {
+		email, valid := parseEmail(thisBooking.Email)
+		switch {
+		case a.mailer == nil:
+			errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidEmail, translate(lang, "email_unavailable"), "email", nil})
+		case !valid:
+			errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidEmail, translate(lang, "invalid_email"), "email", nil})
+		default:
+			thisBooking.Email = email
+		}
+	}
+
+	// Reminders are in the language the customer booked in, unless they asked for another. They're scheduled ahead,
+	// so this is when their language is settled.
+	if thisBooking.Language = strings.ToLower(strings.TrimSpace(thisBooking.Language)); thisBooking.Language == "" {
+		thisBooking.Language = lang
+	} else if catalog[thisBooking.Language] == nil {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidLanguage, translate(lang, "invalid_language"), "language", nil})
+	}
+
+	// Numbers in international format carry their own country code, so MessageBird only uses ours for national numbers.
+	if thisBooking.Country == "" {
+		thisBooking.Country = cfg.CountryCode
+	}
+	country, countryOK := parseCountryCode(thisBooking.Country)
+	if countryOK {
+		thisBooking.Country = country
+	} else {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidCountry, translate(lang, "invalid_country"), "country", nil})
+	}
+	// Lookups cost money, so throw out anything that can't possibly be a phone number first, along with the rest.
+	if !plausiblePhone(thisBooking.Phone) {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidPhone, translate(lang, "invalid_phone"), "phone", nil})
+	}
+	thisBooking.ContactPhone = strings.TrimSpace(thisBooking.ContactPhone)
+	if thisBooking.ContactPhone != "" && !plausiblePhone(thisBooking.ContactPhone) {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidPhone, translate(lang, "invalid_phone"), "contact_phone", nil})
+	}
+	// The rest of a group gets the same SMS as the contact number, as recipients of the same message.
+	if len(thisBooking.Phones) > maxGroupPhones {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidPhones, translate(lang, "too_many_phones", maxGroupPhones), "phones", nil})
+	} else if len(thisBooking.Phones) > 0 && thisBooking.Channel != channelSMS {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidPhones, translate(lang, "phones_sms_only"), "phones", nil})
+	}
+
+	// Without a branch and a treatment, there are no opening hours or duration to check the time against.
+	now := a.now()
+	if branchOK && treatment.Name != "" {
+		terrs, earliest := checkTime(branch, bookingTime, treatment.Duration, reminderDiff, now)
+		if !earliest.IsZero() {
+			thisBooking.SuggestedTime = &earliest
+		}
+		errs = append(errs, timeErrors(terrs, earliest, "date", lang)...)
+	}
+	if len(errs) > 0 {
+		return thisBooking, nil, invalidFields(errs)
+	}
+	// The customer's name goes into every reminder. Shorten it if that keeps the reminders to a single SMS.
+	thisBooking.Name = fitName(thisBooking)
+
+	// Now that everything else checks out, we'll check if the phone numbers are valid. A confirmed booking's numbers
+	// were looked up when we checked it, and lookups cost money, so we don't pay for them twice.
+	if !thisBooking.LookedUp {
+		if berr := a.lookupPhones(ctx, &thisBooking, country, lang); berr != nil {
+			return thisBooking, nil, berr
+		}
+	}
+
+	if berr := a.checkStaff(thisBooking, treatment.Duration, lang); berr != nil {
+		return thisBooking, nil, berr
+	}
+	if berr := a.checkBranchCapacity(thisBooking, treatment.Duration, lang); berr != nil {
+		return thisBooking, nil, berr
+	}
+
+	// Everything checks out, so this booking is going to cost us messages. Make sure the number we send them to
+	// hasn't had too many already. If MessageBird couldn't normalize the number, at least ignore spaces and punctuation.
+	limitKey := digitsOnly(thisBooking.ContactPhone)
+	// A dry run doesn't send anything, so it doesn't count towards the limit either.
+	if a.limiter != nil && !thisBooking.DryRun {
+		allowed, err := a.limiter.Allow(limitKey, now)
+		if err != nil {
+			// The limit guards against abuse; it shouldn't stop everyone from booking when it can't be checked.
+			slog.Error("Couldn't check rate limit", "phone", maskPhone(thisBooking.ContactPhone), "err", err)
+		} else if !allowed {
+			return thisBooking, nil, &bookingError{http.StatusTooManyRequests, codeRateLimited, translate(lang, "rate_limited"), "phone", nil}
+		}
+		// Anyone could be added to a group, so each of its numbers has a limit of its own. Those past it are left out.
+		leaveOut(&thisBooking, func(phone string) bool {
+			allowed, err := a.limiter.Allow(digitsOnly(phone), now)
+			return err == nil && !allowed
+		})
+	}
+
+	// WhatsApp reminders are sent by us rather than scheduled with MessageBird, so we can't know whether the customer
+	// is reachable on WhatsApp until we try. Send a short welcome message now, and fall back to SMS if it fails.
+	if thisBooking.Channel == channelWhatsApp && !thisBooking.DryRun {
+		err := a.sendWhatsApp(ctx, thisBooking.ContactPhone, translate(thisBooking.Language, "whatsapp_welcome", cfg.SalonName, thisBooking.Name))
+		if err != nil {
+			slog.Warn("Couldn't reach customer on WhatsApp; falling back to SMS", "phone", maskPhone(thisBooking.ContactPhone), "err", maskPhones(err.Error()))
+			thisBooking.Channel = channelSMS
+		}
+	}
+	// Customers who texted us STOP get no more SMS, and reminders are no use to them without.
+	if thisBooking.Channel == channelSMS && a.optOuts != nil {
+		optedOut, err := a.optOuts.OptedOut(thisBooking.ContactPhone)
+		if err != nil {
+			slog.Error("Couldn't check opt-out", "phone", maskPhone(thisBooking.ContactPhone), "err", err)
+			return thisBooking, nil, &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+		}
+		if optedOut {
+			return thisBooking, nil, &bookingError{http.StatusConflict, codeOptedOut, translate(lang, "opted_out", keywordStart), "phone", nil}
+		}
+		leaveOut(&thisBooking, a.optedOut)
+	}
+	// Once today's SMS budget is spent, something may well be wrong, so stop taking bookings that need more of them.
+	if thisBooking.Channel == channelSMS && !thisBooking.DryRun && a.smsBudget != nil && a.smsBudget.exhausted(now) {
+		return thisBooking, nil, &bookingError{http.StatusServiceUnavailable, codeSMSBudgetExhausted, translate(lang, "sms_budget_exhausted"), "", nil}
+	}
+	consentedAt := now
+	thisBooking.ConsentedAt = &consentedAt
+
+	// Reminders link to the booking and quote its reference, so it needs both before they're scheduled.
+	if !thisBooking.DryRun {
+		if thisBooking.ID, err = newBookingID(); err != nil {
+			slog.Error("Couldn't make booking id", "err", err)
+			return thisBooking, nil, &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+		}
+		if thisBooking.Reference, err = newBookingReference(a.store); err != nil {
+			slog.Error("Couldn't make booking reference", "err", err)
+			return thisBooking, nil, &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+		}
+	}
+	reminderTimes, berr := a.scheduleReminders(ctx, &thisBooking, reminderDiff, now, lang)
+	if berr != nil {
+		return thisBooking, nil, berr
+	}
+	if thisBooking.DryRun {
+		slog.Info("Dry run", "phone", maskPhone(thisBooking.Phone), "booking_time", bookingTime, "channel", thisBooking.Channel)
+		return thisBooking, reminderTimes, nil
+	}
+
+	// Now that the reminders are scheduled, save the booking, if no one took the slot in the meantime.
+	if berr := a.saveBooking(ctx, thisBooking, treatment.Duration, lang); berr != nil {
+		return thisBooking, nil, berr
+	}
+	slog.Info("Booked", "booking_id", thisBooking.ID, "phone", maskPhone(thisBooking.Phone), "booking_time", bookingTime, "channel", thisBooking.Channel)
+	a.leaveWaitlist(thisBooking)
+
+	// The reminders are already scheduled, so the booking stands even if the confirmation doesn't go out.
+	a.sendConfirmation(ctx, thisBooking)
+
+	return thisBooking, reminderTimes, nil
 }
 
-type bookingContainer struct {
-	Booking booking
-	Message string
+// scheduleReminders schedules the reminders for b on its channel, and by email if b has an email address,
+// each reminder lead (see reminderLeads) before the booking time. Reminders that would be due before now are skipped.
+// The new reminders are added to b.MessageIDs and b.ReminderStatuses, and their times are returned.
+// If one of them fails, the ones already scheduled are cancelled again; see unscheduleReminders.
+func (a *app) scheduleReminders(ctx context.Context, b *booking, reminderDiff time.Duration, now time.Time, lang string) ([]time.Time, *bookingError) {
+	scheduled := len(b.MessageIDs)
+	failed := func(berr *bookingError) ([]time.Time, *bookingError) {
+		a.unscheduleReminders(b, scheduled)
+		return nil, berr
+	}
+	reminderMessage, err := reminderText(*b)
+	if err != nil {
+		id := errorID(ctx)
+		slog.Error("Couldn't render reminder", "error_id", id, "booking_time", *b.BookingTime, "err", err)
+		return nil, &bookingError{http.StatusInternalServerError, codeSMSFailed, translate(lang, "sms_failed", id), "", nil}
+	}
+
+	// Create a new message for each reminder, and schedule it to be sent that far before the booking time.
+	var reminderTimes []time.Time
+	for _, lead := range reminderLeads(reminderDiff) {
+		reminderTime := reminderTimeFor(*b.BookingTime, lead)
+		// Skip reminders that would have to be sent in the past, e.g. the 24 hour reminder for a booking tomorrow morning.
+		if reminderTime.Before(now) {
+			continue
+		}
+		// In a dry run, only say when we would have sent the reminder.
+		if b.DryRun {
+			reminderTimes = append(reminderTimes, reminderTime)
+			continue
+		}
+
+		var (
+			messageID string
+			err       error
+		)
+		if b.Channel == channelWhatsApp {
+			messageID, err = a.scheduleWhatsApp(b.ContactPhone, reminderMessage, reminderTime)
+		} else if b.Channel == channelVoice {
+			messageID, err = a.scheduleVoice(b.ContactPhone, reminderMessage, b.Language, reminderTime)
+		} else if cfg.LocalDispatch {
+			// The dispatcher sends it when it's due; all it needs is an id that says when.
+			if messageID, err = dispatchedReminderID(reminderTime); err == nil {
+				slog.Info("Queued SMS reminder", "message_id", messageID, "phone", maskPhone(b.ContactPhone), "booking_time", *b.BookingTime, "send_at", reminderTime)
+			}
+		} else {
+			// A network error can hide that MessageBird did create the message, so a retry may schedule it twice.
+			// That's still better than no reminder at all.
+			var msg *sms.Message
+			err = retry(ctx, "create SMS", func() (err error) {
+				msg, err = a.client.CreateSMS(
+					ctx,
+					branchFor(*b).Originator,
+					reminderRecipients(*b),
+					reminderMessage,
+					// Use messagebird.MessageParams to set up a schedule for the reminder SMS.
+					&sms.Params{
+						ScheduledDatetime: reminderTime,
+					},
+				)
+				return err
+			})
+			if err == nil {
+				slog.Info("Scheduled SMS reminder", "message_id", msg.ID, "phone", maskPhone(b.ContactPhone), "booking_time", *b.BookingTime, "send_at", reminderTime)
+				messageID = msg.ID
+			}
+		}
+		// If the MessageBird API encounters an error, intercept and return an error message instead of breaking the application.
+		// The error may give away how we talk to MessageBird, so only log it, with an id the customer can give us to find it.
+		if errors.Is(err, context.DeadlineExceeded) {
+			slog.Error("Scheduling reminder timed out", "channel", b.Channel, "phone", maskPhone(b.ContactPhone), "timeout", cfg.APITimeout)
+			return failed(&bookingError{http.StatusGatewayTimeout, codeTimeout, translate(lang, "timeout"), "", nil})
+		}
+		if err != nil {
+			id := errorID(ctx)
+			slog.Error("Couldn't schedule reminder", "error_id", id, "channel", b.Channel, "phone", maskPhone(b.ContactPhone), "booking_time", *b.BookingTime, "err", maskPhones(err.Error()))
+			return failed(&bookingError{http.StatusBadGateway, codeSMSFailed, translate(lang, "sms_failed", id), "", nil})
+		}
+
+		// Keep the message id, so that we can cancel the reminder if the booking is cancelled.
+		b.MessageIDs = append(b.MessageIDs, messageID)
+		if b.ReminderStatuses == nil {
+			b.ReminderStatuses = make(map[string]string)
+		}
+		b.ReminderStatuses[messageID] = reminderPending
+		reminderTimes = append(reminderTimes, reminderTime)
+
+		// Send the same reminder by email at the same time, if the customer asked for it.
+		if b.Email != "" {
+			emailID, err := a.scheduleEmail(b.Email, reminderMessage, b.Language, reminderTime)
+			if err != nil {
+				slog.Error("Couldn't schedule email reminder", "booking_time", *b.BookingTime, "err", err)
+				return failed(&bookingError{http.StatusInternalServerError, codeEmailFailed, translate(lang, "email_failed"), "email", nil})
+			}
+			b.MessageIDs = append(b.MessageIDs, emailID)
+			b.ReminderStatuses[emailID] = reminderPending
+		}
+	}
+	return reminderTimes, nil
 }
 
-func main() {
-	client = messagebird.New("<enter-your-apikey>")
+// unscheduleReminders cancels the reminders from b.MessageIDs[from] on, which scheduleReminders scheduled before
+// one of them failed, so that the customer doesn't get reminders for a booking that wasn't made, and trying again
+// doesn't schedule them twice. The failure may have been a timeout, so this gets a timeout of its own. The ones it
+// couldn't cancel are logged, and left on b.
+func (a *app) unscheduleReminders(b *booking, from int) {
+	added := booking{ID: b.ID, MessageIDs: b.MessageIDs[from:], ReminderStatuses: b.ReminderStatuses}
+	if len(added.MessageIDs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.APITimeout)
+	defer cancel()
+	kept := a.cancelEach(ctx, added, "Couldn't cancel reminder of a failed booking")
+	for _, messageID := range added.MessageIDs {
+		if !slices.Contains(kept, messageID) {
+			delete(b.ReminderStatuses, messageID)
+		}
+	}
+	b.MessageIDs = append(b.MessageIDs[:from:from], kept...)
+}
 
-	// Routes
-	http.HandleFunc("/", bbScheduler)
+// lookupPhones looks up b's phone numbers, in country unless they start with a country code, and replaces them with
+// the numbers MessageBird gives us. A lookup that doesn't get an answer isn't about the number, so it stops the booking
+// right away; otherwise, the error lists every number that didn't check out.
+func (a *app) lookupPhones(ctx context.Context, b *booking, country, lang string) *bookingError {
+	var errs []*bookingError
+	phone, phoneCountry, berr := a.lookupPhone(ctx, b.Phone, country, phoneTypesFor(b.Channel), "phone", lang)
+	if berr != nil {
+		if berr.Field == "" {
+			return berr
+		}
+		errs = append(errs, berr)
+	}
+	b.Phone = phone
+	// Unless someone else gets the reminders, they go to the number the booking is for.
+	if b.ContactPhone == "" {
+		b.ContactPhone = b.Phone
+	} else {
+		b.ContactPhone, _, berr = a.lookupPhone(ctx, b.ContactPhone, country, phoneTypesFor(b.Channel), "contact_phone", lang)
+		if berr != nil {
+			if berr.Field == "" {
+				return berr
+			}
+			errs = append(errs, berr)
+		}
+	}
+	if len(errs) > 0 {
+		return invalidFields(errs)
+	}
+	// From here on, Country is where Phone really is, so that we can show customers we got their number right.
+	b.Country = phoneCountry
+	b.LookedUp = true
+	if len(b.Phones) > 0 {
+		return a.checkGroupPhones(ctx, b, country, lang)
+	}
+	return nil
+}
 
-	// Serve
-	port := ":8080"
-	log.Println("Serving application on", port)
-	err := http.ListenAndServe(port, nil)
+// lookupPhone checks phone, a number in country unless it starts with a country code, and one of types if there are
+// any. It returns the number in the E.164 format MessageBird gives us, and the country MessageBird says it's in.
+// If the number is no good, the error is about the form field field.
+func (a *app) lookupPhone(ctx context.Context, phone, country string, types []string, field, lang string) (string, string, *bookingError) {
+	// Lookups cost money, so throw out anything that can't possibly be a phone number before we ask MessageBird.
+	if !plausiblePhone(phone) {
+		return phone, country, &bookingError{http.StatusBadRequest, codeInvalidPhone, translate(lang, "invalid_phone"), field, nil}
+	}
+	// The lookup tells us whether the number is valid, and which number it really is.
+	number, err := a.client.Lookup(ctx, phone, &lookup.Params{CountryCode: country})
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Error("Lookup timed out", "phone", maskPhone(phone), "timeout", cfg.APITimeout)
+		return phone, country, &bookingError{http.StatusGatewayTimeout, codeTimeout, translate(lang, "timeout"), "", nil}
+	}
+	// If MessageBird can't look up numbers at all, the number may well be fine. Rather than turn away every booking
+	// until the lookup is back, take numbers in international format as they are, if cfg.LookupFallback allows it.
+	if err != nil && lookupFailed(err) {
+		if !cfg.LookupFallback {
+			slog.Error("Lookup failed", "phone", maskPhone(phone), "err", maskPhones(err.Error()))
+			return phone, country, &bookingError{http.StatusServiceUnavailable, codeLookupUnavailable, translate(lang, "lookup_unavailable"), "", nil}
+		}
+		e164, ok := localE164(phone)
+		if !ok {
+			slog.Warn("Lookup failed; can't check national phone number without it", "phone", maskPhone(phone), "err", maskPhones(err.Error()))
+			return phone, country, &bookingError{http.StatusServiceUnavailable, codeLookupUnavailable, translate(lang, "lookup_unavailable_national"), field, nil}
+		}
+		slog.Warn("Lookup failed; took phone number without checking it", "phone", maskPhone(e164), "err", maskPhones(err.Error()))
+		return e164, country, nil
+	}
 	if err != nil {
-		log.Println(err)
+		return phone, country, &bookingError{http.StatusBadRequest, codeInvalidPhone, translate(lang, "invalid_phone"), field, nil}
+	}
+	// A valid number isn't necessarily one we can text. If the lookup doesn't say what kind it is, give it a go.
+	if number.Type != "" && len(types) > 0 && !slices.Contains(types, number.Type) {
+		slog.Info("Rejected phone number", "phone", maskPhone(phone), "type", number.Type)
+		return phone, country, &bookingError{http.StatusBadRequest, codeNotMobile, translate(lang, "not_mobile"), field, nil}
 	}
+	// The same number can be written in many ways, like "06 12345678" and "+31612345678". Use the E.164 format
+	// MessageBird gives us from here on, so we send, store and rate limit every number the same way.
+	if number.Formats.E164 != "" {
+		phone = number.Formats.E164
+	}
+	// A number in international format can be from anywhere, whatever country the customer picked.
+	if detected, ok := parseCountryCode(number.CountryCode); ok {
+		country = detected
+	}
+	return phone, country, nil
 }
 
-// Routes
-func bbScheduler(w http.ResponseWriter, r *http.Request) {
-	var (
-		loc          *time.Location
-		reminderDiff time.Duration
-		err          error
-	)
-
-	// Set locale. Hardcoding this because you're unlikely to set a beauty appointment across timezones.
-	// Use list in /usr/local/Cellar/go/1.10.3/libexec/lib/time/zoneinfo.zip
-	loc, err = time.LoadLocation("Europe/Amsterdam")
-	if err != nil {
-		log.Println(err)
+// MessageBird error codes.
+const (
+	// mbErrBadRequest is for a request MessageBird can't make sense of, like a lookup of a number that can't exist.
+	mbErrBadRequest = 21
+)
+
+// mbServiceErrors are the MessageBird error codes that are about our account or MessageBird itself, rather than what
+// we asked for: a wrong access key, no balance left, and errors on MessageBird's side.
+var mbServiceErrors = map[int]bool{2: true, 25: true, 98: true, 99: true}
+
+// lookupFailed reports whether err, from a lookup, means that MessageBird couldn't look up the number, like when
+// the lookup API is down or can't be reached, rather than that the number is no good.
+func lookupFailed(err error) bool {
+	var errorResponse messagebird.ErrorResponse
+	if !errors.As(err, &errorResponse) {
+		return true
+	}
+	for _, e := range errorResponse.Errors {
+		if mbServiceErrors[e.Code] {
+			return true
+		}
 	}
+	return false
+}
 
-	// Set a time.Duration value for message scheduling.
-	// Here, we set a 3 hour duration that we will use to subtract from the booking time.
-	reminderDiff, err = time.ParseDuration("3h")
-	if err != nil {
-		log.Println(err)
+// localE164 returns phone in E.164 format, like +31612345678, if it's in international format, starting with + or 00.
+// It's for when MessageBird can't look phone up: it can't tell whether the number exists, or what kind it is.
+func localE164(phone string) (string, bool) {
+	phone = strings.TrimSpace(phone)
+	digits := digitsOnly(phone)
+	switch {
+	case strings.HasPrefix(phone, "+"):
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	default:
+		return "", false
 	}
+	// Country calling codes don't start with 0.
+	if len(digits) < minPhoneDigits || len(digits) > maxPhoneDigits || digits[0] == '0' {
+		return "", false
+	}
+	return "+" + digits, true
+}
 
-	// Initialize &booking with only MinDate values so that we can pass "min" value into <input type="date"/>
-	BookingEmpty := booking{
-		MinDate: time.Now().In(loc).Format("2006-01-02"),
+// validateDetails checks the customer's name, notes and treatment, and cleans up the name and notes with sanitizeText.
+// It returns the chosen treatment, or the zero Treatment if there's no such treatment, and what's wrong with each field.
+func validateDetails(thisBooking *booking, lang string) (Treatment, []*bookingError) {
+	var errs []*bookingError
+	thisBooking.Name = sanitizeText(thisBooking.Name)
+	switch {
+	case thisBooking.Name == "":
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidName, translate(lang, "invalid_name"), "name", nil})
+	case utf8.RuneCountInString(thisBooking.Name) > maxNameLength:
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidName, translate(lang, "name_too_long", maxNameLength), "name", nil})
+	}
+	thisBooking.Notes = sanitizeText(thisBooking.Notes)
+	if utf8.RuneCountInString(thisBooking.Notes) > maxNotesLength {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidNotes, translate(lang, "notes_too_long", maxNotesLength), "notes", nil})
+	}
+	if !thisBooking.Consent {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeConsentRequired, translate(lang, "consent_required"), "consent", nil})
 	}
 
-	// Handle form submission
-	if r.Method == "POST" {
-		r.ParseForm()
+	treatment, ok := findTreatment(thisBooking.Treatment)
+	if !ok {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidTreatment, translate(lang, "invalid_treatment"), "treatment", nil})
+	}
 
-		// Convert r.FormValue("date") to time.Time type.
-		bookingTime, err := time.ParseInLocation("2006-01-02 15:04", r.FormValue("date")+" "+r.FormValue("time"), loc)
-		if err != nil {
-			log.Println(err)
+	// If we have stylists, customers book one of them; if we don't, there's nobody to choose.
+	if len(cfg.Staff) > 0 && !validStaff(thisBooking.Staff) || len(cfg.Staff) == 0 && thisBooking.Staff != "" {
+		errs = append(errs, &bookingError{http.StatusBadRequest, codeInvalidStaff, translate(lang, "invalid_staff"), "staff", nil})
+	}
+	return treatment, errs
+}
+
+// cancelBooking cancels a booking by id or reference, along with any of its reminders that haven't been sent yet.
+func (a *app) cancelBooking(w http.ResponseWriter, r *http.Request) {
+	lang := requestLocale(r)
+	id, token := strings.TrimSpace(r.FormValue("id")), r.FormValue("token")
+	if len(cfg.CancelSecret) > 0 {
+		// The id alone isn't enough: it has to come from a link we signed, and that hasn't expired.
+		var err error
+		if id, err = verifyCancelToken(cfg.CancelSecret, token, a.now()); err != nil {
+			renderPage(w, http.StatusForbidden, "views/cancel.gohtml", bookingContainer{Message: translate(lang, "invalid_cancel_link"), Lang: lang})
+			return
+		}
+	}
+	if r.Method != "POST" {
+		renderPage(w, http.StatusOK, "views/cancel.gohtml", bookingContainer{Booking: booking{ID: id}, Lang: lang, CancelToken: token})
+		return
+	}
+
+	thisBooking, err := findBooking(a.store, id)
+	if err != nil {
+		if err != errBookingNotFound {
+			slog.Error("Couldn't get booking", "booking_id", id, "err", err)
 		}
+		renderPage(w, http.StatusNotFound, "views/cancel.gohtml", bookingContainer{Booking: booking{ID: id}, Message: translate(lang, "booking_not_found"), Lang: lang, CancelToken: token})
+		return
+	}
+	if thisBooking.Cancelled {
+		renderPage(w, http.StatusConflict, "views/cancel.gohtml", bookingContainer{Booking: thisBooking, Message: translate(lang, "already_cancelled"), Lang: lang, CancelToken: token})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+	defer cancel()
+	alreadySent, err := a.cancelReminders(ctx, thisBooking)
+	if err != nil {
+		slog.Error("Couldn't cancel reminders", "booking_id", thisBooking.ID, "err", err)
+		renderPage(w, http.StatusBadGateway, "views/cancel.gohtml", bookingContainer{Booking: thisBooking, Message: translate(lang, "cancel_reminders_failed"), Lang: lang, CancelToken: token})
+		return
+	}
 
-		reminderTime := bookingTime.Add(-reminderDiff)
+	thisBooking.Cancelled = true
+	if err := a.store.Update(thisBooking); err != nil {
+		slog.Error("Couldn't save cancelled booking", "booking_id", thisBooking.ID, "err", err)
+		renderPage(w, http.StatusInternalServerError, "views/cancel.gohtml", bookingContainer{Booking: thisBooking, Message: translate(lang, "cancel_failed"), Lang: lang, CancelToken: token})
+		return
+	}
+	a.offerFreedSlot(ctx, thisBooking)
 
-		// Populate ThisBooking with data to pass back into form.
-		// We can also use this to pass data into a remote database.
-		ThisBooking := booking{
-			Name:        r.FormValue("name"),
-			Treatment:   r.FormValue("treatment"),
-			Phone:       r.FormValue("phone"),
-			BookingTime: &bookingTime,
-			MinDate:     time.Now().In(loc).Format("2006-01-02"),
+	cancelStatus := translate(lang, "cancelled", localTime(thisBooking).Format(translate(lang, "date_format")))
+	if alreadySent {
+		cancelStatus += translate(lang, "cancelled_reminder_sent")
+	}
+	if r.FormValue("series") != "" && thisBooking.SeriesID != "" {
+		cancelled, err := a.cancelSeries(ctx, thisBooking)
+		if err != nil {
+			slog.Error("Couldn't cancel series", "series_id", thisBooking.SeriesID, "err", err)
+			cancelStatus += translate(lang, "cancel_series_failed")
+		} else if cancelled > 0 {
+			cancelStatus += translate(lang, "cancelled_series", cancelled)
 		}
+	}
+	renderPage(w, http.StatusOK, "views/cancel.gohtml", bookingContainer{Booking: thisBooking, Message: cancelStatus, Lang: lang, CancelToken: token})
+}
 
-		// First things first: we'll check if the phone number is valid
-		// We don't need the lookup object; we just need to check if we encounter an error.
-		_, err = lookup.Read(client, r.FormValue("phone"), &lookup.Params{CountryCode: "NL"})
+// cancelReminders cancels every reminder of thisBooking that is still scheduled.
+// Reminders that have already gone out can't be cancelled; alreadySent reports whether there were any.
+func (a *app) cancelReminders(ctx context.Context, thisBooking booking) (alreadySent bool, err error) {
+	for _, messageID := range thisBooking.MessageIDs {
+		sent, err := a.cancelReminder(ctx, thisBooking, messageID)
 		if err != nil {
-			RenderDefaultTemplate(w, "views/booking.gohtml", bookingContainer{ThisBooking, "Please enter a valid phone number."})
-			return
+			return alreadySent, err
 		}
+		alreadySent = alreadySent || sent
+	}
+	return alreadySent, nil
+}
 
-		status := checkTime(w, bookingTime, reminderDiff, loc)
-		if status == "Success!" {
-
-			// Set messages to display
-			successStatus := "Done! We've set up an appointment for you at " + bookingTime.Format("Mon, 02 Jan 2006 3:04 PM") +
-				" for " + r.FormValue("treatment") + ". We'll send a reminder to " + r.FormValue("phone") + " at " + reminderTime.Format("Mon, 02 Jan 2006 3:04 PM") + ". Thanks for using BeautyBird!"
-			reminderMessage := "Gentle reminder: you've got an appointment with BeautyBird at " + bookingTime.Format("Mon, 02 Jan 2006 3:04 PM") + ". See you then!"
-
-			// Create a new message, and schedule it to be sent 3 hours before the booking time.
-			msg, err := sms.Create(
-				client,
-				"BeautyBird",
-				[]string{r.FormValue("phone")},
-				reminderMessage,
-				// Use messagebird.MessageParams to set up a schedule for the reminder SMS.
-				&sms.Params{
-					ScheduledDatetime: reminderTime,
-				},
-			)
-			// If the MessageBird API encounters an error, intercept and render error message instead of breaking the application.
-			if err != nil {
-				log.Println(err)
-				RenderDefaultTemplate(w, "views/booking.gohtml", bookingContainer{ThisBooking, fmt.Sprintln(err) + ". Please check your details and try again!"})
-				return
-			}
+// cancelReminder cancels the reminder of thisBooking with messageID, if it's still scheduled.
+// If it's gone out already, it's left alone, and alreadySent is true.
+func (a *app) cancelReminder(ctx context.Context, thisBooking booking, messageID string) (alreadySent bool, err error) {
+	// The dispatcher only sends the reminders listed in MessageIDs, and none for cancelled bookings, so there's
+	// nothing to cancel; but it may have sent it already.
+	if _, ok := dispatchedReminderTime(messageID); ok {
+		return thisBooking.ReminderStatuses[messageID] != reminderPending, nil
+	}
+	if isLocalReminder(messageID) {
+		return !a.timers.cancel(messageID), nil
+	}
+	return a.deleteScheduledSMS(ctx, messageID)
+}
 
-			// For development logging
-			log.Println(msg)
+// deleteScheduledSMS deletes the SMS with messageID from MessageBird, if it's still scheduled.
+// If it's been sent already, it's left alone, and alreadySent is true.
+func (a *app) deleteScheduledSMS(ctx context.Context, messageID string) (alreadySent bool, err error) {
+	msg, err := a.client.ReadSMS(ctx, messageID)
+	if err != nil {
+		return false, err
+	}
+	if !isScheduled(msg) {
+		return true, nil
+	}
+	_, err = a.client.DeleteSMS(ctx, messageID)
+	return false, err
+}
 
-			RenderDefaultTemplate(w, "views/booking.gohtml", bookingContainer{ThisBooking, successStatus})
-			return
-		} else if status != "" {
-			RenderDefaultTemplate(w, "views/booking.gohtml", bookingContainer{ThisBooking, status})
-			return
+// isScheduled reports whether msg is still waiting to be sent to all of its recipients.
+func isScheduled(msg *sms.Message) bool {
+	for _, recipient := range msg.Recipients.Items {
+		if recipient.Status != "scheduled" {
+			return false
 		}
 	}
-	// By default, render page with BookingEmpty object with no message.
-	RenderDefaultTemplate(w, "views/booking.gohtml", bookingContainer{BookingEmpty, ""})
+	return true
 }
 
-// checkTime checks if the bookingTime is within an acceptable time range, set within this function itself.
-func checkTime(w http.ResponseWriter, bookingTime time.Time, reminderDiff time.Duration, loc *time.Location) string {
-	// Make these easy to access.
-	bookingYear := bookingTime.Year()
-	bookingMonth := bookingTime.Month()
-	bookingDay := bookingTime.Day()
-
-	// Set time references. We need these for time comparisons.
-	openingTime := time.Date(bookingYear, bookingMonth, bookingDay, 9, 0, 0, 0, loc)
-	closingTime := time.Date(bookingYear, bookingMonth, bookingDay, 18, 0, 0, 0, loc)
+// timeError is why checkTime rejected a booking time. Code says what the problem is, and the other fields hold
+// the details needed to explain it: the opening hours on the day of the booking, and how long the treatment takes.
+type timeError struct {
+	Code         errorCode
+	BookingTime  time.Time
+	OpeningTime  time.Time
+	ClosingTime  time.Time
+	Duration     time.Duration
+	ReminderDiff time.Duration
+	MinAdvance   time.Duration
+	Horizon      time.Duration
+	// Slot and Suggestion are set for codeOffSlot: how far apart appointments start, and the nearest start time we'd take.
+	Slot       time.Duration
+	Suggestion time.Time
+}
 
-	// To make sure that we always get the local time
-	now := time.Now().In(loc)
+// checkTime checks if the bookingTime is within an acceptable time range, set by the business hours of branch,
+// that a treatment taking duration will be finished by closing time, and that it starts on a slot of cfg.SlotGranularity.
+// now is the current time; it's a parameter so that tests can check bookings against a fixed clock.
+// If the booking time is acceptable, it returns nothing. Otherwise, it returns every reason it isn't, so that the
+// customer can pick a time that works the first time round, and the earliest time from bookingTime on that we'd
+// take instead, as found by earliestBookingTime. There's no such time for a booking that's too far ahead, or one that's
+// only off the slots, which its timeError suggests the nearest slot for.
+func checkTime(branch Branch, bookingTime time.Time, duration time.Duration, reminderDiff time.Duration, now time.Time) ([]timeError, time.Time) {
+	// Set time references from the branch's business hours, on the branch's date. We need these for time comparisons.
+	bookingTime = bookingTime.In(branch.Timezone)
+	openingTime, closingTime, open := branch.BusinessHours.On(bookingTime)
 
-	//
+	// How long until the booking starts.
 	timeBeforeBooking := bookingTime.Sub(now)
 
+	terr := timeError{
+		BookingTime:  bookingTime,
+		OpeningTime:  openingTime,
+		ClosingTime:  closingTime,
+		Duration:     duration,
+		ReminderDiff: reminderDiff,
+		MinAdvance:   cfg.MinAdvance,
+		Horizon:      cfg.BookingHorizon,
+	}
+	// A time in the past, or further ahead than we take bookings, has to be another day altogether,
+	// so nothing else about it matters.
 	switch {
 	// Check if bookingTime is earlier than the time now.
 	case bookingTime.Before(now):
-		return "Cannot make a booking before now. Please try again!"
+		terr.Code = codeInPast
+		return []timeError{terr}, earliestBookingTime(branch, now, duration, reminderDiff, now)
+	// Check if bookingTime is further ahead than we take bookings.
+	case cfg.BookingHorizon > 0 && timeBeforeBooking > cfg.BookingHorizon:
+		terr.Code = codeTooFar
+		return []timeError{terr}, time.Time{}
+	}
+
+	var terrs []timeError
+	hours := terr
+	switch {
+	// Check if we're open at all on that day.
+	case !open:
+		hours.Code = codeClosedDay
 	// Check if earlier than openingTime.
 	case bookingTime.Before(openingTime):
-		return "We're not open yet! Please book your appointment between " + openingTime.Format("03:04 PM") + " and " + closingTime.Format("03:04 PM") + "."
+		hours.Code = codeBeforeOpening
 	// Check if later than closingTime.
 	case bookingTime.After(closingTime):
-		return "We're closed! Please book your appointment between " + openingTime.Format("03:04 PM") + " and " + closingTime.Format("03:04 PM") + "."
-	// Check if earlier than reminderDiff before closingTime.
-	// Just calling reminderDiff.String() produces output like "3h0m0s",
-	// so we need to split the string and take whatever comes before h.
-	// More granular reminderDiffs will require more complex logic.
-	case timeBeforeBooking < reminderDiff:
-		return "Please book an appointment " + strings.Split(reminderDiff.String(), "h")[0] + " hours in advance."
-	// In all other cases, consider booking a success. Return simple string that can be easily checked for.
+		hours.Code = codeAfterClosing
+	// Check if the treatment would run past closingTime.
+	case bookingTime.Add(duration).After(closingTime):
+		hours.Code = codeRunsPastClosing
+	// Check if it starts on a slot.
+	case cfg.SlotGranularity > 0 && bookingTime.Sub(openingTime)%cfg.SlotGranularity != 0:
+		hours.Code = codeOffSlot
+		hours.Slot = cfg.SlotGranularity
+		hours.Suggestion = nearestSlot(bookingTime, openingTime, closingTime, duration, cfg.SlotGranularity)
+	}
+	if hours.Code != "" {
+		terrs = append(terrs, hours)
+	}
+	// Check if the salon gets too little notice, and, on its own, if there's too little time left to remind
+	// the customer. Those are wrong whatever the opening hours.
+	if timeBeforeBooking < cfg.MinAdvance {
+		notice := terr
+		notice.Code = codeShortNotice
+		terrs = append(terrs, notice)
+	}
+	if timeBeforeBooking < minNotice(reminderDiff) {
+		terr.Code = codeTooSoon
+		terrs = append(terrs, terr)
+	}
+	// In all other cases, consider booking a success.
+	if len(terrs) == 0 || len(terrs) == 1 && terrs[0].Code == codeOffSlot {
+		return terrs, time.Time{}
+	}
+	return terrs, earliestBookingTime(branch, bookingTime, duration, reminderDiff, now)
+}
+
+// minNotice returns how far ahead customers have to book with reminderDiff as their reminder lead: the lead itself,
+// so that there's time to send the reminder, less cfg.LateBookingGrace.
+func minNotice(reminderDiff time.Duration) time.Duration {
+	return max(reminderDiff-cfg.LateBookingGrace, 0)
+}
+
+// maxSuggestionDays is how many days ahead earliestBookingTime looks when there's no cfg.BookingHorizon, so that
+// it gives up on a branch that has closed for good.
+const maxSuggestionDays = 366
+
+// earliestBookingTime returns the earliest time, from after on, that checkTime takes for a treatment taking duration
+// at branch, with reminderDiff as its reminder lead, as of now: a slot of cfg.SlotGranularity, or of
+// defaultSlotMinutes without it, within business hours, and at least minNotice(reminderDiff) and cfg.MinAdvance
+// from now. If we're already past closing time, that's the next day we're open. It returns the zero time if there's none within cfg.BookingHorizon.
+func earliestBookingTime(branch Branch, after time.Time, duration, reminderDiff time.Duration, now time.Time) time.Time {
+	if soonest := now.Add(max(minNotice(reminderDiff), cfg.MinAdvance)); after.Before(soonest) {
+		after = soonest
+	}
+	after = after.In(branch.Timezone)
+	step := cfg.SlotGranularity
+	if step <= 0 {
+		step = defaultSlotMinutes * time.Minute
+	}
+	days := maxSuggestionDays
+	if cfg.BookingHorizon > 0 {
+		days = int(cfg.BookingHorizon.Hours()/24) + 1
+	}
+	for i := 0; i <= days; i++ {
+		day := time.Date(after.Year(), after.Month(), after.Day()+i, 0, 0, 0, 0, branch.Timezone)
+		for _, t := range slotTimes(branch, day, duration, step) {
+			if t.Before(after) {
+				continue
+			}
+			if cfg.BookingHorizon > 0 && t.Sub(now) > cfg.BookingHorizon {
+				return time.Time{}
+			}
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// timeErrorMessage explains to the customer, in the locale lang, why checkTime rejected their booking time.
+func timeErrorMessage(terr timeError, lang string) string {
+	timeFormat := translate(lang, "time_format")
+	switch terr.Code {
+	case codeInPast:
+		return translate(lang, "in_past")
+	case codeTooFar:
+		return translate(lang, "too_far", int(terr.Horizon.Hours()/24))
+	case codeClosedDay:
+		return translate(lang, "closed_day", translate(lang, terr.BookingTime.Weekday().String()))
+	case codeBeforeOpening:
+		return translate(lang, "before_opening", terr.OpeningTime.Format(timeFormat), terr.ClosingTime.Format(timeFormat))
+	case codeAfterClosing:
+		return translate(lang, "after_closing", terr.OpeningTime.Format(timeFormat), terr.ClosingTime.Format(timeFormat))
+	case codeRunsPastClosing:
+		return translate(lang, "runs_past_closing", int(terr.Duration.Minutes()), terr.ClosingTime.Add(-terr.Duration).Format(timeFormat))
+	case codeShortNotice:
+		return translate(lang, "short_notice", formatDuration(terr.MinAdvance, lang))
+	case codeTooSoon:
+		return translate(lang, "too_soon", formatDuration(minNotice(terr.ReminderDiff), lang))
+	case codeOffSlot:
+		return translate(lang, "off_slot", formatDuration(terr.Slot, lang), terr.Suggestion.Format(timeFormat))
 	default:
-		return "Success!"
+		return translate(lang, "invalid_time")
+	}
+}
+
+// parseBookingTime parses a booking form's date, like "2018-08-01", and time, like "14:30", as a time in timezone,
+// in the formats cfg.DateLayout and cfg.TimeLayout.
+// Surrounding spaces are ignored; anything else that isn't a valid date and time is an error. So is a time that doesn't
+// exist in timezone, because the clocks skip it when daylight saving time starts. A time that happens twice, when the
+// clocks go back, is the first of the two.
+func parseBookingTime(date, clock string, timezone *time.Location) (time.Time, error) {
+	layout := cfg.DateLayout + " " + cfg.TimeLayout
+	value := strings.TrimSpace(date) + " " + strings.TrimSpace(clock)
+	t, err := time.ParseInLocation(layout, value, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// A time the clocks skip comes out as another time of day, unlike in UTC, where no time is skipped.
+	wall, _ := time.Parse(layout, value)
+	if t.YearDay() != wall.YearDay() || t.Hour() != wall.Hour() || t.Minute() != wall.Minute() {
+		return time.Time{}, fmt.Errorf("%s doesn't exist in %s", value, timezone)
+	}
+	return t, nil
+}
+
+// validDateLayout reports whether layout, a layout for time.Parse, gives every date a text that parses back to the same
+// date, and to nothing more precise than a day.
+func validDateLayout(layout string) bool {
+	for _, sample := range inputLayoutSamples {
+		t, err := time.Parse(layout, sample.Format(layout))
+		if err != nil || t.Year() != sample.Year() || t.YearDay() != sample.YearDay() || t.Hour() != 0 || t.Minute() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// validTimeLayout reports whether layout, a layout for time.Parse, gives every time of day a text that parses back to the
+// same hour and minute, and that isn't tied to a date.
+func validTimeLayout(layout string) bool {
+	for _, sample := range inputLayoutSamples {
+		t, err := time.Parse(layout, sample.Format(layout))
+		if err != nil || t.Hour() != sample.Hour() || t.Minute() != sample.Minute() || t.Year() != 0 || t.YearDay() != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestSlot returns the start of the slot of size slot closest to bookingTime, counting slots from openingTime.
+// If that slot would run past closingTime for a treatment taking duration, it returns the slot before instead.
+func nearestSlot(bookingTime, openingTime, closingTime time.Time, duration, slot time.Duration) time.Time {
+	earlier := bookingTime.Add(-(bookingTime.Sub(openingTime) % slot))
+	later := earlier.Add(slot)
+	if bookingTime.Sub(earlier) < later.Sub(bookingTime) || later.Add(duration).After(closingTime) {
+		return earlier
+	}
+	return later
+}
+
+// bookableDates returns the first and last dates customers can book, in the format of <input type="date"/>.
+// maxDate is empty if there's no cfg.BookingHorizon.
+func (a *app) bookableDates() (minDate, maxDate string) {
+	now := a.now().In(loc)
+	minDate = now.Format(isoDateLayout)
+	if cfg.BookingHorizon > 0 {
+		maxDate = now.Add(cfg.BookingHorizon).Format(isoDateLayout)
+	}
+	return minDate, maxDate
+}
+
+// parseReminderLead parses a reminder lead time like "1h" or "90m" and checks that it
+// falls between minReminderDiff and maxReminderDiff. Its errors are messages for the customer, in the locale lang.
+func parseReminderLead(lead, lang string) (time.Duration, error) {
+	reminderDiff, err := time.ParseDuration(lead)
+	if err != nil {
+		return 0, errors.New(translate(lang, "invalid_reminder_lead"))
+	}
+	if reminderDiff < minReminderDiff || reminderDiff > maxReminderDiff {
+		return 0, errors.New(translate(lang, "reminder_lead_range", minReminderDiff.Minutes(), maxReminderDiff.Hours()))
+	}
+	return reminderDiff, nil
+}
+
+// reminderDiffFor returns how long before an appointment for treatment its reminder goes out: lead, if the customer
+// chose one, then the treatment's own ReminderLead, and defaultReminderDiff if neither is set. Errors are like parseReminderLead's.
+func reminderDiffFor(lead string, treatment Treatment, lang string) (time.Duration, error) {
+	switch {
+	case lead != "":
+		return parseReminderLead(lead, lang)
+	case treatment.ReminderLead > 0:
+		return treatment.ReminderLead, nil
+	}
+	return defaultReminderDiff, nil
+}
+
+// reminderLeads returns the lead times of all reminders for a booking, earliest first:
+// any earlyReminderDiffs longer than reminderDiff, followed by reminderDiff itself.
+func reminderLeads(reminderDiff time.Duration) []time.Duration {
+	var leads []time.Duration
+	for _, lead := range earlyReminderDiffs {
+		if lead > reminderDiff {
+			leads = append(leads, lead)
+		}
 	}
+	return append(leads, reminderDiff)
+}
+
+// reminderTimeFor returns when the reminder lead before bookingTime is due, at bookingTime's location.
+// Whole days of the lead are counted in calendar days, so that a reminder 24 hours before is at the same time of day
+// the day before, even if daylight saving time starts or ends in between. The rest of the lead is real time:
+// a reminder 3 hours before an appointment at 4:00, on the night the clocks go forward at 2:00, is due at midnight,
+// 3 hours before the appointment, not 4.
+func reminderTimeFor(bookingTime time.Time, lead time.Duration) time.Time {
+	days := int(lead / (24 * time.Hour))
+	return bookingTime.AddDate(0, 0, -days).Add(-(lead % (24 * time.Hour)))
 }
 
 // Helpers
 
 // RenderDefaultTemplate takes:
 // - a http.ResponseWriter
+// - the HTTP status code to respond with
 // - a string that's the path to your template file
 // - data to render to the template. If no data, should enter 'nil'
-func RenderDefaultTemplate(w http.ResponseWriter, thisView string, data interface{}) {
-	renderthis := []string{thisView, "views/layouts/default.gohtml"}
-	t, err := template.ParseFiles(renderthis...)
-	if err != nil {
-		log.Fatal(err)
+// and renders the template in the default layout, with RenderTemplate.
+func RenderDefaultTemplate(w http.ResponseWriter, status int, thisView string, data interface{}) error {
+	return RenderTemplate(w, status, defaultLayout, thisView, data)
+}
+
+// RenderTemplate is RenderDefaultTemplate with a choice of layout: the path to one of layouts.
+// The page is rendered in full before anything is written, so if rendering fails,
+// nothing has been sent yet and the caller can still respond with an error.
+func RenderTemplate(w http.ResponseWriter, status int, layout, thisView string, data interface{}) error {
+	t, ok := templates[thisView]
+	if reloadTemplates {
+		var err error
+		t, err = parseTemplate(thisView)
+		if err != nil {
+			return err
+		}
+	} else if !ok {
+		return fmt.Errorf("no such template: %s", thisView)
+	}
+
+	layoutName := strings.TrimSuffix(filepath.Base(layout), filepath.Ext(layout))
+	if t.Lookup(layoutName) == nil {
+		return fmt.Errorf("no such layout: %s", layout)
+	}
+	var page bytes.Buffer
+	if err := t.ExecuteTemplate(&page, layoutName, data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	// If writing fails, the client has gone away and there's nobody left to tell.
+	page.WriteTo(w)
+	return nil
+}
+
+// renderPage renders thisView in the default layout with RenderTemplate. If that fails, it logs the problem
+// and responds with a plain 500 Internal Server Error instead, so the rest of the application keeps running.
+func renderPage(w http.ResponseWriter, status int, thisView string, data interface{}) {
+	renderPageIn(w, status, defaultLayout, thisView, data)
+}
+
+// renderPageIn is renderPage with a choice of layout.
+func renderPageIn(w http.ResponseWriter, status int, layout, thisView string, data interface{}) {
+	if err := RenderTemplate(w, status, layout, thisView, data); err != nil {
+		slog.Error("Couldn't render page", "view", thisView, "layout", layout, "err", err)
+		http.Error(w, "Sorry, something went wrong on our side. Please try again later.", http.StatusInternalServerError)
+	}
+}
+
+// parseTemplates parses every view in views.
+func parseTemplates() (map[string]*template.Template, error) {
+	parsed := make(map[string]*template.Template, len(views))
+	for _, view := range views {
+		t, err := parseTemplate(view)
+		if err != nil {
+			return nil, err
+		}
+		parsed[view] = t
+	}
+	return parsed, nil
+}
+
+// templateFuncs are the functions available to every template. They return plain values, which html/template escapes
+// like any other: never return template.HTML, template.JS or template.URL here, or customers' names and notes could
+// run as script on our pages.
+var templateFuncs = template.FuncMap{
+	"treatments": func() []Treatment { return cfg.Treatments },
+	"staff":      func() []string { return cfg.Staff },
+	"branches":   func() []Branch { return cfg.Branches },
+	"locales":    func() []locale { return locales },
+	"maskPhone":  maskPhone,
+	"join":       strings.Join,
+	"formatTime": func(b booking) string { return localTime(b).Format("Mon, 02 Jan 2006 3:04 PM") },
+	// reminderSegments and smsCost tell operators how many SMS segments a booking's reminders take, and what they cost.
+	"reminderSegments": reminderSegments,
+	"smsCost":          smsCost,
+	// defaultCountry is the country code we assume for phone numbers without one.
+	"defaultCountry": func() string { return cfg.CountryCode },
+	// datePicker and timePicker report whether the booking form can use the browser's own date and time pickers,
+	// which always send ISO dates and 24-hour times. For other formats, it has text fields.
+	"datePicker": func() bool { return cfg.DateLayout == isoDateLayout },
+	"timePicker": func() bool { return cfg.TimeLayout == isoTimeLayout },
+	// inputDate formats a date like "2018-08-01", as in booking.MinDate, the way customers enter dates.
+	"inputDate": func(date string) string {
+		t, err := time.Parse(isoDateLayout, date)
+		if err != nil {
+			return date
+		}
+		return t.Format(cfg.DateLayout)
+	},
+	// inputDateOf and inputTimeOf write t the way customers enter dates and times, to fill in the booking form with.
+	"inputDateOf": func(t time.Time) string { return t.Format(cfg.DateLayout) },
+	"inputTimeOf": func(t time.Time) string { return t.Format(cfg.TimeLayout) },
+	// inputTimeExample is a time the way customers enter times, like "14:30", for a placeholder.
+	"inputTimeExample": func() string { return time.Date(2018, 8, 1, 14, 30, 0, 0, time.UTC).Format(cfg.TimeLayout) },
+	// slotSeconds is the step of the booking form's time input. It's 60, any minute, if appointments can start at any time.
+	"slotSeconds": func() int { return int(max(cfg.SlotGranularity, time.Minute).Seconds()) },
+	// signedCancelLinks reports whether bookings can only be cancelled with a signed link, not by typing in their id.
+	"signedCancelLinks": func() bool { return len(cfg.CancelSecret) > 0 },
+	// voiceEnabled reports whether customers can choose voice reminders.
+	"voiceEnabled": func() bool { return cfg.VoiceOriginator != "" },
+	// emailEnabled is set by main once we know whether we can send email.
+	"emailEnabled": func() bool { return false },
+}
+
+// parseTemplate parses a single view together with every layout.
+func parseTemplate(thisView string) (*template.Template, error) {
+	return template.New(filepath.Base(thisView)).Funcs(templateFuncs).ParseFiles(append([]string{thisView}, layouts...)...)
+}
+
+// loadConfig sets up cfg with the salon's treatments and staff, and the settings for talking to MessageBird and for
+// when its lookup is down, from the
+// environment. It starts cfg afresh, so main sets the rest of cfg after it, one field at a time.
+func loadConfig() error {
+	cfg = config{
+		// Treatments the salon offers. Durations make sure a treatment is finished by closing time.
+		// A treatment can have its own reminder lead, like a day ahead for colouring, which customers may have to prepare for.
+		Treatments: []Treatment{
+			{Name: "Haircut", Duration: 45 * time.Minute},
+			{Name: "Colouring", Duration: 2 * time.Hour, ReminderLead: 24 * time.Hour},
+			{Name: "Manicure", Duration: 30 * time.Minute},
+			{Name: "Pedicure", Duration: 45 * time.Minute},
+			{Name: "Facial", Duration: time.Hour},
+		},
+	}
+	for _, treatment := range cfg.Treatments {
+		if treatment.Name == "" || treatment.Duration <= 0 {
+			return fmt.Errorf("invalid treatment %+v: every treatment needs a name and a duration", treatment)
+		}
+		if treatment.ReminderLead != 0 && (treatment.ReminderLead < minReminderDiff || treatment.ReminderLead > maxReminderDiff) {
+			return fmt.Errorf("invalid reminder lead for %s: use between %v and %v, or 0 for the default", treatment.Name, minReminderDiff, maxReminderDiff)
+		}
+	}
+	// Stylists, as a comma separated list of names. Without any, the salon is booked as a whole.
+	cfg.Staff = parseStaff(os.Getenv("STAFF"))
+
+	cfg.APITimeout = defaultAPITimeout
+	if timeout := strings.TrimSpace(os.Getenv("MESSAGEBIRD_TIMEOUT")); timeout != "" {
+		var err error
+		if cfg.APITimeout, err = time.ParseDuration(timeout); err != nil || cfg.APITimeout <= 0 {
+			return fmt.Errorf("invalid MESSAGEBIRD_TIMEOUT %q: use a duration, like 10s", timeout)
+		}
+	}
+	// If MessageBird can't look up phone numbers, we take numbers in international format without checking them,
+	// so that an outage doesn't stop bookings. Set LOOKUP_FALLBACK=false to turn bookings away until it's back.
+	cfg.LookupFallback = true
+	if fallback := strings.TrimSpace(os.Getenv("LOOKUP_FALLBACK")); fallback != "" {
+		var err error
+		if cfg.LookupFallback, err = strconv.ParseBool(fallback); err != nil {
+			return fmt.Errorf("invalid LOOKUP_FALLBACK %q: use true or false", fallback)
+		}
+	}
+	return nil
+}
+
+// defaultTimezone is where bookings are made when TZ is not set.
+const defaultTimezone = "Europe/Amsterdam"
+
+// loadTimezone returns the location named tz in the IANA Time Zone database, or defaultTimezone if tz is empty.
+// Surrounding spaces are ignored. A name that isn't in the database is an error.
+func loadTimezone(tz string) (*time.Location, error) {
+	tz = strings.TrimSpace(tz)
+	if tz == "" {
+		tz = defaultTimezone
 	}
-	err = t.ExecuteTemplate(w, "default", data)
+	return time.LoadLocation(tz)
+}
+
+// validListenAddr reports whether addr is an address we can serve on: an optional host, and a port number.
+func validListenAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
 	if err != nil {
-		log.Fatal(err)
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 0 && n <= 65535
+}
+
+// validOriginator reports whether originator is a sender MessageBird accepts:
+// either a phone number of up to 17 digits, optionally starting with a +,
+// or an alphanumeric string of at most 11 characters.
+func validOriginator(originator string) bool {
+	if originator == "" {
+		return false
 	}
+	digits := strings.TrimPrefix(originator, "+")
+	numeric := digits != ""
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			numeric = false
+			break
+		}
+	}
+	if numeric {
+		return len(digits) <= 17
+	}
+
+	if len(originator) > 11 {
+		return false
+	}
+	for _, c := range originator {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Phone numbers have at most 15 digits, not counting the international access code (E.164).
+// The shortest numbers in use, with their country or trunk code, have at least 6.
+const (
+	minPhoneDigits = 6
+	maxPhoneDigits = 15
+)
+
+// plausiblePhone does a quick local check that phone could be a phone number, in international or national format:
+// an optional leading + followed by digits, which may be grouped with spaces, dashes, dots or parentheses.
+// It doesn't tell us whether the number exists; only a lookup can.
+func plausiblePhone(phone string) bool {
+	phone = strings.TrimSpace(phone)
+	international := strings.HasPrefix(phone, "+")
+	for _, c := range strings.TrimPrefix(phone, "+") {
+		if !('0' <= c && c <= '9' || strings.ContainsRune(" -.()", c)) {
+			return false
+		}
+	}
+	digits := digitsOnly(phone)
+	// 00 is the international access code in most countries, so 0031... is the same as +31...
+	if !international && strings.HasPrefix(digits, "00") {
+		digits = digits[2:]
+	}
+	return len(digits) >= minPhoneDigits && len(digits) <= maxPhoneDigits
+}
+
+// envBool reports whether the environment variable name is set to a true value, like "1" or "true".
+func envBool(name string) bool {
+	value, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(name)))
+	return err == nil && value
 }
@@ -0,0 +1,836 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/messagebird/go-rest-api"
+)
+
+func TestMain(m *testing.M) {
+	// The handlers log every booking; the tests check what they do instead.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testNow is the frozen time of the apps newTestApp returns: a Tuesday morning, before opening time.
+var testNow = time.Date(2026, 3, 10, 8, 0, 0, 0, mustLoadLocation("Europe/Amsterdam"))
+
+func mustLoadLocation(name string) *time.Location {
+	l, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// testBranch returns a branch in Amsterdam that's open from 9:00 to 18:00 every day.
+func testBranch() Branch {
+	everyDay := OpeningHours{Open: ClockTime{9, 0}, Close: ClockTime{18, 0}}
+	hours := BusinessHours{Days: map[time.Weekday]OpeningHours{}}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		hours.Days[day] = everyDay
+	}
+	return Branch{Timezone: testNow.Location(), BusinessHours: hours, Originator: defaultOriginator}
+}
+
+// newTestApp returns an app that books with fakeClient and a memory store, at testNow, for testBranch only.
+// It sets cfg and loc for the test, and puts them back after.
+func newTestApp(t *testing.T) (*app, *fakeClient) {
+	t.Helper()
+	oldCfg, oldLoc, oldTemplates := cfg, loc, templates
+	t.Cleanup(func() { cfg, loc, templates = oldCfg, oldLoc, oldTemplates })
+
+	var err error
+	if templates, err = parseTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	loc = testNow.Location()
+	cfg = config{
+		Branches: []Branch{testBranch()},
+		Treatments: []Treatment{
+			{Name: "Haircut", Duration: 45 * time.Minute},
+			{Name: "Colouring", Duration: 2 * time.Hour},
+		},
+		CountryCode: defaultCountryCode,
+		PhoneTypes:  defaultPhoneTypes,
+		APITimeout:  defaultAPITimeout,
+		SalonName:   defaultSalonName,
+		DateLayout:  isoDateLayout,
+		TimeLayout:  isoTimeLayout,
+	}
+	if cfg.Reminder, err = parseMessageTemplate("reminder", defaultReminderTemplate); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeClient{InvalidPhones: map[string]bool{"+31600000000": true}}
+	a := &app{
+		client:      client,
+		store:       newMemoryStore(),
+		now:         func() time.Time { return testNow },
+		timers:      newTimerScheduler(),
+		reschedules: newBookingLocks(),
+	}
+	return a, client
+}
+
+// bookingForm returns the form of a Haircut booked by Jane at 14:00 the day after testNow, with values set or
+// replaced by the pairs in overrides, like "time", "17:30".
+func bookingForm(overrides ...string) url.Values {
+	form := url.Values{
+		"name":      {"Jane"},
+		"treatment": {"Haircut"},
+		"phone":     {"+31612345678"},
+		"date":      {"2026-03-11"},
+		"time":      {"14:00"},
+		"consent":   {"1"},
+	}
+	for i := 0; i+1 < len(overrides); i += 2 {
+		form.Set(overrides[i], overrides[i+1])
+	}
+	return form
+}
+
+// postForm posts form to handler, the way a browser would, with the headers in the pairs in headers, like
+// "Accept", "application/json", and returns the response.
+func postForm(handler http.HandlerFunc, target string, form url.Values, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestBookingSchedulesReminder(t *testing.T) {
+	a, client := newTestApp(t)
+
+	w := postForm(a.bbScheduler, "/", bookingForm())
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	bookingTime := time.Date(2026, 3, 11, 14, 0, 0, 0, loc)
+	// The day before's reminder is due at 14:00 today, and the last one is defaultReminderDiff before.
+	want := []time.Time{bookingTime.AddDate(0, 0, -1), bookingTime.Add(-defaultReminderDiff)}
+	if len(client.Messages) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(client.Messages), len(want))
+	}
+	for i, msg := range client.Messages {
+		if msg.ScheduledDatetime == nil || !msg.ScheduledDatetime.Equal(want[i]) {
+			t.Errorf("reminder %d is scheduled at %v, want %v", i, msg.ScheduledDatetime, want[i])
+		}
+		if len(msg.Recipients.Items) != 1 || msg.Recipients.Items[0].Recipient != 31612345678 {
+			t.Errorf("reminder %d goes to %+v, want +31612345678", i, msg.Recipients.Items)
+		}
+	}
+
+	bookings, err := a.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 || bookings[0].Name != "Jane" || !bookings[0].BookingTime.Equal(bookingTime) {
+		t.Fatalf("got bookings %+v, want Jane's at %v", bookings, bookingTime)
+	}
+	if len(bookings[0].MessageIDs) != len(want) {
+		t.Errorf("booking has reminders %v, want %d", bookings[0].MessageIDs, len(want))
+	}
+}
+
+func TestBookingTurnedDown(t *testing.T) {
+	tests := []struct {
+		name string
+		form url.Values
+		want errorCode
+	}{
+		{"invalid phone", bookingForm("phone", "+31600000000"), codeInvalidPhone},
+		{"before opening", bookingForm("time", "08:30"), codeBeforeOpening},
+		{"after closing", bookingForm("time", "18:30"), codeAfterClosing},
+		{"past closing time", bookingForm("treatment", "Colouring", "time", "17:00"), codeRunsPastClosing},
+		{"in the past", bookingForm("date", "2026-03-09"), codeInPast},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, client := newTestApp(t)
+
+			w := postForm(a.bbScheduler, "/", tt.form, "Accept", "application/json")
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if len(client.Messages) != 0 {
+				t.Errorf("sent %d messages, want none", len(client.Messages))
+			}
+			if bookings, _ := a.store.List(); len(bookings) != 0 {
+				t.Errorf("saved %d bookings, want none", len(bookings))
+			}
+			var response bookingResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Code != tt.want {
+				t.Errorf("got code %q, want %q", response.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailedBookingCancelsItsReminders(t *testing.T) {
+	a, client := newTestApp(t)
+	// The first reminder is scheduled, but the second one fails.
+	client.CreateErr = errFakeInvalidPhone
+	client.CreateErrAfter = 1
+
+	w := postForm(a.bbScheduler, "/", bookingForm(), "Accept", "application/json")
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if len(client.Messages) != 0 {
+		t.Errorf("%d reminders are still scheduled, want none", len(client.Messages))
+	}
+	if len(client.Deleted) != 1 {
+		t.Errorf("cancelled reminders %v, want the one that was scheduled", client.Deleted)
+	}
+	if bookings, _ := a.store.List(); len(bookings) != 0 {
+		t.Errorf("saved %d bookings, want none", len(bookings))
+	}
+
+	// Trying again once MessageBird works schedules one set of reminders, not two.
+	client.CreateErr = nil
+	if w := postForm(a.bbScheduler, "/", bookingForm()); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if len(client.Messages) != 2 {
+		t.Errorf("%d reminders are scheduled, want 2", len(client.Messages))
+	}
+}
+
+func FuzzParseBookingTime(f *testing.F) {
+	oldCfg := cfg
+	f.Cleanup(func() { cfg = oldCfg })
+	// The nights the clocks go forward and back in Amsterdam, the edges of days and months, and text that's nearly right.
+	for _, seed := range [][2]string{
+		{"2026-03-11", "14:00"},
+		{"2026-03-29", "02:30"},
+		{"2026-03-29", "03:00"},
+		{"2026-10-25", "02:30"},
+		{"2026-10-25", "03:00"},
+		{"2026-03-11", "00:00"},
+		{"2026-03-11", "23:59"},
+		{"2026-03-11", "24:00"},
+		{"2026-02-29", "10:00"},
+		{"2028-02-29", "10:00"},
+		{"2026-13-01", "10:00"},
+		{" 2026-03-11 ", " 9:30 "},
+		{"2026-03-11 14:00", ""},
+		{"2026-03-11", "14:00:00"},
+		{"03/11/2026", "2:00 PM"},
+		{"", ""},
+		{"\x00", "\xff"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	branch := testBranch()
+	layouts := [][2]string{{isoDateLayout, isoTimeLayout}, {"01/02/2006", "3:04 PM"}, {"02.01.2006", "15.04"}}
+
+	f.Fuzz(func(t *testing.T, date, clock string) {
+		for _, layout := range layouts {
+			cfg.DateLayout, cfg.TimeLayout = layout[0], layout[1]
+			bookingTime, err := parseBookingTime(date, clock, branch.Timezone)
+			if err != nil {
+				continue
+			}
+			if bookingTime.Location() != branch.Timezone || bookingTime.Second() != 0 || bookingTime.Nanosecond() != 0 {
+				t.Fatalf("%q %q parsed as %v, want a whole minute in %v", date, clock, bookingTime, branch.Timezone)
+			}
+			// Writing it the way we read it gives the same time back.
+			again, err := parseBookingTime(bookingTime.Format(cfg.DateLayout), bookingTime.Format(cfg.TimeLayout), branch.Timezone)
+			if err != nil || !again.Equal(bookingTime) {
+				t.Fatalf("%q %q parsed as %v, which parses back as %v, %v", date, clock, bookingTime, again, err)
+			}
+			// Any time we parse can be checked, and each reason it's turned down has a message to show.
+			terrs, earliest := checkTime(branch, bookingTime, 45*time.Minute, defaultReminderDiff, testNow)
+			for _, berr := range timeErrors(terrs, earliest, "date", defaultLocale) {
+				if berr.Code == "" || berr.Message == "" || berr.Status != http.StatusBadRequest {
+					t.Fatalf("%v is turned down with %+v", bookingTime, berr)
+				}
+			}
+		}
+	})
+}
+
+func FuzzLocalE164(f *testing.F) {
+	for _, seed := range []string{"+31612345678", "0031612345678", " +31 6 1234 5678 ", "+31 (0)6-12.34.56.78", "0612345678", "+0612345678", "+1", "00", "+", "", "+३१६१२३४५६७८"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, phone string) {
+		plausiblePhone(phone)
+		e164, ok := localE164(phone)
+		if !ok {
+			return
+		}
+		if digits := strings.TrimPrefix(e164, "+"); !strings.HasPrefix(e164, "+") || digitsOnly(digits) != digits || digits[0] == '0' ||
+			len(digits) < minPhoneDigits || len(digits) > maxPhoneDigits {
+			t.Fatalf("%q is %q in E.164, which isn't a + and %d to %d digits", phone, e164, minPhoneDigits, maxPhoneDigits)
+		}
+		// It's already in E.164 format, so it stays as it is.
+		if again, ok := localE164(e164); !ok || again != e164 {
+			t.Fatalf("%q is %q in E.164, which is %q, %v", phone, e164, again, ok)
+		}
+		if !plausiblePhone(e164) {
+			t.Fatalf("%q is %q in E.164, which isn't plausible", phone, e164)
+		}
+	})
+}
+
+// script is customer input that would run, if it weren't escaped, wherever a page shows it.
+const script = "<script>alert(1)</script>"
+
+// checkEscaped fails t if body has script in it as it is, rather than escaped.
+func checkEscaped(t *testing.T, body string) {
+	t.Helper()
+	if strings.Contains(body, script) {
+		t.Errorf("page has %s unescaped: %s", script, body)
+	}
+	if !strings.Contains(body, template.HTMLEscapeString(script)) {
+		t.Errorf("page doesn't show %s escaped: %s", script, body)
+	}
+}
+
+func TestRenderedCustomerInputIsEscaped(t *testing.T) {
+	newTestApp(t)
+	cfg.Treatments = append(cfg.Treatments, Treatment{Name: script, Duration: time.Hour})
+	bookingTime := time.Date(2026, 3, 11, 14, 0, 0, 0, loc)
+	b := booking{ID: "0123456789abcdef", Name: script, Notes: script, Treatment: script, Phone: "+31612345678", BookingTime: &bookingTime}
+
+	tests := []struct {
+		view, layout string
+		data         interface{}
+	}{
+		{"views/booking.gohtml", defaultLayout, bookingContainer{Booking: b, Message: script}},
+		{"views/reschedule.gohtml", defaultLayout, bookingContainer{Booking: b, Message: script}},
+		{"views/cancel.gohtml", defaultLayout, bookingContainer{Booking: b, Message: script}},
+		{"views/confirm.gohtml", defaultLayout, confirmPage{Booking: b, Message: script}},
+		{"views/status.gohtml", defaultLayout, bookingStatusPage{Booking: b, Message: script}},
+		{"views/admin/bookings.gohtml", adminLayout, adminBookingsPage{Bookings: []booking{b}, Message: script}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.view, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := RenderTemplate(w, http.StatusOK, tt.layout, tt.view, tt.data); err != nil {
+				t.Fatal(err)
+			}
+			checkEscaped(t, w.Body.String())
+		})
+	}
+}
+
+func TestBookingFormEscapesWhatWasEntered(t *testing.T) {
+	a, _ := newTestApp(t)
+
+	// The booking is turned down, so the form is shown again with what the customer entered.
+	w := postForm(a.bbScheduler, "/", bookingForm("name", script, "notes", script, "treatment", script))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	checkEscaped(t, w.Body.String())
+}
+
+// trustedTypes are the types html/template doesn't escape.
+var trustedTypes = []reflect.Type{
+	reflect.TypeOf(template.HTML("")),
+	reflect.TypeOf(template.HTMLAttr("")),
+	reflect.TypeOf(template.JS("")),
+	reflect.TypeOf(template.JSStr("")),
+	reflect.TypeOf(template.CSS("")),
+	reflect.TypeOf(template.URL("")),
+	reflect.TypeOf(template.Srcset("")),
+}
+
+func TestNoTrustedTemplateTypes(t *testing.T) {
+	for name, fn := range templateFuncs {
+		ft := reflect.TypeOf(fn)
+		for i := 0; i < ft.NumOut(); i++ {
+			if slices.Contains(trustedTypes, ft.Out(i)) {
+				t.Errorf("template function %s returns %v, which html/template doesn't escape", name, ft.Out(i))
+			}
+		}
+	}
+	pages := []interface{}{bookingContainer{}, confirmPage{}, bookingStatusPage{}, adminBookingsPage{}, booking{}}
+	for _, page := range pages {
+		pt := reflect.TypeOf(page)
+		for i := 0; i < pt.NumField(); i++ {
+			if field := pt.Field(i); slices.Contains(trustedTypes, field.Type) {
+				t.Errorf("%v.%s is a %v, which html/template doesn't escape", pt, field.Name, field.Type)
+			}
+		}
+	}
+}
+
+func TestCheckTime(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, testNow.Location())
+	}
+	tests := []struct {
+		name        string
+		bookingTime time.Time
+		duration    time.Duration
+		setup       func()
+		want        []errorCode
+		earliest    time.Time
+	}{
+		{name: "ok", bookingTime: at(11, 14, 0)},
+		{name: "before now", bookingTime: at(9, 14, 0), want: []errorCode{codeInPast}, earliest: at(10, 11, 0)},
+		{name: "beyond the horizon", bookingTime: at(31, 14, 0), setup: func() { cfg.BookingHorizon = 14 * 24 * time.Hour }, want: []errorCode{codeTooFar}},
+		{name: "closed that day", bookingTime: at(15, 14, 0), setup: func() { delete(cfg.Branches[0].BusinessHours.Days, time.Sunday) }, want: []errorCode{codeClosedDay}, earliest: at(16, 9, 0)},
+		{name: "before opening", bookingTime: at(11, 8, 30), want: []errorCode{codeBeforeOpening}, earliest: at(11, 9, 0)},
+		{name: "after closing", bookingTime: at(11, 18, 30), want: []errorCode{codeAfterClosing}, earliest: at(12, 9, 0)},
+		{name: "runs past closing", bookingTime: at(11, 17, 0), duration: 2 * time.Hour, want: []errorCode{codeRunsPastClosing}, earliest: at(12, 9, 0)},
+		{name: "off the slots", bookingTime: at(11, 14, 10), setup: func() { cfg.SlotGranularity = 30 * time.Minute }, want: []errorCode{codeOffSlot}},
+		{name: "inside the advance window", bookingTime: at(10, 14, 0), setup: func() { cfg.MinAdvance = 24 * time.Hour }, want: []errorCode{codeShortNotice}, earliest: at(11, 9, 0)},
+		{name: "too soon to remind", bookingTime: at(10, 10, 0), want: []errorCode{codeTooSoon}, earliest: at(10, 11, 0)},
+		{name: "before opening and too soon", bookingTime: at(10, 8, 30), want: []errorCode{codeBeforeOpening, codeTooSoon}, earliest: at(10, 11, 0)},
+		{name: "short notice and too soon", bookingTime: at(10, 9, 30), setup: func() { cfg.MinAdvance = 24 * time.Hour }, want: []errorCode{codeShortNotice, codeTooSoon}, earliest: at(11, 9, 0)},
+		{name: "late booking grace", bookingTime: at(10, 10, 0), setup: func() { cfg.LateBookingGrace = defaultReminderDiff }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestApp(t)
+			if tt.setup != nil {
+				tt.setup()
+			}
+			duration := tt.duration
+			if duration == 0 {
+				duration = 45 * time.Minute
+			}
+
+			terrs, earliest := checkTime(cfg.Branches[0], tt.bookingTime, duration, defaultReminderDiff, testNow)
+			var got []errorCode
+			for _, terr := range terrs {
+				got = append(got, terr.Code)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if !earliest.Equal(tt.earliest) {
+				t.Errorf("got earliest time %v, want %v", earliest, tt.earliest)
+			}
+		})
+	}
+}
+
+func TestMissingTemplateFailsOneRequest(t *testing.T) {
+	a, _ := newTestApp(t)
+	oldReload := reloadTemplates
+	t.Cleanup(func() { reloadTemplates = oldReload })
+
+	// Reading the views again from a directory without them is like their files going missing while we run.
+	reloadTemplates = true
+	t.Chdir(t.TempDir())
+	w := httptest.NewRecorder()
+	a.bbScheduler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	// The handler returned rather than taking the application down, and the next request is answered as usual.
+	reloadTemplates = false
+	w = httptest.NewRecorder()
+	a.bbScheduler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestBookingWithoutValidTime(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want errorCode
+	}{
+		{"empty date", bookingForm("date", "").Encode(), codeInvalidBookingTime},
+		{"empty time", bookingForm("time", "").Encode(), codeInvalidBookingTime},
+		{"empty date and time", bookingForm("date", "", "time", "").Encode(), codeInvalidBookingTime},
+		{"garbage date", bookingForm("date", "tomorrow").Encode(), codeInvalidBookingTime},
+		{"garbage time", bookingForm("time", "noon").Encode(), codeInvalidBookingTime},
+		{"no such day", bookingForm("date", "2026-02-30").Encode(), codeInvalidBookingTime},
+		{"no such hour", bookingForm("time", "25:00").Encode(), codeInvalidBookingTime},
+		{"malformed form", bookingForm().Encode() + "&date=%zz", codeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, client := newTestApp(t)
+
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			a.bbScheduler(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			var response bookingResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Code != tt.want {
+				t.Errorf("got code %q, want %q", response.Code, tt.want)
+			}
+			// Nothing is looked up or scheduled for a booking we can't make sense of.
+			if len(client.Lookups) != 0 || len(client.Messages) != 0 {
+				t.Errorf("looked up %v and scheduled %d reminders, want nothing", client.Lookups, len(client.Messages))
+			}
+		})
+	}
+}
+
+func TestReminderTimeForAcrossDST(t *testing.T) {
+	amsterdam := testNow.Location()
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, amsterdam)
+	}
+	// Amsterdam's clocks go forward from 2:00 to 3:00 on 29 March 2026, and back from 3:00 to 2:00 on 25 October.
+	tests := []struct {
+		name        string
+		bookingTime time.Time
+		lead        time.Duration
+		want        time.Time
+	}{
+		{"3 hours before, across the clocks going forward", at(time.March, 29, 4), 3 * time.Hour, at(time.March, 29, 0)},
+		{"3 hours before, across the clocks going back", at(time.October, 25, 4), 3 * time.Hour, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"a day before, across the clocks going forward", at(time.March, 29, 10), 24 * time.Hour, at(time.March, 28, 10)},
+		{"a day before, after the clocks went forward", at(time.March, 30, 14), 24 * time.Hour, at(time.March, 29, 14)},
+		{"a day before, across the clocks going back", at(time.October, 25, 10), 24 * time.Hour, at(time.October, 24, 10)},
+		{"a day and 3 hours before", at(time.March, 30, 10), 27 * time.Hour, at(time.March, 29, 7)},
+		{"3 hours before, on an ordinary day", at(time.March, 11, 14), 3 * time.Hour, at(time.March, 11, 11)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reminderTimeFor(tt.bookingTime, tt.lead); !got.Equal(tt.want) {
+				t.Errorf("reminderTimeFor(%v, %v) = %v, want %v", tt.bookingTime, tt.lead, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookingOnDSTChangeSchedulesReminders(t *testing.T) {
+	a, client := newTestApp(t)
+
+	// The day the clocks go forward: the day before's reminder is at 14:00 in winter time, 23 hours before.
+	if w := postForm(a.bbScheduler, "/", bookingForm("date", "2026-03-29")); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	want := []time.Time{time.Date(2026, 3, 28, 14, 0, 0, 0, loc), time.Date(2026, 3, 29, 11, 0, 0, 0, loc)}
+	if len(client.Messages) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(client.Messages), len(want))
+	}
+	for i, msg := range client.Messages {
+		if msg.ScheduledDatetime == nil || !msg.ScheduledDatetime.Equal(want[i]) {
+			t.Errorf("reminder %d is scheduled at %v, want %v", i, msg.ScheduledDatetime, want[i])
+		}
+	}
+}
+
+func TestBookingChecksPhoneType(t *testing.T) {
+	tests := []struct {
+		name       string
+		phoneType  string
+		phoneTypes []string
+		want       errorCode
+	}{
+		{"mobile", "mobile", defaultPhoneTypes, ""},
+		{"fixed line or mobile", "fixed line or mobile", defaultPhoneTypes, ""},
+		{"landline", "fixed line", defaultPhoneTypes, codeNotMobile},
+		{"VoIP", "voip", defaultPhoneTypes, codeNotMobile},
+		{"landline the salon takes", "fixed line", []string{"mobile", "fixed line"}, ""},
+		{"any type", "voip", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, client := newTestApp(t)
+			cfg.PhoneTypes = tt.phoneTypes
+			client.PhoneTypes = map[string]string{"+31612345678": tt.phoneType}
+
+			w := postForm(a.bbScheduler, "/", bookingForm(), "Accept", "application/json")
+			var response bookingResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Code != tt.want {
+				t.Errorf("got code %q, want %q", response.Code, tt.want)
+			}
+			if tt.want == "" {
+				if w.Code != http.StatusOK {
+					t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+				}
+				return
+			}
+			if w.Code != http.StatusBadRequest || response.Field != "phone" {
+				t.Errorf("got status %d for field %q, want %d for phone", w.Code, response.Field, http.StatusBadRequest)
+			}
+			if len(client.Messages) != 0 {
+				t.Errorf("%d reminders are scheduled for a number that can't get them, want none", len(client.Messages))
+			}
+		})
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	tests := []struct {
+		tz   string
+		want string
+	}{
+		{"", defaultTimezone},
+		{" Europe/Berlin ", "Europe/Berlin"},
+		{"America/New_York", "America/New_York"},
+		{"UTC", "UTC"},
+	}
+	for _, tt := range tests {
+		got, err := loadTimezone(tt.tz)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("loadTimezone(%q) = %v, %v, want %s", tt.tz, got, err, tt.want)
+		}
+	}
+	for _, tz := range []string{"Europe/Atlantis", "Amsterdam", "../../etc/passwd", "Europe/Amsterdam\x00"} {
+		if got, err := loadTimezone(tz); err == nil {
+			t.Errorf("loadTimezone(%q) = %v, want an error", tz, got)
+		}
+	}
+}
+
+func TestLoadConfigTimeout(t *testing.T) {
+	newTestApp(t)
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", defaultAPITimeout},
+		{" 3s ", 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Setenv("MESSAGEBIRD_TIMEOUT", tt.env)
+		if err := loadConfig(); err != nil {
+			t.Fatal(err)
+		}
+		// Every call to MessageBird waits this long, so a zero timeout would fail them all before they're answered.
+		if cfg.APITimeout != tt.want {
+			t.Errorf("MESSAGEBIRD_TIMEOUT=%q got timeout %v, want %v", tt.env, cfg.APITimeout, tt.want)
+		}
+	}
+	for _, env := range []string{"10", "-1s", "0s"} {
+		t.Setenv("MESSAGEBIRD_TIMEOUT", env)
+		if err := loadConfig(); err == nil {
+			t.Errorf("MESSAGEBIRD_TIMEOUT=%q got timeout %v, want an error", env, cfg.APITimeout)
+		}
+	}
+}
+
+func TestLoadConfigLookupFallback(t *testing.T) {
+	newTestApp(t)
+	tests := []struct {
+		env  string
+		want bool
+	}{
+		// Unless it's turned off, a lookup outage doesn't stop bookings.
+		{"", true},
+		{"true", true},
+		{" false ", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("LOOKUP_FALLBACK", tt.env)
+		if err := loadConfig(); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.LookupFallback != tt.want {
+			t.Errorf("LOOKUP_FALLBACK=%q got %v, want %v", tt.env, cfg.LookupFallback, tt.want)
+		}
+	}
+	t.Setenv("LOOKUP_FALLBACK", "maybe")
+	if err := loadConfig(); err == nil {
+		t.Error("LOOKUP_FALLBACK=maybe got no error")
+	}
+}
+
+func TestSuggestionAfterClosing(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, testNow.Location())
+	}
+	tests := []struct {
+		name        string
+		now         time.Time
+		bookingTime time.Time
+		setup       func()
+		want        time.Time
+	}{
+		{"already past closing", at(10, 19, 0), at(10, 19, 30), nil, at(11, 9, 0)},
+		{"too late to remind before closing", at(10, 16, 0), at(10, 17, 0), nil, at(11, 9, 0)},
+		{"tomorrow is closed", at(10, 19, 0), at(10, 19, 30), func() { delete(cfg.Branches[0].BusinessHours.Days, time.Wednesday) }, at(12, 9, 0)},
+		{"notice runs into tomorrow", at(10, 19, 0), at(10, 19, 30), func() { cfg.MinAdvance = 16 * time.Hour }, at(11, 11, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestApp(t)
+			if tt.setup != nil {
+				tt.setup()
+			}
+			terrs, earliest := checkTime(cfg.Branches[0], tt.bookingTime, 45*time.Minute, defaultReminderDiff, tt.now)
+			if len(terrs) == 0 {
+				t.Fatal("got no errors, want the booking turned down")
+			}
+			if !earliest.Equal(tt.want) {
+				t.Errorf("got earliest time %v, want %v", earliest, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPISuggestsTomorrowsOpening(t *testing.T) {
+	a, _ := newTestApp(t)
+	a.now = func() time.Time { return time.Date(2026, 3, 10, 19, 0, 0, 0, testNow.Location()) }
+
+	body := `{"name": "Jane", "treatment": "Haircut", "phone": "+31612345678", "booking_time": "2026-03-10T19:30:00+01:00", "consent": true}`
+	r := httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	a.apiBookings(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var response bookingResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 3, 11, 9, 0, 0, 0, testNow.Location())
+	if response.SuggestedTime == nil || !response.SuggestedTime.Equal(want) {
+		t.Errorf("got suggested time %v, want %v", response.SuggestedTime, want)
+	}
+}
+
+func TestLookupDownOrNumberInvalid(t *testing.T) {
+	errUnreachable := errors.New("dial tcp: connection refused")
+	errMessageBirdDown := messagebird.ErrorResponse{Errors: []messagebird.Error{{Code: 99, Description: "internal error"}}}
+	tests := []struct {
+		name       string
+		phone      string
+		lookupErr  error
+		noFallback bool
+		wantStatus int
+		want       errorCode
+	}{
+		{"invalid number", "+31600000000", nil, false, http.StatusBadRequest, codeInvalidPhone},
+		{"lookup unreachable", "+31612345678", errUnreachable, false, http.StatusOK, ""},
+		{"MessageBird down", "+31612345678", errMessageBirdDown, false, http.StatusOK, ""},
+		{"lookup down, national number", "0612345678", errUnreachable, false, http.StatusServiceUnavailable, codeLookupUnavailable},
+		{"lookup down without fallback", "+31612345678", errUnreachable, true, http.StatusServiceUnavailable, codeLookupUnavailable},
+		{"MessageBird down without fallback", "+31612345678", errMessageBirdDown, true, http.StatusServiceUnavailable, codeLookupUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, client := newTestApp(t)
+			cfg.LookupFallback = !tt.noFallback
+			client.LookupErr = tt.lookupErr
+
+			w := postForm(a.bbScheduler, "/", bookingForm("phone", tt.phone), "Accept", "application/json")
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			var response bookingResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Code != tt.want {
+				t.Errorf("got code %q, want %q", response.Code, tt.want)
+			}
+			// Without the lookup, the number is taken as it's written.
+			if tt.want == "" && (len(client.Messages) == 0 || client.Messages[0].Recipients.Items[0].Recipient != 31612345678) {
+				t.Errorf("got reminders %+v, want them sent to +31612345678", client.Messages)
+			}
+			if tt.want != "" && len(client.Messages) != 0 {
+				t.Errorf("%d reminders are scheduled, want none", len(client.Messages))
+			}
+		})
+	}
+}
+
+func TestMinAdvanceApartFromReminderLead(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 10, hour, minute, 0, 0, testNow.Location())
+	}
+	// testNow is 8:00, and the reminder lead is defaultReminderDiff, 3 hours.
+	tests := []struct {
+		name        string
+		minAdvance  time.Duration
+		grace       time.Duration
+		bookingTime time.Time
+		want        []errorCode
+	}{
+		{"both fail", 2 * time.Hour, 0, at(9, 0), []errorCode{codeShortNotice, codeTooSoon}},
+		{"enough notice, too soon to remind", 2 * time.Hour, 0, at(10, 30), []errorCode{codeTooSoon}},
+		{"both pass", 2 * time.Hour, 0, at(12, 0), nil},
+		{"too little notice, time to remind", 5 * time.Hour, 0, at(12, 0), []errorCode{codeShortNotice}},
+		{"longer notice passes", 5 * time.Hour, 0, at(14, 0), nil},
+		// The grace lets late bookings through without a reminder, but not past the salon's notice.
+		{"grace, without notice", 0, defaultReminderDiff, at(9, 0), nil},
+		{"grace, too little notice", 2 * time.Hour, defaultReminderDiff, at(9, 0), []errorCode{codeShortNotice}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestApp(t)
+			cfg.MinAdvance, cfg.LateBookingGrace = tt.minAdvance, tt.grace
+
+			terrs, _ := checkTime(cfg.Branches[0], tt.bookingTime, 45*time.Minute, defaultReminderDiff, testNow)
+			var got []errorCode
+			for _, terr := range terrs {
+				got = append(got, terr.Code)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookingDoneThanksSalon(t *testing.T) {
+	tests := []struct {
+		lang string
+		time string
+		want string
+	}{
+		{"en", "14:00", "Thanks for booking with Salon Jane!"},
+		{"nl", "14:00", "Bedankt dat je bij Salon Jane boekt!"},
+		{"de", "14:00", "Danke, dass du bei Salon Jane buchst!"},
+		// Two hours from now is too soon for a reminder, but within the grace.
+		{"en", "10:00", "Thanks for booking with Salon Jane!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+"/"+tt.time, func(t *testing.T) {
+			a, _ := newTestApp(t)
+			cfg.SalonName = "Salon Jane"
+			cfg.LateBookingGrace = defaultReminderDiff
+
+			w := postForm(a.bbScheduler, "/", bookingForm("lang", tt.lang, "date", "2026-03-10", "time", tt.time), "Accept", "application/json")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			var response bookingResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(response.Message, tt.want) {
+				t.Errorf("got %q, want it to end with %q", response.Message, tt.want)
+			}
+		})
+	}
+}
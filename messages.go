@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Default message templates, used unless REMINDER_TEMPLATE or CONFIRMATION_TEMPLATE are set.
+const (
+	defaultReminderTemplate     = "Gentle reminder: you've got an appointment with {{.Salon}}{{with .Branch}} {{.}}{{end}}{{with .Staff}} ({{.}}){{end}} at {{.Time}}. See you then!{{with .Reference}} Ref: {{.}}.{{end}}{{with .CancelURL}} Can't make it? Cancel here: {{.}}{{end}}"
+	defaultConfirmationTemplate = "Hi {{.Name}}, your {{.Treatment}}{{with .Staff}} with {{.}}{{end}} at {{.Salon}}{{with .Branch}} {{.}}{{end}} on {{.Time}} is booked. Your booking reference is {{.Reference}}.{{with .CancelURL}} To cancel: {{.}}{{end}}"
+)
+
+// defaultReminderTemplates are defaultReminderTemplate in each of our locales, used unless REMINDER_TEMPLATE or the
+// locale's own REMINDER_TEMPLATE_NL and the like are set.
+var defaultReminderTemplates = map[string]string{
+	"en": defaultReminderTemplate,
+	"nl": "Even een herinnering: je hebt een afspraak bij {{.Salon}}{{with .Branch}} {{.}}{{end}}{{with .Staff}} ({{.}}){{end}} op {{.Time}}. Tot dan!{{with .Reference}} Boekingsnr.: {{.}}.{{end}}{{with .CancelURL}} Kun je niet? Annuleer hier: {{.}}{{end}}",
+	"de": "Kleine Erinnerung: Du hast einen Termin bei {{.Salon}}{{with .Branch}} {{.}}{{end}}{{with .Staff}} ({{.}}){{end}} am {{.Time}}. Bis dann!{{with .Reference}} Buchungsnr.: {{.}}.{{end}}{{with .CancelURL}} Du kannst nicht? Hier absagen: {{.}}{{end}}",
+}
+
+// maxMessageSegments is the most SMS segments we send a message in; see smsSegments.
+const maxMessageSegments = 3
+
+// smsEllipsis marks text we shortened. Three dots, because "…" isn't in the GSM 7-bit alphabet,
+// and would make the whole message take a lot more room.
+const smsEllipsis = "..."
+
+// defaultSalonName is the salon name used in messages when SALON_NAME is not set.
+const defaultSalonName = "BeautyBird"
+
+// messageData is what message templates can use.
+type messageData struct {
+	// Name is the customer's name.
+	Name string
+	// Treatment is the treatment they booked.
+	Treatment string
+	// Staff is the stylist they booked, if any.
+	Staff string
+	// Time is the time of the appointment at its branch, formatted for people in the booking's language.
+	Time string
+	// Branch is the name of the branch the appointment is at. It's empty if the salon has a single branch.
+	Branch string
+	// ID is the booking's id.
+	ID string
+	// Reference is the booking's reference, which the customer needs to cancel or reschedule. Bookings from before
+	// we gave out references have none.
+	Reference string
+	// Salon is the name of the salon, cfg.SalonName.
+	Salon string
+	// CancelURL is a signed link that cancels the booking. It's empty unless CANCEL_LINK_SECRET and PUBLIC_URL are set.
+	CancelURL string
+}
+
+// newMessageData returns the data for b's message templates.
+func newMessageData(b booking) messageData {
+	return messageData{
+		Name:      b.Name,
+		Treatment: b.Treatment,
+		Staff:     b.Staff,
+		Branch:    b.Branch,
+		Time:      localTime(b).Format(translate(b.Language, "date_format")),
+		ID:        b.ID,
+		Reference: b.Reference,
+		Salon:     cfg.SalonName,
+		CancelURL: cancelURL(b),
+	}
+}
+
+// parseMessageTemplate parses text as the template of a message. It also renders it once with example data, so that
+// a template that uses a field messageData doesn't have fails right away, instead of when we send the message.
+func parseMessageTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(&strings.Builder{}, messageData{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// renderMessage renders the message template t for b, cut short at maxMessageSegments.
+func renderMessage(t *template.Template, b booking) (string, error) {
+	var text strings.Builder
+	if err := t.Execute(&text, newMessageData(b)); err != nil {
+		return "", err
+	}
+	return shorten(text.String(), maxMessageSegments), nil
+}
+
+// shorten returns text, or if it takes more than maxSegments SMS segments, as much of it as fits with smsEllipsis.
+func shorten(text string, maxSegments int) string {
+	if smsSegments(text) <= maxSegments {
+		return text
+	}
+	runes := []rune(text)
+	// No part of a longer message holds more than gsm7MultiSegment characters, so start there and drop characters until it fits.
+	keep := min(len(runes), maxSegments*gsm7MultiSegment) - len(smsEllipsis)
+	for keep > 0 && smsSegments(string(runes[:keep])+smsEllipsis) > maxSegments {
+		keep--
+	}
+	return string(runes[:keep]) + smsEllipsis
+}
+
+// sanitizeText cleans up text a customer entered, before it goes into our messages: it replaces control characters,
+// like newlines, with spaces, and collapses each run of spaces into one, so that it can't change the layout of a message.
+func sanitizeText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// reminderTemplate returns the template of reminders in the locale lang, or of the salon's default reminders if
+// there's none for lang.
+func reminderTemplate(lang string) *template.Template {
+	if t, ok := cfg.Reminders[lang]; ok {
+		return t
+	}
+	return cfg.Reminder
+}
+
+// fitName returns b's name, shortened if that's what it takes to make b's reminder fit in a single SMS.
+// Even if the reminder doesn't fit anyway, we keep at least the first letter of the name.
+func fitName(b booking) string {
+	t := reminderTemplate(b.Language)
+	if t == nil {
+		return b.Name
+	}
+	fits := func(name string) bool {
+		b.Name = name
+		var text strings.Builder
+		if err := t.Execute(&text, newMessageData(b)); err != nil {
+			// Shortening the name won't help; renderMessage reports the error.
+			return true
+		}
+		return smsSegments(text.String()) <= 1
+	}
+	name := []rune(b.Name)
+	if fits(b.Name) || len(name) <= 1 {
+		return b.Name
+	}
+	keep := max(len(name)-len(smsEllipsis), 1)
+	for keep > 1 && !fits(string(name[:keep])+smsEllipsis) {
+		keep--
+	}
+	return string(name[:keep]) + smsEllipsis
+}
+
+// withNotes returns reminder with the customer's notes added at the end, in the locale lang, if that doesn't make
+// it take more SMS segments. Otherwise, it returns reminder as is: the notes are on the booking anyway.
+func withNotes(reminder, notes, lang string) string {
+	if notes == "" {
+		return reminder
+	}
+	text := reminder + " " + translate(lang, "reminder_note", notes)
+	if smsSegments(text) > smsSegments(reminder) {
+		return reminder
+	}
+	return text
+}
+
+// reminderText returns the text of b's reminders: the template for b's language, with the customer's notes if they fit.
+func reminderText(b booking) (string, error) {
+	text, err := renderMessage(reminderTemplate(b.Language), b)
+	if err != nil {
+		return "", err
+	}
+	return withNotes(text, b.Notes, b.Language), nil
+}
+
+// sendConfirmation sends b's customer an SMS right away to confirm their booking, if cfg.Confirmation is set.
+// The booking stands whether or not the confirmation arrives, so we only log it if sending fails.
+func (a *app) sendConfirmation(ctx context.Context, b booking) {
+	// Customers with voice reminders may well be on a landline, which can't get an SMS.
+	if cfg.Confirmation == nil || b.Channel == channelVoice || a.optedOut(b.ContactPhone) {
+		return
+	}
+	text, err := renderMessage(cfg.Confirmation, b)
+	if err != nil {
+		slog.Error("Couldn't render confirmation", "booking_id", b.ID, "err", err)
+		return
+	}
+	// Without a ScheduledDatetime, MessageBird sends the message right away.
+	msg, err := a.client.CreateSMS(ctx, branchFor(b).Originator, []string{b.ContactPhone}, text, nil)
+	if err != nil {
+		slog.Warn("Couldn't send confirmation", "booking_id", b.ID, "phone", maskPhone(b.ContactPhone), "err", maskPhones(err.Error()))
+		return
+	}
+	slog.Info("Sent confirmation", "booking_id", b.ID, "message_id", msg.ID, "reminder_ids", b.MessageIDs)
+}
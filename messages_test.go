@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+)
+
+// useDefaultReminders sets cfg.Reminders to our own translation of the reminder in each locale, as main does
+// when no REMINDER_TEMPLATE is set.
+func useDefaultReminders(t *testing.T) {
+	t.Helper()
+	cfg.Reminders = make(map[string]*texttemplate.Template)
+	for code, text := range defaultReminderTemplates {
+		var err error
+		if cfg.Reminders[code], err = parseMessageTemplate("reminder_"+code, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRemindersInChosenLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     string
+		language string
+		want     string
+	}{
+		{"form in English", "en", "", "Gentle reminder: "},
+		{"form in Dutch", "nl", "", "Even een herinnering: "},
+		{"form in German", "de", "", "Kleine Erinnerung: "},
+		{"API with a language of its own", "en", "de", "Kleine Erinnerung: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, client := newTestApp(t)
+			useDefaultReminders(t)
+
+			var w *httptest.ResponseRecorder
+			wantStatus := http.StatusOK
+			if tt.language == "" {
+				w = postForm(a.bbScheduler, "/", bookingForm("lang", tt.lang))
+			} else {
+				wantStatus = http.StatusCreated
+				body := `{"name": "Jane", "treatment": "Haircut", "phone": "+31612345678", "booking_time": "2026-03-11T14:00:00+01:00", "consent": true, "language": "` + tt.language + `"}`
+				r := httptest.NewRequest("POST", "/api/bookings", strings.NewReader(body))
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set("Accept-Language", tt.lang)
+				w = httptest.NewRecorder()
+				a.apiBookings(w, r)
+			}
+			if w.Code != wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, wantStatus, w.Body.String())
+			}
+			if len(client.Messages) == 0 {
+				t.Fatal("no reminders are scheduled")
+			}
+			for i, msg := range client.Messages {
+				if !strings.HasPrefix(msg.Body, tt.want) {
+					t.Errorf("reminder %d is %q, want it to start with %q", i, msg.Body, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRemindersFallBackToSalonDefault(t *testing.T) {
+	a, client := newTestApp(t)
+	// An operator's REMINDER_TEMPLATE, without one for Dutch: Dutch customers get it, rather than our translation.
+	var err error
+	if cfg.Reminder, err = parseMessageTemplate("reminder", "See you at {{.Salon}} at {{.Time}}."); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Reminders = nil
+
+	if w := postForm(a.bbScheduler, "/", bookingForm("lang", "nl")); w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	for i, msg := range client.Messages {
+		if !strings.HasPrefix(msg.Body, "See you at "+cfg.SalonName+" at ") {
+			t.Errorf("reminder %d is %q, want the salon's default", i, msg.Body)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/messagebird/go-rest-api"
+	"github.com/messagebird/go-rest-api/balance"
+	"github.com/messagebird/go-rest-api/conversation"
+	"github.com/messagebird/go-rest-api/lookup"
+	"github.com/messagebird/go-rest-api/sms"
+	"github.com/messagebird/go-rest-api/voicemessage"
+)
+
+// messagingClient is the part of the MessageBird API that the application uses.
+// Handlers get it as a dependency, so that they can run against fakeClient instead of the real API.
+// Every call gives up with ctx's error once ctx is done.
+type messagingClient interface {
+	// Lookup checks a phone number, like lookup.Read.
+	Lookup(ctx context.Context, phone string, params *lookup.Params) (*lookup.Lookup, error)
+	// CreateSMS sends or schedules an SMS, like sms.Create.
+	CreateSMS(ctx context.Context, originator string, recipients []string, body string, params *sms.Params) (*sms.Message, error)
+	// ReadSMS returns a previously created SMS, like sms.Read.
+	ReadSMS(ctx context.Context, id string) (*sms.Message, error)
+	// DeleteSMS cancels a scheduled SMS, like sms.Delete.
+	DeleteSMS(ctx context.Context, id string) (*sms.Message, error)
+	// StartConversation sends a message on a channel such as WhatsApp, like conversation.Start.
+	StartConversation(ctx context.Context, req *conversation.StartRequest) (*conversation.Conversation, error)
+	// CreateVoiceMessage calls recipients and reads out body, like voicemessage.Create.
+	CreateVoiceMessage(ctx context.Context, recipients []string, body string, params *voicemessage.Params) (*voicemessage.VoiceMessage, error)
+	// Balance returns what's left on the account, like balance.Read.
+	Balance(ctx context.Context) (*balance.Balance, error)
+}
+
+// mbClient is a messagingClient that calls the MessageBird REST API.
+type mbClient struct {
+	client *messagebird.Client
+}
+
+// newMBClient returns an mbClient using accessKey. No request to MessageBird takes longer than timeout.
+func newMBClient(accessKey string, timeout time.Duration) mbClient {
+	client := messagebird.New(accessKey)
+	client.HTTPClient = &http.Client{Timeout: timeout}
+	return mbClient{client}
+}
+
+func (c mbClient) Lookup(ctx context.Context, phone string, params *lookup.Params) (*lookup.Lookup, error) {
+	return withContext(ctx, func() (*lookup.Lookup, error) {
+		return lookup.Read(c.client, phone, params)
+	})
+}
+
+func (c mbClient) CreateSMS(ctx context.Context, originator string, recipients []string, body string, params *sms.Params) (*sms.Message, error) {
+	return withContext(ctx, func() (*sms.Message, error) {
+		return sms.Create(c.client, originator, recipients, body, params)
+	})
+}
+
+func (c mbClient) ReadSMS(ctx context.Context, id string) (*sms.Message, error) {
+	return withContext(ctx, func() (*sms.Message, error) {
+		return sms.Read(c.client, id)
+	})
+}
+
+func (c mbClient) DeleteSMS(ctx context.Context, id string) (*sms.Message, error) {
+	return withContext(ctx, func() (*sms.Message, error) {
+		return sms.Delete(c.client, id)
+	})
+}
+
+func (c mbClient) StartConversation(ctx context.Context, req *conversation.StartRequest) (*conversation.Conversation, error) {
+	return withContext(ctx, func() (*conversation.Conversation, error) {
+		return conversation.Start(c.client, req)
+	})
+}
+
+func (c mbClient) CreateVoiceMessage(ctx context.Context, recipients []string, body string, params *voicemessage.Params) (*voicemessage.VoiceMessage, error) {
+	return withContext(ctx, func() (*voicemessage.VoiceMessage, error) {
+		return voicemessage.Create(c.client, recipients, body, params)
+	})
+}
+
+func (c mbClient) Balance(ctx context.Context) (*balance.Balance, error) {
+	return withContext(ctx, func() (*balance.Balance, error) {
+		return balance.Read(c.client)
+	})
+}
+
+// withContext runs call, and returns its result, or ctx's error if ctx is done first.
+// The MessageBird client can't cancel a request, so call keeps running after we stop waiting for it,
+// until the client's own timeout ends it.
+func withContext[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
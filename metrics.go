@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/messagebird/go-rest-api/balance"
+	"github.com/messagebird/go-rest-api/conversation"
+	"github.com/messagebird/go-rest-api/lookup"
+	"github.com/messagebird/go-rest-api/sms"
+	"github.com/messagebird/go-rest-api/voicemessage"
+)
+
+// Booking outcomes, as counted in bookings_total.
+const (
+	outcomeBooked  = "booked"
+	outcomeDryRun  = "dry_run"
+	outcomeInvalid = "invalid"
+	outcomeFailed  = "failed"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of the MessageBird latency histogram.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics counts what the application does, for Prometheus to scrape from /metrics.
+// A nil *metrics counts nothing, so that metrics can be turned off without checking everywhere.
+type metrics struct {
+	mu        sync.Mutex
+	bookings  map[string]int64
+	smsErrors int64
+	latency   map[string]*histogram
+}
+
+type histogram struct {
+	// counts[i] is the number of observations in latencyBuckets[i]; the last one is for everything above them.
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{bookings: make(map[string]int64), latency: make(map[string]*histogram)}
+}
+
+// booking counts a booking request that ended with berr, or that went through if berr is nil.
+// Requests the customer can fix, such as an invalid phone number or a time we're closed, count as invalid;
+// errors on our side, or MessageBird's, count as failed.
+func (m *metrics) booking(berr *bookingError, dryRun bool) {
+	if m == nil {
+		return
+	}
+	outcome := outcomeBooked
+	switch {
+	case berr != nil && berr.Status >= 500:
+		outcome = outcomeFailed
+	case berr != nil:
+		outcome = outcomeInvalid
+	case dryRun:
+		outcome = outcomeDryRun
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bookings[outcome]++
+}
+
+// call records that a MessageBird call op took d, and whether it failed.
+func (m *metrics) call(op string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil && op == "create_sms" {
+		m.smsErrors++
+	}
+	h, ok := m.latency[op]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(latencyBuckets)+1)}
+		m.latency[op] = h
+	}
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+// serveMetrics writes the metrics in the Prometheus text format.
+func (m *metrics) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP bookings_total Booking requests, by outcome: booked, dry_run, invalid or failed.")
+	fmt.Fprintln(w, "# TYPE bookings_total counter")
+	for _, outcome := range []string{outcomeBooked, outcomeDryRun, outcomeInvalid, outcomeFailed} {
+		fmt.Fprintf(w, "bookings_total{outcome=%q} %d\n", outcome, m.bookings[outcome])
+	}
+
+	fmt.Fprintln(w, "# HELP sms_send_errors_total SMS that MessageBird wouldn't send or schedule, counting each attempt.")
+	fmt.Fprintln(w, "# TYPE sms_send_errors_total counter")
+	fmt.Fprintf(w, "sms_send_errors_total %d\n", m.smsErrors)
+
+	fmt.Fprintln(w, "# HELP messagebird_request_duration_seconds How long MessageBird API calls take, by operation.")
+	fmt.Fprintln(w, "# TYPE messagebird_request_duration_seconds histogram")
+	ops := make([]string, 0, len(m.latency))
+	for op := range m.latency {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		m.latency[op].write(w, "messagebird_request_duration_seconds", op)
+	}
+}
+
+// write writes h in the Prometheus text format, as the histogram name with the label op.
+func (h *histogram) write(w io.Writer, name, op string) {
+	var cumulative int64
+	for i, bound := range latencyBuckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{op=%q,le=%q} %d\n", name, op, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{op=%q,le=\"+Inf\"} %d\n", name, op, h.count)
+	fmt.Fprintf(w, "%s_sum{op=%q} %g\n", name, op, h.sum)
+	fmt.Fprintf(w, "%s_count{op=%q} %d\n", name, op, h.count)
+}
+
+// instrumentedClient is a messagingClient that records how long each call to client takes in metrics.
+type instrumentedClient struct {
+	client  messagingClient
+	metrics *metrics
+}
+
+func (c instrumentedClient) Lookup(ctx context.Context, phone string, params *lookup.Params) (*lookup.Lookup, error) {
+	start := time.Now()
+	number, err := c.client.Lookup(ctx, phone, params)
+	c.metrics.call("lookup", time.Since(start), err)
+	return number, err
+}
+
+func (c instrumentedClient) CreateSMS(ctx context.Context, originator string, recipients []string, body string, params *sms.Params) (*sms.Message, error) {
+	start := time.Now()
+	msg, err := c.client.CreateSMS(ctx, originator, recipients, body, params)
+	c.metrics.call("create_sms", time.Since(start), err)
+	return msg, err
+}
+
+func (c instrumentedClient) ReadSMS(ctx context.Context, id string) (*sms.Message, error) {
+	start := time.Now()
+	msg, err := c.client.ReadSMS(ctx, id)
+	c.metrics.call("read_sms", time.Since(start), err)
+	return msg, err
+}
+
+func (c instrumentedClient) DeleteSMS(ctx context.Context, id string) (*sms.Message, error) {
+	start := time.Now()
+	msg, err := c.client.DeleteSMS(ctx, id)
+	c.metrics.call("delete_sms", time.Since(start), err)
+	return msg, err
+}
+
+func (c instrumentedClient) StartConversation(ctx context.Context, req *conversation.StartRequest) (*conversation.Conversation, error) {
+	start := time.Now()
+	conv, err := c.client.StartConversation(ctx, req)
+	c.metrics.call("start_conversation", time.Since(start), err)
+	return conv, err
+}
+
+func (c instrumentedClient) CreateVoiceMessage(ctx context.Context, recipients []string, body string, params *voicemessage.Params) (*voicemessage.VoiceMessage, error) {
+	start := time.Now()
+	msg, err := c.client.CreateVoiceMessage(ctx, recipients, body, params)
+	c.metrics.call("create_voice_message", time.Since(start), err)
+	return msg, err
+}
+
+func (c instrumentedClient) Balance(ctx context.Context) (*balance.Balance, error) {
+	start := time.Now()
+	b, err := c.client.Balance(ctx)
+	c.metrics.call("balance", time.Since(start), err)
+	return b, err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Keywords customers can text us to stop and restart our text messages.
+const (
+	keywordStop  = "STOP"
+	keywordStart = "START"
+)
+
+// OptOuts keeps the phone numbers whose owners asked us to stop texting them. Numbers are compared by their digits
+// only, so "+31612345678" and "31612345678", the way MessageBird sends us a sender's number, are the same.
+type OptOuts interface {
+	// OptOut records that phone doesn't want our text messages anymore, as of at.
+	OptOut(phone string, at time.Time) error
+	// OptIn takes phone off the list again.
+	OptIn(phone string) error
+	// OptedOut reports whether phone has opted out.
+	OptedOut(phone string) (bool, error)
+}
+
+// memoryOptOuts is an OptOuts that keeps numbers in memory. They're lost when the application stops.
+type memoryOptOuts struct {
+	mu      sync.Mutex
+	numbers map[string]time.Time
+}
+
+func newMemoryOptOuts() *memoryOptOuts {
+	return &memoryOptOuts{numbers: make(map[string]time.Time)}
+}
+
+func (o *memoryOptOuts) OptOut(phone string, at time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.numbers[digitsOnly(phone)] = at
+	return nil
+}
+
+func (o *memoryOptOuts) OptIn(phone string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.numbers, digitsOnly(phone))
+	return nil
+}
+
+func (o *memoryOptOuts) OptedOut(phone string) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, ok := o.numbers[digitsOnly(phone)]
+	return ok, nil
+}
+
+// optedOut reports whether phone has opted out of our text messages. If we can't tell, we'd rather not text them.
+func (a *app) optedOut(phone string) bool {
+	if a.optOuts == nil {
+		return false
+	}
+	optedOut, err := a.optOuts.OptedOut(phone)
+	if err != nil {
+		slog.Error("Couldn't check opt-out", "phone", maskPhone(phone), "err", err)
+		return true
+	}
+	return optedOut
+}
+
+// stopTexting opts sender out of our text messages, and deletes the SMS reminders we've scheduled for their upcoming
+// bookings. The bookings themselves stand, and so do reminders on other channels.
+func (a *app) stopTexting(ctx context.Context, sender string) error {
+	if err := a.optOuts.OptOut(sender, a.now()); err != nil {
+		return err
+	}
+	slog.Info("Opted out", "phone", maskPhone(sender))
+
+	bookings, err := a.store.List()
+	if err != nil {
+		return err
+	}
+	now := a.now()
+	for _, b := range bookings {
+		if b.Cancelled || b.BookingTime.Before(now) {
+			continue
+		}
+		// The rest of the group still gets the reminders of a booking someone was in.
+		if !samePhone(b.ContactPhone, sender) {
+			if containsPhone(b.Phones, sender) {
+				if err := a.leaveGroup(ctx, b, sender); err != nil {
+					slog.Error("Couldn't take opted out number off group booking", "booking_id", b.ID, "err", maskPhones(err.Error()))
+				}
+			}
+			continue
+		}
+		for _, messageID := range b.MessageIDs {
+			if isLocalReminder(messageID) {
+				continue
+			}
+			if _, err := a.deleteScheduledSMS(ctx, messageID); err != nil {
+				// They're opted out, so nothing new goes out; a reminder we couldn't delete might still.
+				slog.Error("Couldn't delete reminder after opt-out", "booking_id", b.ID, "message_id", messageID, "err", maskPhones(err.Error()))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// brokenOptOuts is an OptOuts whose store is down.
+type brokenOptOuts struct{}
+
+var errOptOutsDown = errors.New("opt-outs are down")
+
+func (brokenOptOuts) OptOut(string, time.Time) error { return errOptOutsDown }
+func (brokenOptOuts) OptIn(string) error             { return errOptOutsDown }
+func (brokenOptOuts) OptedOut(string) (bool, error)  { return false, errOptOutsDown }
+
+func TestOptOutCheckFailureSchedulesNothing(t *testing.T) {
+	a, client := newTestApp(t)
+	a.optOuts = brokenOptOuts{}
+
+	w := postForm(a.bbScheduler, "/", bookingForm(), "Accept", "application/json")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	var response bookingResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing was scheduled yet, so the customer mustn't be told that their reminders were.
+	if response.Code != codeInternal || response.Error != translate(defaultLocale, "internal_error") {
+		t.Errorf("got %q: %q, want %q", response.Code, response.Error, codeInternal)
+	}
+	if len(client.Messages) != 0 {
+		t.Errorf("%d reminders are scheduled, want none", len(client.Messages))
+	}
+}
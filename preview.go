@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// previewResponse is what /preview returns: the reminder a booking would get, and what it takes to send it.
+type previewResponse struct {
+	Text          string  `json:"text"`
+	Segments      int     `json:"segments"`
+	EstimatedCost float64 `json:"estimated_cost,omitempty"`
+}
+
+// previewReminder returns, as JSON, the reminder that a booking made with the booking form's fields would get,
+// without booking anything or spending a lookup. It's for operators tuning REMINDER_TEMPLATE: the text is rendered
+// with reminderText, like the reminders we schedule, so what it shows is what customers get.
+func (a *app) previewReminder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, bookingResponse{Error: "Use GET or POST to preview a reminder.", Code: codeInvalidRequest})
+		return
+	}
+	lang := requestLocale(r)
+	b, _, _, berr := bookingFromForm(r, lang)
+	if berr != nil {
+		writeJSON(w, berr.Status, errorResponse(berr))
+		return
+	}
+	// Nothing is booked, so there's nothing for the customer to consent to.
+	b.Consent = true
+	if _, errs := validateDetails(&b, lang); len(errs) > 0 {
+		berr := invalidFields(errs)
+		writeJSON(w, berr.Status, errorResponse(berr))
+		return
+	}
+	branch, ok := findBranch(b.Branch)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, errorResponse(&bookingError{http.StatusBadRequest, codeInvalidBranch, translate(lang, "invalid_branch"), "branch", nil}))
+		return
+	}
+	b.Branch = branch.Name
+	bookingTime := b.BookingTime.In(branch.Timezone)
+	b.BookingTime = &bookingTime
+	// The reminder is in the language the booking would be made in.
+	b.Language = lang
+	b.Name = fitName(b)
+	// The booking has no id yet, but the reminder may show it, or link to it. Use a made-up one that's just as long.
+	id, err := newBookingID()
+	if err != nil {
+		slog.Error("Couldn't make booking id", "err", err)
+		writeJSON(w, http.StatusInternalServerError, bookingResponse{Error: "Sorry, something went wrong on our side. Please try again later."})
+		return
+	}
+	b.ID = id
+
+	text, err := reminderText(b)
+	if err != nil {
+		slog.Error("Couldn't render reminder", "err", err)
+		writeJSON(w, http.StatusInternalServerError, bookingResponse{Error: "We couldn't render the reminder. Please check REMINDER_TEMPLATE."})
+		return
+	}
+	segments := smsSegments(text)
+	writeJSON(w, http.StatusOK, previewResponse{Text: text, Segments: segments, EstimatedCost: smsCost(segments)})
+}
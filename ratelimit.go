@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter limits how often each key, like a phone number, can be used. Implementations are token buckets with
+// a bucket per key. Each bucket holds up to limit tokens, and refills at limit tokens per window, so a key can be used
+// limit times in a burst and limit times per window after that.
+type RateLimiter interface {
+	// Allow takes a token from the bucket for key at time now, and reports whether there was one to take.
+	Allow(key string, now time.Time) (bool, error)
+}
+
+// memoryRateLimiter is a RateLimiter that keeps its buckets in memory, so each instance of the application
+// has its own. See redisRateLimiter for one that instances share.
+type memoryRateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	// updated is when tokens was last brought up to date.
+	updated time.Time
+}
+
+func newMemoryRateLimiter(limit int, window time.Duration) *memoryRateLimiter {
+	return &memoryRateLimiter{limit: limit, window: window, buckets: make(map[string]*bucket)}
+}
+
+func (l *memoryRateLimiter) Allow(key string, now time.Time) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, nil
+	}
+	b.tokens--
+	return true, nil
+}
+
+// refill returns how many tokens b holds at time now.
+func (l *memoryRateLimiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.updated).Seconds()*float64(l.limit)/l.window.Seconds()
+	if tokens > float64(l.limit) {
+		return float64(l.limit)
+	}
+	return tokens
+}
+
+// sweep forgets buckets that have filled up again, since they're no different from a new bucket.
+// It runs at most once per window, so that the buckets of numbers we never see again don't pile up.
+func (l *memoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.limit) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix starts every key we keep in Redis, so that the application can share a Redis server with others.
+const redisKeyPrefix = "reminders:"
+
+// Keys of what a redisStore keeps. Each booking is a JSON string under redisBookingKey; the others index them.
+const (
+	// redisBookingsKey is a list of the ids of every booking, in the order they were saved.
+	redisBookingsKey = redisKeyPrefix + "bookings"
+	// redisMessageIDsKey is a hash from each reminder's message id to the id of its booking.
+	redisMessageIDsKey = redisKeyPrefix + "message_ids"
+	// redisReferencesKey is a hash from each booking's reference to its id.
+	redisReferencesKey = redisKeyPrefix + "references"
+	// redisMovesKey counts the bookings UpdateIfAvailable moved. Moving a booking leaves redisBookingsKey as it is,
+	// so SaveIfAvailable and UpdateIfAvailable watch this too, to notice each other.
+	redisMovesKey    = redisKeyPrefix + "moves"
+	redisWaitlistKey = redisKeyPrefix + "waitlist"
+	redisOptOutsKey  = redisKeyPrefix + "opt_outs"
+)
+
+func redisBookingKey(id string) string {
+	return redisKeyPrefix + "booking:" + id
+}
+
+// redisSMSUsageKey is the key of the number of SMS segments sent on day.
+func redisSMSUsageKey(day string) string {
+	return redisKeyPrefix + "sms_usage:" + day
+}
+
+// redisStore is a Store that keeps bookings in Redis, so that every instance of the application behind a load
+// balancer sees the same bookings. Like sqlStore, it can keep the waitlist and opt-outs in the same place.
+type redisStore struct {
+	client *redis.Client
+}
+
+// newRedisStore connects to the Redis server at url, like redis://localhost:6379/0.
+func newRedisStore(url string) (*redisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &redisStore{client: client}, nil
+}
+
+// redisBooking is how a booking is stored in Redis: as JSON, with the fields the API leaves out.
+type redisBooking struct {
+	booking
+	MessageIDs      []string `json:"message_ids,omitempty"`
+	StaleMessageIDs []string `json:"stale_message_ids,omitempty"`
+}
+
+func marshalBooking(b booking) ([]byte, error) {
+	return json.Marshal(redisBooking{booking: b, MessageIDs: b.MessageIDs, StaleMessageIDs: b.StaleMessageIDs})
+}
+
+func unmarshalBooking(data []byte) (booking, error) {
+	var r redisBooking
+	if err := json.Unmarshal(data, &r); err != nil {
+		return booking{}, err
+	}
+	r.booking.MessageIDs, r.booking.StaleMessageIDs = r.MessageIDs, r.StaleMessageIDs
+	return r.booking, nil
+}
+
+func (s *redisStore) Save(b booking) (string, error) {
+	if b.ID == "" {
+		id, err := newBookingID()
+		if err != nil {
+			return "", err
+		}
+		b.ID = id
+	}
+	data, err := marshalBooking(b)
+	if err != nil {
+		return "", err
+	}
+	ctx := context.Background()
+	if b.Reference != "" {
+		claimed, err := s.client.HSetNX(ctx, redisReferencesKey, b.Reference, b.ID).Result()
+		if err != nil {
+			return "", err
+		}
+		if !claimed {
+			return "", errReferenceTaken
+		}
+	}
+	saved, err := s.client.SetNX(ctx, redisBookingKey(b.ID), data, 0).Result()
+	if err == nil && !saved {
+		err = fmt.Errorf("booking %s already exists", b.ID)
+	}
+	if err != nil {
+		if b.Reference != "" {
+			s.client.HDel(ctx, redisReferencesKey, b.Reference)
+		}
+		return "", err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, redisBookingsKey, b.ID)
+		if len(b.MessageIDs) > 0 {
+			pipe.HSet(ctx, redisMessageIDsKey, messageIndex(b)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return b.ID, nil
+}
+
+// redisSaveAttempts is how many times SaveIfAvailable and UpdateIfAvailable check a booking again when other bookings
+// keep being saved or moved while they do.
+const redisSaveAttempts = 10
+
+func (s *redisStore) SaveIfAvailable(b booking, available func([]booking) bool) (bool, error) {
+	data, err := marshalBooking(b)
+	if err != nil {
+		return false, err
+	}
+	ctx := context.Background()
+	for attempt := 0; attempt < redisSaveAttempts; attempt++ {
+		saved := false
+		// Every save adds to redisBookingsKey, so watching it makes the transaction fail if another booking is saved
+		// after we list them. Then we list them, and check, again. Save claims a reference before it adds to
+		// redisBookingsKey, so watch redisReferencesKey too.
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			exists, err := tx.Exists(ctx, redisBookingKey(b.ID)).Result()
+			if err != nil {
+				return err
+			}
+			if exists > 0 {
+				return fmt.Errorf("booking %s already exists", b.ID)
+			}
+			if b.Reference != "" {
+				taken, err := tx.HExists(ctx, redisReferencesKey, b.Reference).Result()
+				if err != nil {
+					return err
+				}
+				if taken {
+					return errReferenceTaken
+				}
+			}
+			bookings, err := listBookings(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if !available(bookings) {
+				return nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, redisBookingKey(b.ID), data, 0)
+				pipe.RPush(ctx, redisBookingsKey, b.ID)
+				if len(b.MessageIDs) > 0 {
+					pipe.HSet(ctx, redisMessageIDsKey, messageIndex(b)...)
+				}
+				if b.Reference != "" {
+					pipe.HSet(ctx, redisReferencesKey, b.Reference, b.ID)
+				}
+				return nil
+			})
+			saved = err == nil
+			return err
+		}, redisBookingsKey, redisMovesKey, redisReferencesKey, redisBookingKey(b.ID))
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return saved, err
+	}
+	return false, fmt.Errorf("other bookings kept being saved while saving booking %s", b.ID)
+}
+
+func (s *redisStore) UpdateIfAvailable(b booking, available func([]booking) bool) (bool, error) {
+	data, err := marshalBooking(b)
+	if err != nil {
+		return false, err
+	}
+	ctx := context.Background()
+	for attempt := 0; attempt < redisSaveAttempts; attempt++ {
+		updated := false
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			oldData, err := tx.Get(ctx, redisBookingKey(b.ID)).Bytes()
+			if errors.Is(err, redis.Nil) {
+				return errBookingNotFound
+			}
+			if err != nil {
+				return err
+			}
+			old, err := unmarshalBooking(oldData)
+			if err != nil {
+				return err
+			}
+			bookings, err := listBookings(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if !available(bookings) {
+				return nil
+			}
+			gone := replacedMessageIDs(old, b)
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, redisBookingKey(b.ID), data, 0)
+				if len(gone) > 0 {
+					pipe.HDel(ctx, redisMessageIDsKey, gone...)
+				}
+				if len(b.MessageIDs) > 0 {
+					pipe.HSet(ctx, redisMessageIDsKey, messageIndex(b)...)
+				}
+				pipe.Incr(ctx, redisMovesKey)
+				return nil
+			})
+			updated = err == nil
+			return err
+		}, redisBookingsKey, redisMovesKey, redisBookingKey(b.ID))
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return updated, err
+	}
+	return false, fmt.Errorf("other bookings kept being saved while updating booking %s", b.ID)
+}
+
+// messageIndex returns the fields and values to add to redisMessageIDsKey for b's reminders.
+func messageIndex(b booking) []interface{} {
+	var index []interface{}
+	for _, messageID := range b.MessageIDs {
+		index = append(index, messageID, b.ID)
+	}
+	return index
+}
+
+func (s *redisStore) Get(id string) (booking, error) {
+	data, err := s.client.Get(context.Background(), redisBookingKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return booking{}, errBookingNotFound
+	}
+	if err != nil {
+		return booking{}, err
+	}
+	return unmarshalBooking(data)
+}
+
+func (s *redisStore) GetByReference(reference string) (booking, error) {
+	if reference == "" {
+		return booking{}, errBookingNotFound
+	}
+	id, err := s.client.HGet(context.Background(), redisReferencesKey, reference).Result()
+	if errors.Is(err, redis.Nil) {
+		return booking{}, errBookingNotFound
+	}
+	if err != nil {
+		return booking{}, err
+	}
+	return s.Get(id)
+}
+
+func (s *redisStore) GetByMessageID(messageID string) (booking, error) {
+	id, err := s.client.HGet(context.Background(), redisMessageIDsKey, messageID).Result()
+	if errors.Is(err, redis.Nil) {
+		return booking{}, errBookingNotFound
+	}
+	if err != nil {
+		return booking{}, err
+	}
+	return s.Get(id)
+}
+
+func (s *redisStore) Update(b booking) error {
+	old, err := s.Get(b.ID)
+	if err != nil {
+		return err
+	}
+	data, err := marshalBooking(b)
+	if err != nil {
+		return err
+	}
+	gone := replacedMessageIDs(old, b)
+	ctx := context.Background()
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetXX(ctx, redisBookingKey(b.ID), data, 0)
+		if len(gone) > 0 {
+			pipe.HDel(ctx, redisMessageIDsKey, gone...)
+		}
+		if len(b.MessageIDs) > 0 {
+			pipe.HSet(ctx, redisMessageIDsKey, messageIndex(b)...)
+		}
+		return nil
+	})
+	return err
+}
+
+// replacedMessageIDs returns the reminders of old that b, the same booking updated, doesn't have anymore, like when
+// it's rescheduled. They no longer belong to it.
+func replacedMessageIDs(old, b booking) []string {
+	var gone []string
+	for _, messageID := range old.MessageIDs {
+		if !slices.Contains(b.MessageIDs, messageID) {
+			gone = append(gone, messageID)
+		}
+	}
+	return gone
+}
+
+func (s *redisStore) List() ([]booking, error) {
+	return listBookings(context.Background(), s.client)
+}
+
+// listBookings returns every booking in c, which is either a redisStore's client or a transaction of it.
+func listBookings(ctx context.Context, c redis.Cmdable) ([]booking, error) {
+	ids, err := c.LRange(ctx, redisBookingsKey, 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = redisBookingKey(id)
+	}
+	values, err := c.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	bookings := make([]booking, 0, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("booking %s is listed, but missing", ids[i])
+		}
+		b, err := unmarshalBooking([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, b)
+	}
+	// The same order as sqlStore's.
+	sort.SliceStable(bookings, func(i, j int) bool { return bookings[i].BookingTime.Before(*bookings[j].BookingTime) })
+	return bookings, nil
+}
+
+// redisWaitlist is a Waitlist kept in the same Redis server as a redisStore's bookings, as JSON in a hash by id.
+type redisWaitlist struct {
+	client *redis.Client
+}
+
+// waitlist returns the waitlist in s's Redis server.
+func (s *redisStore) waitlist() *redisWaitlist {
+	return &redisWaitlist{client: s.client}
+}
+
+func (l *redisWaitlist) Add(e waitlistEntry) (string, error) {
+	id, err := newBookingID()
+	if err != nil {
+		return "", err
+	}
+	e.ID = id
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	if err := l.client.HSet(context.Background(), redisWaitlistKey, id, data).Err(); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (l *redisWaitlist) Update(e waitlistEntry) error {
+	ctx := context.Background()
+	exists, err := l.client.HExists(ctx, redisWaitlistKey, e.ID).Result()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errBookingNotFound
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return l.client.HSet(ctx, redisWaitlistKey, e.ID, data).Err()
+}
+
+func (l *redisWaitlist) Remove(id string) error {
+	return l.client.HDel(context.Background(), redisWaitlistKey, id).Err()
+}
+
+func (l *redisWaitlist) List() ([]waitlistEntry, error) {
+	values, err := l.client.HGetAll(context.Background(), redisWaitlistKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var entries []waitlistEntry
+	for _, data := range values {
+		var e waitlistEntry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	// A hash has no order, so sort them like sqlWaitlist does.
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+	return entries, nil
+}
+
+// redisOptOuts is an OptOuts kept in the same Redis server as a redisStore's bookings, in a hash from the digits of
+// each number to when it opted out.
+type redisOptOuts struct {
+	client *redis.Client
+}
+
+// optOuts returns the opt-outs in s's Redis server.
+func (s *redisStore) optOuts() *redisOptOuts {
+	return &redisOptOuts{client: s.client}
+}
+
+func (o *redisOptOuts) OptOut(phone string, at time.Time) error {
+	return o.client.HSet(context.Background(), redisOptOutsKey, digitsOnly(phone), at.UTC().Format(time.RFC3339)).Err()
+}
+
+func (o *redisOptOuts) OptIn(phone string) error {
+	return o.client.HDel(context.Background(), redisOptOutsKey, digitsOnly(phone)).Err()
+}
+
+func (o *redisOptOuts) OptedOut(phone string) (bool, error) {
+	return o.client.HExists(context.Background(), redisOptOutsKey, digitsOnly(phone)).Result()
+}
+
+// redisSMSUsage is an SMSUsage kept in the same Redis server as a redisStore's bookings, with a counter per day.
+type redisSMSUsage struct {
+	client *redis.Client
+}
+
+// smsUsage returns the SMS usage counted in s's Redis server.
+func (s *redisStore) smsUsage() *redisSMSUsage {
+	return &redisSMSUsage{client: s.client}
+}
+
+func (u *redisSMSUsage) Add(day string, segments int) error {
+	ctx := context.Background()
+	_, err := u.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, redisSMSUsageKey(day), int64(segments))
+		// Only today's count matters. Keep it a little over a day, whatever the timezone.
+		pipe.Expire(ctx, redisSMSUsageKey(day), 48*time.Hour)
+		return nil
+	})
+	return err
+}
+
+func (u *redisSMSUsage) Used(day string) (int, error) {
+	segments, err := u.client.Get(context.Background(), redisSMSUsageKey(day)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return segments, err
+}
+
+// redisRateLimit is the token bucket of memoryRateLimiter.Allow, as a script so that Redis runs it atomically.
+// KEYS[1] is the bucket; ARGV holds the limit, the window and the current time, both in milliseconds.
+// Each bucket expires once it would have filled up again, since it's then no different from a new bucket.
+var redisRateLimit = redis.NewScript(`
+local limit, window, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or limit
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(limit, tokens + math.max(now - updated, 0) * limit / window)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], window)
+return allowed
+`)
+
+// redisRateLimiter is a RateLimiter that keeps its buckets in Redis, so that every instance of the application
+// counts towards the same limits.
+type redisRateLimiter struct {
+	client *redis.Client
+	limit  int
+	window time.Duration
+}
+
+// rateLimiter returns a RateLimiter with buckets in s's Redis server.
+func (s *redisStore) rateLimiter(limit int, window time.Duration) *redisRateLimiter {
+	return &redisRateLimiter{client: s.client, limit: limit, window: window}
+}
+
+func (l *redisRateLimiter) Allow(key string, now time.Time) (bool, error) {
+	allowed, err := redisRateLimit.Run(context.Background(), l.client, []string{redisKeyPrefix + "rate:" + key},
+		l.limit, l.window.Milliseconds(), strconv.FormatInt(now.UnixMilli(), 10)).Int()
+	if err != nil {
+		return false, err
+	}
+	return allowed == 1, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rescheduleBooking moves a booking to a new date and time. The new time is checked just like a new booking's,
+// and if it's acceptable, the booking's reminders are replaced with reminders for the new time: we cancel the old
+// ones first, so that they can't go out next to the new ones. Any we can't cancel are saved as the booking's
+// StaleMessageIDs before we schedule the new ones, for reconcileReminders to cancel later.
+// If anything goes wrong, the booking keeps its original time, with reminders scheduled for it again.
+func (a *app) rescheduleBooking(w http.ResponseWriter, r *http.Request) {
+	// Parse the form before anything reads from it: after the first read, a form we couldn't parse just looks empty.
+	var formErr error
+	if r.Method == "POST" {
+		formErr = r.ParseForm()
+	}
+	lang := requestLocale(r)
+	minDate, maxDate := a.bookableDates()
+	if formErr != nil {
+		slog.Warn("Couldn't parse reschedule form", "err", formErr)
+		renderPage(w, http.StatusBadRequest, "views/reschedule.gohtml", bookingContainer{Booking: booking{MinDate: minDate, MaxDate: maxDate}, Message: translate(lang, "invalid_form"), Lang: lang})
+		return
+	}
+	id, token := strings.TrimSpace(r.FormValue("id")), r.FormValue("token")
+	if len(cfg.CancelSecret) > 0 {
+		// Just like for cancelling, the id alone isn't enough: it has to come from a link we signed, and that hasn't expired.
+		var err error
+		if id, err = verifyCancelToken(cfg.CancelSecret, token, a.now()); err != nil {
+			renderPage(w, http.StatusForbidden, "views/reschedule.gohtml", bookingContainer{Booking: booking{MinDate: minDate, MaxDate: maxDate}, Message: translate(lang, "invalid_reschedule_link"), Lang: lang})
+			return
+		}
+	}
+	if r.Method != "POST" {
+		renderPage(w, http.StatusOK, "views/reschedule.gohtml", bookingContainer{Booking: booking{ID: id, MinDate: minDate, MaxDate: maxDate}, Lang: lang, CancelToken: token})
+		return
+	}
+
+	// Customers who reschedule again before the last reschedule is done would otherwise both replace the same
+	// reminders, and only one set of new reminders would be kept on the booking, while both go out. They may give
+	// its reference rather than its id, so find the booking first, lock it by its id, and read it again once we hold it.
+	original, err := findBooking(a.store, id)
+	if err == nil {
+		defer a.reschedules.lock(original.ID)()
+		original, err = a.store.Get(original.ID)
+	}
+	if err != nil {
+		if err != errBookingNotFound {
+			slog.Error("Couldn't get booking", "booking_id", id, "err", err)
+		}
+		renderPage(w, http.StatusNotFound, "views/reschedule.gohtml", bookingContainer{Booking: booking{ID: id, MinDate: minDate, MaxDate: maxDate}, Message: translate(lang, "booking_not_found"), Lang: lang, CancelToken: token})
+		return
+	}
+	original.MinDate, original.MaxDate = minDate, maxDate
+	if original.Cancelled {
+		renderPage(w, http.StatusConflict, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: translate(lang, "already_cancelled"), Lang: lang, CancelToken: token})
+		return
+	}
+
+	branch := branchFor(original)
+	newTime, err := parseBookingTime(r.FormValue("date"), r.FormValue("time"), branch.Timezone)
+	if err != nil {
+		renderPage(w, http.StatusBadRequest, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: translate(lang, "invalid_date"), Field: "date", Lang: lang, CancelToken: token})
+		return
+	}
+
+	// Check the new time against the booking's own treatment and reminder lead.
+	treatment, ok := findTreatment(original.Treatment)
+	if !ok {
+		renderPage(w, http.StatusConflict, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: translate(lang, "treatment_unavailable"), Lang: lang, CancelToken: token})
+		return
+	}
+	reminderDiff, err := reminderDiffFor(original.ReminderLead, treatment, lang)
+	if err != nil {
+		renderPage(w, http.StatusConflict, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: err.Error(), Lang: lang, CancelToken: token})
+		return
+	}
+	now := a.now()
+	if terrs, earliest := checkTime(branch, newTime, treatment.Duration, reminderDiff, now); len(terrs) > 0 {
+		berr := invalidFields(timeErrors(terrs, earliest, "date", lang))
+		renderPage(w, berr.Status, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: berr.Message, Field: berr.Field, Errors: berr.fieldErrors(), Lang: lang, CancelToken: token})
+		return
+	}
+	// The new time is checked again as it's saved, in case another booking takes it in the meantime.
+	moved := original
+	moved.BookingTime = &newTime
+	berr := a.checkStaff(moved, treatment.Duration, lang)
+	if berr == nil {
+		berr = a.checkBranchCapacity(moved, treatment.Duration, lang)
+	}
+	if berr != nil {
+		renderPage(w, berr.Status, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: berr.Message, Field: "date", Lang: lang, CancelToken: token})
+		return
+	}
+
+	// Cancel the old reminders before scheduling the new ones, and save which ones we couldn't, so that however
+	// this ends, no reminder for the old time is lost track of.
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+	defer cancel()
+	retired := a.retireReminders(ctx, original)
+	if err := a.store.Update(retired); err != nil {
+		slog.Error("Couldn't save cancelled reminders of rescheduled booking", "booking_id", original.ID, "err", err)
+		a.restoreReminders(original, reminderDiff, retired.StaleMessageIDs)
+		renderPage(w, http.StatusInternalServerError, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: translate(lang, "reschedule_save_failed"), Lang: lang, CancelToken: token})
+		return
+	}
+
+	// The customer confirmed the old time, not the new one, so they'll have to confirm again.
+	rescheduled := retired
+	rescheduled.BookingTime = &newTime
+	rescheduled.ReminderStatuses = nil
+	rescheduled.Confirmed = false
+	reminderTimes, berr := a.scheduleReminders(ctx, &rescheduled, reminderDiff, now, lang)
+	if berr != nil {
+		a.restoreReminders(original, reminderDiff, append(retired.StaleMessageIDs, a.discardReminders(rescheduled)...))
+		renderPage(w, berr.Status, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: berr.Message, Field: berr.Field, Lang: lang, CancelToken: token})
+		return
+	}
+
+	var conflict *bookingError
+	updated, err := a.store.UpdateIfAvailable(rescheduled, func(bookings []booking) bool {
+		conflict = capacityConflict(bookings, rescheduled, treatment.Duration, lang)
+		return conflict == nil
+	})
+	if err != nil {
+		slog.Error("Couldn't save rescheduled booking", "booking_id", original.ID, "booking_time", newTime, "err", err)
+		a.restoreReminders(original, reminderDiff, append(retired.StaleMessageIDs, a.discardReminders(rescheduled)...))
+		renderPage(w, http.StatusInternalServerError, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: translate(lang, "reschedule_save_failed"), Lang: lang, CancelToken: token})
+		return
+	}
+	if !updated {
+		slog.Info("Slot was taken while rescheduling", "booking_id", original.ID, "staff", original.Staff, "booking_time", newTime, "code", conflict.Code)
+		a.restoreReminders(original, reminderDiff, append(retired.StaleMessageIDs, a.discardReminders(rescheduled)...))
+		renderPage(w, conflict.Status, "views/reschedule.gohtml", bookingContainer{Booking: original, Message: conflict.Message, Field: "date", Lang: lang, CancelToken: token})
+		return
+	}
+	a.offerFreedSlot(ctx, original)
+
+	dateFormat := translate(lang, "date_format")
+	var reminderTimesText []string
+	for _, reminderTime := range reminderTimes {
+		reminderTimesText = append(reminderTimesText, reminderTime.Format(dateFormat))
+	}
+	// Like a late booking, a move into cfg.LateBookingGrace is too soon for any reminder.
+	doneKey := "rescheduled"
+	if len(reminderTimes) == 0 {
+		doneKey += "_no_reminder"
+	}
+	rescheduleStatus := translate(lang, doneKey, newTime.Format(dateFormat), strings.Join(reminderTimesText, translate(lang, "and")))
+	renderPage(w, http.StatusOK, "views/reschedule.gohtml", bookingContainer{Booking: rescheduled, Message: rescheduleStatus, Lang: lang, CancelToken: token})
+}
+
+// retireReminders cancels every reminder of b that's still scheduled, for a reschedule, and returns b without them.
+// The ones it couldn't cancel are added to its StaleMessageIDs.
+func (a *app) retireReminders(ctx context.Context, b booking) booking {
+	b.StaleMessageIDs = append(slices.Clip(b.StaleMessageIDs), a.cancelEach(ctx, b, "Couldn't cancel reminder for the old time")...)
+	b.MessageIDs = nil
+	return b
+}
+
+// discardReminders cancels the reminders of b after a failed reschedule, and returns the ones it couldn't cancel.
+// The failure may have been a timeout, so this gets a timeout of its own.
+func (a *app) discardReminders(b booking) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.APITimeout)
+	defer cancel()
+	return a.cancelEach(ctx, b, "Couldn't cancel reminder for the new time")
+}
+
+// cancelEach cancels every reminder of b that's still scheduled, going on past the ones it can't, and returns those.
+// It logs each of them with msg, with its message id, so that there's a record to cancel it by hand.
+// A reminder MessageBird doesn't know anymore is as good as cancelled.
+func (a *app) cancelEach(ctx context.Context, b booking, msg string) (failed []string) {
+	for _, messageID := range b.MessageIDs {
+		if _, err := a.cancelReminder(ctx, b, messageID); err != nil && !isNotFound(err) {
+			slog.Error(msg, "booking_id", b.ID, "message_id", messageID, "err", err)
+			failed = append(failed, messageID)
+		}
+	}
+	return failed
+}
+
+// restoreReminders schedules reminders for b's original time again, after a reschedule failed once its reminders
+// were cancelled, and saves them with stale as its StaleMessageIDs. We're already reporting the failure,
+// so if this fails too, all we can do is log it. It gets a timeout of its own, like discardReminders.
+func (a *app) restoreReminders(b booking, reminderDiff time.Duration, stale []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.APITimeout)
+	defer cancel()
+	b.MessageIDs, b.StaleMessageIDs = nil, stale
+	if _, berr := a.scheduleReminders(ctx, &b, reminderDiff, a.now(), defaultLocale); berr != nil {
+		slog.Error("Couldn't schedule reminders for the old time again", "booking_id", b.ID, "err", berr)
+	}
+	if err := a.store.Update(b); err != nil {
+		slog.Error("Couldn't save booking with its reminders restored", "booking_id", b.ID, "message_ids", b.MessageIDs, "stale_message_ids", stale, "err", err)
+	}
+}
+
+// reconcileReminders cancels the StaleMessageIDs of every booking, the reminders reschedules replaced but couldn't
+// cancel, so that customers don't get reminders for times they moved away from. It runs when the application
+// starts; the ones it still can't cancel are kept for next time, and logged, to cancel by hand.
+func (a *app) reconcileReminders(ctx context.Context) {
+	bookings, err := a.store.List()
+	if err != nil {
+		slog.Error("Couldn't list bookings to cancel stale reminders", "err", err)
+		return
+	}
+	for _, listed := range bookings {
+		if len(listed.StaleMessageIDs) == 0 {
+			continue
+		}
+		unlock := a.reschedules.lock(listed.ID)
+		// Get it again under the lock, in case a reschedule changed it since we listed it.
+		b, err := a.store.Get(listed.ID)
+		if err == nil {
+			callCtx, cancel := context.WithTimeout(ctx, cfg.APITimeout)
+			stale := b.StaleMessageIDs
+			b.StaleMessageIDs = a.cancelEach(callCtx, booking{ID: b.ID, MessageIDs: stale, ReminderStatuses: b.ReminderStatuses}, "Couldn't cancel stale reminder")
+			cancel()
+			if len(b.StaleMessageIDs) < len(stale) {
+				err = a.store.Update(b)
+			}
+		}
+		unlock()
+		if err != nil {
+			slog.Error("Couldn't cancel stale reminders", "booking_id", listed.ID, "err", err)
+		}
+	}
+}
+
+// bookingLocks lets one request at a time hold each booking.
+type bookingLocks struct {
+	mu    sync.Mutex
+	locks map[string]*bookingLock
+}
+
+// bookingLock is the lock of one booking, with how many requests hold it or wait for it, so that it can be
+// forgotten once none do.
+type bookingLock struct {
+	sync.Mutex
+	users int
+}
+
+func newBookingLocks() *bookingLocks {
+	return &bookingLocks{locks: make(map[string]*bookingLock)}
+}
+
+// lock waits until no one else holds the booking with the given id, and returns the function that lets it go again.
+// It only keeps out requests to this instance of the application.
+func (l *bookingLocks) lock(id string) (unlock func()) {
+	l.mu.Lock()
+	bl := l.locks[id]
+	if bl == nil {
+		bl = &bookingLock{}
+		l.locks[id] = bl
+	}
+	bl.users++
+	l.mu.Unlock()
+
+	bl.Lock()
+	return func() {
+		bl.Unlock()
+		l.mu.Lock()
+		if bl.users--; bl.users == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/messagebird/go-rest-api/sms"
+)
+
+// bookForTest books bookingForm with overrides through bbScheduler, and returns the booking it saved.
+func bookForTest(t *testing.T, a *app, overrides ...string) booking {
+	t.Helper()
+	if w := postForm(a.bbScheduler, "/", bookingForm(overrides...)); w.Code != http.StatusOK {
+		t.Fatalf("booking got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	bookings, err := a.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bookings[len(bookings)-1]
+}
+
+func TestRescheduleIntoLateBookingGrace(t *testing.T) {
+	a, client := newTestApp(t)
+	b := bookForTest(t, a)
+	cfg.LateBookingGrace = defaultReminderDiff
+
+	// Two hours from now is too soon for the reminder, but within the grace.
+	w := postForm(a.rescheduleBooking, "/reschedule", url.Values{"id": {b.ID}, "date": {"2026-03-10"}, "time": {"10:00"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	newTime := time.Date(2026, 3, 10, 10, 0, 0, 0, loc)
+	want := translate(defaultLocale, "rescheduled_no_reminder", newTime.Format(translate(defaultLocale, "date_format")))
+	if body := w.Body.String(); !strings.Contains(body, html.EscapeString(want)) {
+		t.Errorf("response doesn't say %q: %s", want, body)
+	}
+	if len(client.Messages) != 0 {
+		t.Errorf("%d reminders are scheduled, want none", len(client.Messages))
+	}
+	rescheduled, err := a.store.Get(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rescheduled.BookingTime.Equal(newTime) || len(rescheduled.MessageIDs) != 0 {
+		t.Errorf("got booking at %v with reminders %v, want it at %v without any", rescheduled.BookingTime, rescheduled.MessageIDs, newTime)
+	}
+}
+
+func TestRescheduleMalformedForm(t *testing.T) {
+	a, client := newTestApp(t)
+	b := bookForTest(t, a)
+	sent := len(client.Messages)
+
+	body := url.Values{"id": {b.ID}, "date": {"2026-03-12"}, "time": {"11:00"}}.Encode() + "&notes=%zz"
+	r := httptest.NewRequest("POST", "/reschedule", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	a.rescheduleBooking(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, html.EscapeString(translate(defaultLocale, "invalid_form"))) {
+		t.Errorf("response doesn't say the form couldn't be read: %s", body)
+	}
+	// A form we can't read all of doesn't move anything.
+	got, err := a.store.Get(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.BookingTime.Equal(*b.BookingTime) || len(client.Messages) != sent || len(client.Deleted) != 0 {
+		t.Errorf("booking is at %v, with %d reminders scheduled and %v deleted, want it left alone", got.BookingTime, len(client.Messages)-sent, client.Deleted)
+	}
+}
+
+func TestRescheduleNeedsSignedLink(t *testing.T) {
+	a, _ := newTestApp(t)
+	cfg.CancelSecret = []byte("secret")
+	mine := bookForTest(t, a, "time", "14:00")
+	theirs := bookForTest(t, a, "time", "16:00")
+	token := signCancelToken(cfg.CancelSecret, mine.ID, *mine.BookingTime)
+	newTime := url.Values{"date": {"2026-03-12"}, "time": {"11:00"}}
+
+	// Someone who only has the other booking's id, or who swaps it into a token of their own, can't move it.
+	for name, form := range map[string]url.Values{
+		"bare id":          {"id": {theirs.ID}},
+		"bare reference":   {"id": {theirs.Reference}},
+		"tampered token":   {"token": {theirs.ID + strings.TrimPrefix(token, mine.ID)}},
+		"id next to token": {"token": {token + "x"}, "id": {theirs.ID}},
+	} {
+		for k, v := range newTime {
+			form[k] = v
+		}
+		if w := postForm(a.rescheduleBooking, "/reschedule", form); w.Code != http.StatusForbidden {
+			t.Errorf("%s got status %d, want %d", name, w.Code, http.StatusForbidden)
+		}
+	}
+	got, err := a.store.Get(theirs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.BookingTime.Equal(*theirs.BookingTime) {
+		t.Errorf("their booking was moved to %v", got.BookingTime)
+	}
+
+	form := url.Values{"token": {token}}
+	for k, v := range newTime {
+		form[k] = v
+	}
+	if w := postForm(a.rescheduleBooking, "/reschedule", form); w.Code != http.StatusOK {
+		t.Fatalf("signed link got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got, err = a.store.Get(mine.ID); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 3, 12, 11, 0, 0, 0, loc); !got.BookingTime.Equal(want) {
+		t.Errorf("booking is at %v, want %v", got.BookingTime, want)
+	}
+}
+
+// gatedClient is a fakeClient whose first n CreateSMS calls wait until all n are made, so that the requests making
+// them have all checked the bookings before any of them saves.
+type gatedClient struct {
+	*fakeClient
+	mu      sync.Mutex
+	n       int
+	open    chan struct{}
+	arrived int
+}
+
+func newGatedClient(client *fakeClient, n int) *gatedClient {
+	return &gatedClient{fakeClient: client, n: n, open: make(chan struct{})}
+}
+
+func (c *gatedClient) CreateSMS(ctx context.Context, originator string, recipients []string, body string, params *sms.Params) (*sms.Message, error) {
+	c.mu.Lock()
+	c.arrived++
+	gated := c.arrived <= c.n
+	if c.arrived == c.n {
+		close(c.open)
+	}
+	c.mu.Unlock()
+	if gated {
+		<-c.open
+	}
+	return c.fakeClient.CreateSMS(ctx, originator, recipients, body, params)
+}
+
+func TestReschedulesRaceForLastChair(t *testing.T) {
+	a, client := newTestApp(t)
+	cfg.Branches[0].Chairs = 1
+	first := bookForTest(t, a, "time", "14:00")
+	second := bookForTest(t, a, "time", "16:00")
+	a.client = newGatedClient(client, 2)
+
+	// Both move to the same time, with the branch's only chair free when they check.
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i, b := range []booking{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := postForm(a.rescheduleBooking, "/reschedule", url.Values{"id": {b.ID}, "date": {"2026-03-12"}, "time": {"11:00"}})
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	newTime := time.Date(2026, 3, 12, 11, 0, 0, 0, loc)
+	moved := 0
+	for i, b := range []booking{first, second} {
+		got, err := a.store.Get(b.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case codes[i] == http.StatusOK && got.BookingTime.Equal(newTime):
+			moved++
+		case codes[i] == http.StatusConflict && got.BookingTime.Equal(*b.BookingTime):
+			// The one that lost keeps its time, with its reminders scheduled for it again.
+			if len(got.MessageIDs) != 2 {
+				t.Errorf("booking that wasn't moved has reminders %v, want 2", got.MessageIDs)
+			}
+		default:
+			t.Errorf("reschedule got status %d, and left the booking at %v", codes[i], got.BookingTime)
+		}
+	}
+	if moved != 1 {
+		t.Errorf("%d bookings were moved to the last chair, want 1", moved)
+	}
+	// Two for each booking, and none for the time that one of them couldn't have.
+	if len(client.Messages) != 4 {
+		t.Errorf("%d reminders are scheduled, want 4", len(client.Messages))
+	}
+}
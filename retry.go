@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	messagebird "github.com/messagebird/go-rest-api"
+)
+
+// MessageBird calls that fail with a transient error are tried up to maxAttempts times in all,
+// waiting initialBackoff before the first retry and twice as long before each one after that.
+const (
+	maxAttempts    = 3
+	initialBackoff = 250 * time.Millisecond
+)
+
+// retry calls op until it succeeds, fails with an error that isn't transient, or has been tried maxAttempts times,
+// and returns op's last error. If ctx is done before the next attempt, it returns ctx's error instead. what describes op for the log.
+func retry(ctx context.Context, what string, op func() error) error {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !isTransient(err) {
+			return err
+		}
+		if attempt == maxAttempts {
+			slog.Error("Giving up", "op", what, "attempts", attempt, "err", maskPhones(err.Error()))
+			return err
+		}
+		slog.Warn("Retrying", "op", what, "attempt", attempt, "backoff", backoff, "err", maskPhones(err.Error()))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether err is worth retrying: a network error, or MessageBird being unavailable.
+// Errors that MessageBird explains, like an invalid recipient or a bad API key, will just happen again.
+func isTransient(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, messagebird.ErrUnexpectedResponse) || errors.As(err, &netErr)
+}
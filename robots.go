@@ -0,0 +1,22 @@
+package main
+
+import "net/http"
+
+// robotsTxt asks search engines not to crawl any of the application. The booking form is for customers who
+// were sent to it, not for search results, and its other pages are about someone's appointment.
+func robotsTxt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("User-agent: *\nDisallow: /\n"))
+}
+
+// noIndex wraps handler so that its responses are neither stored by browsers and proxies, nor indexed by search
+// engines that ignore robots.txt. Use it for pages that show a booking, like the confirmation: a cached copy would
+// show someone's name, phone number and appointment to whoever uses the computer or proxy next. Static files,
+// if we ever serve any, don't need it, and are better off cached.
+func noIndex(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+		handler(w, r)
+	}
+}
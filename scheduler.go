@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// localReminderPrefix starts the id of every reminder kept by a timerScheduler or the dispatcher,
+// so that we can tell them apart from reminders scheduled with MessageBird.
+const localReminderPrefix = "local-"
+
+// timerScheduler sends reminders that MessageBird can't schedule for us, such as WhatsApp
+// messages and emails, by keeping a timer for each one until it's time to send it.
+// Timers live in memory: reminders that are still pending when the application stops are lost.
+type timerScheduler struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newTimerScheduler() *timerScheduler {
+	return &timerScheduler{timers: make(map[string]*time.Timer)}
+}
+
+// schedule calls send after delay, and returns an id that can be passed to cancel. The id starts with
+// localReminderPrefix followed by kind, such as "whatsapp", to make it recognizable in logs.
+func (s *timerScheduler) schedule(kind string, delay time.Duration, send func()) (string, error) {
+	id, err := newBookingID()
+	if err != nil {
+		return "", err
+	}
+	id = localReminderPrefix + kind + "-" + id
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timers[id] = time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		delete(s.timers, id)
+		s.mu.Unlock()
+		send()
+	})
+	return id, nil
+}
+
+// cancel stops the reminder with the given id, and reports whether it was still pending.
+func (s *timerScheduler) cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timer, ok := s.timers[id]
+	if !ok {
+		return false
+	}
+	delete(s.timers, id)
+	return timer.Stop()
+}
+
+// pending reports whether the reminder with the given id is still waiting to be sent.
+func (s *timerScheduler) pending(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.timers[id]
+	return ok
+}
+
+// isLocalReminder reports whether id belongs to a reminder kept by a timerScheduler or the dispatcher.
+func isLocalReminder(id string) bool {
+	return strings.HasPrefix(id, localReminderPrefix)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// The GSM 7-bit alphabet, which SMS use unless a message has characters outside it.
+// Characters in gsm7Extended take two septets, because they're sent as an escape followed by the character.
+const (
+	gsm7Basic    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extended = "\f^{}\\[~]|€"
+)
+
+// How much fits in an SMS segment. A message that doesn't fit in a single segment is split into parts,
+// each of which loses some room to the header that puts them back together.
+const (
+	gsm7SingleSegment = 160
+	gsm7MultiSegment  = 153
+	ucs2SingleSegment = 70
+	ucs2MultiSegment  = 67
+)
+
+// smsSegments returns how many SMS segments body takes. If every character is in the GSM 7-bit alphabet,
+// a segment holds 160 of them; otherwise the whole message is sent as UCS-2, and a segment holds only 70 UTF-16 code units,
+// so a single accented letter like "ł", or an emoji, which takes two, can make a message a lot more expensive.
+func smsSegments(body string) int {
+	if body == "" {
+		return 1
+	}
+	length, single, multi := 0, gsm7SingleSegment, gsm7MultiSegment
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			length++
+		case strings.ContainsRune(gsm7Extended, r):
+			length += 2
+		default:
+			length, single, multi = len(utf16.Encode([]rune(body))), ucs2SingleSegment, ucs2MultiSegment
+			return segmentsFor(length, single, multi)
+		}
+	}
+	return segmentsFor(length, single, multi)
+}
+
+// segmentsFor returns how many segments a message of length takes, given how much fits in a single segment,
+// and in each part of a longer message.
+func segmentsFor(length, single, multi int) int {
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
+
+// reminderSegments returns how many SMS segments each of b's reminders takes, or 0 if they aren't sent by SMS.
+func reminderSegments(b booking) int {
+	t := reminderTemplate(b.Language)
+	if b.Channel == channelWhatsApp || b.Channel == channelVoice || t == nil {
+		return 0
+	}
+	text, err := renderMessage(t, b)
+	if err != nil {
+		return 0
+	}
+	return smsSegments(text)
+}
+
+// smsCost estimates what sending segments SMS segments costs, at cfg.SMSPrice each. It's 0 if no price is set.
+func smsCost(segments int) float64 {
+	return float64(segments) * cfg.SMSPrice
+}
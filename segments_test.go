@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSMSSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty", "", 1},
+		{"one full segment", strings.Repeat("a", 160), 1},
+		{"just over one segment", strings.Repeat("a", 161), 2},
+		{"two full parts", strings.Repeat("a", 306), 2},
+		{"just over two parts", strings.Repeat("a", 307), 3},
+		// These accented letters are in the GSM alphabet, so they cost no more than any other letter.
+		{"GSM accents", strings.Repeat("é", 80) + strings.Repeat("ü", 80), 1},
+		// An extended character takes two septets.
+		{"euro signs", strings.Repeat("€", 80), 1},
+		{"one euro sign too many", strings.Repeat("€", 80) + "a", 2},
+		// An accent outside the GSM alphabet sends the whole message as UCS-2.
+		{"other accent", "Cześć " + strings.Repeat("a", 64), 1},
+		{"other accent in a long message", strings.Repeat("a", 159) + "ł", 3},
+		{"full UCS-2 segment", strings.Repeat("ł", 70), 1},
+		{"just over one UCS-2 segment", strings.Repeat("ł", 71), 2},
+		// An emoji like this one takes two UTF-16 code units.
+		{"emoji", strings.Repeat("😀", 35), 1},
+		{"one emoji too many", strings.Repeat("😀", 36), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := smsSegments(tt.body); got != tt.want {
+				t.Errorf("smsSegments(%q) = %d, want %d", tt.body, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often a recurring appointment comes back.
+const (
+	recurrenceNone     = "none"
+	recurrenceWeekly   = "weekly"
+	recurrenceBiweekly = "biweekly"
+	recurrenceMonthly  = "monthly"
+)
+
+// maxOccurrences is the most appointments we book in one series.
+const maxOccurrences = 12
+
+// parseRecurrence checks the recurrence and occurrences a customer asked for, and returns how many appointments
+// to book in all, including the first. Without a recurrence, that's just the one.
+func parseRecurrence(recurrence, occurrences, lang string) (int, *bookingError) {
+	switch recurrence {
+	case "", recurrenceNone:
+		return 1, nil
+	case recurrenceWeekly, recurrenceBiweekly, recurrenceMonthly:
+	default:
+		return 0, &bookingError{http.StatusBadRequest, codeInvalidRecurrence, translate(lang, "invalid_recurrence"), "recurrence", nil}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(occurrences))
+	if err != nil || n < 2 || n > maxOccurrences {
+		return 0, &bookingError{http.StatusBadRequest, codeInvalidRecurrence, translate(lang, "invalid_occurrences", maxOccurrences), "occurrences", nil}
+	}
+	return n, nil
+}
+
+// occurrenceTime returns the time of the nth appointment of a series that starts at start, counting from 0.
+// Each appointment is at the same time of day as the first, even if daylight saving time starts or ends in between.
+func occurrenceTime(start time.Time, recurrence string, n int) time.Time {
+	switch recurrence {
+	case recurrenceWeekly:
+		return start.AddDate(0, 0, 7*n)
+	case recurrenceBiweekly:
+		return start.AddDate(0, 0, 14*n)
+	case recurrenceMonthly:
+		return start.AddDate(0, n, 0)
+	default:
+		return start
+	}
+}
+
+// bookSeries books the rest of the series that starts with first, which has already been booked with makeBooking,
+// until there are occurrences appointments in all. Each appointment gets its own reminders.
+// Appointments that checkTime rejects, say because they fall on a day we're closed, beyond cfg.BookingHorizon or when the stylist is busy, are skipped.
+// It returns the appointments it booked and the times it skipped. If booking one fails, it stops there,
+// and returns what it booked so far with the error.
+func (a *app) bookSeries(ctx context.Context, first booking, recurrence string, occurrences int, lang string) (booked []booking, skipped []time.Time, berr *bookingError) {
+	treatment, _ := findTreatment(first.Treatment)
+	// makeBooking accepted the lead time for the first appointment, so this can't fail.
+	reminderDiff, _ := reminderDiffFor(first.ReminderLead, treatment, lang)
+
+	now := a.now()
+	for n := 1; n < occurrences; n++ {
+		bookingTime := occurrenceTime(*first.BookingTime, recurrence, n)
+		if terrs, _ := checkTime(branchFor(first), bookingTime, treatment.Duration, reminderDiff, now); len(terrs) > 0 {
+			skipped = append(skipped, bookingTime)
+			continue
+		}
+
+		next := first
+		next.ID = ""
+		next.BookingTime = &bookingTime
+		berr := a.checkStaff(next, treatment.Duration, lang)
+		if berr == nil {
+			berr = a.checkBranchCapacity(next, treatment.Duration, lang)
+		}
+		if berr != nil {
+			if berr.Code != codeStaffUnavailable && berr.Code != codeDayFull && berr.Code != codeSlotTaken {
+				return booked, skipped, berr
+			}
+			skipped = append(skipped, bookingTime)
+			continue
+		}
+		next.MessageIDs = nil
+		next.ReminderStatuses = nil
+		var err error
+		if next.ID, err = newBookingID(); err != nil {
+			slog.Error("Couldn't make booking id", "series_id", first.SeriesID, "err", err)
+			return booked, skipped, &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+		}
+		if next.Reference, err = newBookingReference(a.store); err != nil {
+			slog.Error("Couldn't make booking reference", "series_id", first.SeriesID, "err", err)
+			return booked, skipped, &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+		}
+		if _, berr := a.scheduleReminders(ctx, &next, reminderDiff, now, lang); berr != nil {
+			return booked, skipped, berr
+		}
+		if berr := a.saveBooking(ctx, next, treatment.Duration, lang); berr != nil {
+			if berr.Code != codeStaffUnavailable && berr.Code != codeDayFull {
+				return booked, skipped, berr
+			}
+			skipped = append(skipped, bookingTime)
+			continue
+		}
+		slog.Info("Booked", "booking_id", next.ID, "series_id", first.SeriesID, "phone", maskPhone(next.Phone), "booking_time", bookingTime, "channel", next.Channel)
+		booked = append(booked, next)
+	}
+	return booked, skipped, nil
+}
+
+// cancelSeries cancels the appointments in thisBooking's series that come after it, and returns how many it cancelled.
+func (a *app) cancelSeries(ctx context.Context, thisBooking booking) (int, error) {
+	bookings, err := a.store.List()
+	if err != nil {
+		return 0, err
+	}
+	cancelled := 0
+	for _, b := range bookings {
+		if b.SeriesID != thisBooking.SeriesID || b.Cancelled || !b.BookingTime.After(*thisBooking.BookingTime) {
+			continue
+		}
+		if _, err := a.cancelReminders(ctx, b); err != nil {
+			return cancelled, err
+		}
+		b.Cancelled = true
+		if err := a.store.Update(b); err != nil {
+			return cancelled, err
+		}
+		a.offerFreedSlot(ctx, b)
+		cancelled++
+	}
+	return cancelled, nil
+}
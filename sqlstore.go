@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// migrations are applied in order when a sqlStore is opened. The database's
+// user_version records how many of them have already been applied, so never
+// edit or reorder existing entries: append new ones instead.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS bookings (
+		id            TEXT PRIMARY KEY,
+		name          TEXT NOT NULL,
+		treatment     TEXT NOT NULL,
+		phone         TEXT NOT NULL,
+		booking_time  DATETIME NOT NULL,
+		reminder_lead TEXT NOT NULL DEFAULT '',
+		message_ids   TEXT NOT NULL DEFAULT '',
+		cancelled     BOOLEAN NOT NULL DEFAULT 0
+	)`,
+	`ALTER TABLE bookings ADD COLUMN reminder_statuses TEXT NOT NULL DEFAULT 'null'`,
+	`ALTER TABLE bookings ADD COLUMN confirmed BOOLEAN NOT NULL DEFAULT 0`,
+	`ALTER TABLE bookings ADD COLUMN channel TEXT NOT NULL DEFAULT 'sms'`,
+	`ALTER TABLE bookings ADD COLUMN email TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE bookings ADD COLUMN country TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE bookings ADD COLUMN series_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE bookings ADD COLUMN staff TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE bookings ADD COLUMN notes TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE bookings ADD COLUMN contact_phone TEXT NOT NULL DEFAULT ''`,
+	// Until bookings had a contact number, reminders went to the booking's own number.
+	`UPDATE bookings SET contact_phone = phone WHERE contact_phone = ''`,
+	`CREATE TABLE IF NOT EXISTS waitlist (
+		id           TEXT PRIMARY KEY,
+		name         TEXT NOT NULL,
+		treatment    TEXT NOT NULL,
+		staff        TEXT NOT NULL,
+		branch       TEXT NOT NULL,
+		phone        TEXT NOT NULL,
+		booking_time DATETIME NOT NULL,
+		created      DATETIME NOT NULL,
+		hold_until   DATETIME
+	)`,
+	`ALTER TABLE bookings ADD COLUMN consent BOOLEAN NOT NULL DEFAULT 0`,
+	`ALTER TABLE bookings ADD COLUMN consented_at DATETIME`,
+	`CREATE TABLE IF NOT EXISTS opt_outs (
+		phone     TEXT PRIMARY KEY,
+		opted_out DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS sms_usage (
+		day      TEXT PRIMARY KEY,
+		segments INTEGER NOT NULL
+	)`,
+	`ALTER TABLE bookings ADD COLUMN language TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE bookings ADD COLUMN phones TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE bookings ADD COLUMN stale_message_ids TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE bookings ADD COLUMN reference TEXT NOT NULL DEFAULT ''`,
+	// Bookings from before we gave out references have none, so only the ones that do have to be unique.
+	`CREATE UNIQUE INDEX IF NOT EXISTS bookings_reference ON bookings (reference) WHERE reference != ''`,
+	// Bookings from before we saved their branch are taken to be at the first one, as branchFor does.
+	`ALTER TABLE bookings ADD COLUMN branch TEXT NOT NULL DEFAULT ''`,
+}
+
+// sqlStore is a Store backed by a SQLite database, so bookings survive restarts.
+type sqlStore struct {
+	db *sql.DB
+}
+
+// newSQLStore opens the SQLite database at path, creating it if needed, and migrates it to the latest schema.
+func newSQLStore(path string) (*sqlStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &sqlStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqlStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		// PRAGMA doesn't accept placeholders, but version is an int we control.
+		if _, err := tx.Exec("PRAGMA user_version = " + strconv.Itoa(version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bookingColumns are the columns of the bookings table, in the order used by bookingValues and scanBooking.
+const bookingColumns = "id, name, treatment, phone, booking_time, reminder_lead, message_ids, cancelled, reminder_statuses, confirmed, channel, email, country, series_id, staff, notes, contact_phone, consent, consented_at, language, phones, stale_message_ids, reference, branch"
+
+// bookingPlaceholders has a placeholder for each of bookingColumns.
+var bookingPlaceholders = strings.TrimSuffix(strings.Repeat("?, ", strings.Count(bookingColumns, ",")+1), ", ")
+
+// bookingValues returns the values to store in bookingColumns for b.
+func bookingValues(b booking) ([]interface{}, error) {
+	reminderStatuses, err := json.Marshal(b.ReminderStatuses)
+	if err != nil {
+		return nil, err
+	}
+	// Bookings from before we asked for consent don't have a time for it.
+	var consentedAt interface{}
+	if b.ConsentedAt != nil {
+		consentedAt = b.ConsentedAt.UTC()
+	}
+	return []interface{}{
+		b.ID, b.Name, b.Treatment, b.Phone, b.BookingTime.UTC(), b.ReminderLead, strings.Join(b.MessageIDs, ","), b.Cancelled,
+		string(reminderStatuses), b.Confirmed, b.Channel, b.Email, b.Country, b.SeriesID, b.Staff, b.Notes, b.ContactPhone,
+		b.Consent, consentedAt, b.Language, strings.Join(b.Phones, ","), strings.Join(b.StaleMessageIDs, ","),
+		b.Reference, b.Branch,
+	}, nil
+}
+
+func (s *sqlStore) Save(b booking) (string, error) {
+	if b.ID == "" {
+		id, err := newBookingID()
+		if err != nil {
+			return "", err
+		}
+		b.ID = id
+	}
+	values, err := bookingValues(b)
+	if err != nil {
+		return "", err
+	}
+	// The unique index would turn a taken reference down too, but not with an error we can tell apart.
+	taken, err := referenceTaken(context.Background(), s.db, b.Reference)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		return "", errReferenceTaken
+	}
+	_, err = s.db.Exec("INSERT INTO bookings ("+bookingColumns+") VALUES ("+bookingPlaceholders+")", values...)
+	if err != nil {
+		return "", err
+	}
+	return b.ID, nil
+}
+
+func (s *sqlStore) SaveIfAvailable(b booking, available func([]booking) bool) (bool, error) {
+	values, err := bookingValues(b)
+	if err != nil {
+		return false, err
+	}
+	return s.writeIfAvailable(available, func(ctx context.Context, conn *sql.Conn) error {
+		taken, err := referenceTaken(ctx, conn, b.Reference)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errReferenceTaken
+		}
+		_, err = conn.ExecContext(ctx, "INSERT INTO bookings ("+bookingColumns+") VALUES ("+bookingPlaceholders+")", values...)
+		return err
+	})
+}
+
+func (s *sqlStore) UpdateIfAvailable(b booking, available func([]booking) bool) (bool, error) {
+	values, err := bookingValues(b)
+	if err != nil {
+		return false, err
+	}
+	return s.writeIfAvailable(available, func(ctx context.Context, conn *sql.Conn) error {
+		res, err := conn.ExecContext(ctx,
+			"UPDATE bookings SET ("+bookingColumns+") = ("+bookingPlaceholders+") WHERE id = ?",
+			append(values, b.ID)...,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errBookingNotFound
+		}
+		return nil
+	})
+}
+
+// writeIfAvailable calls write, and commits what it wrote, if available reports that the stored bookings leave room
+// for it, and reports whether it did.
+func (s *sqlStore) writeIfAvailable(available func([]booking) bool, write func(ctx context.Context, conn *sql.Conn) error) (bool, error) {
+	// BEGIN IMMEDIATE takes the database's write lock before we read the bookings, so that no other write comes between
+	// our check and ours, not even another application's. database/sql only begins transactions that take it
+	// on their first write, so use a connection of our own.
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return false, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			conn.ExecContext(ctx, "ROLLBACK")
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, "SELECT "+bookingColumns+" FROM bookings ORDER BY booking_time")
+	if err != nil {
+		return false, err
+	}
+	bookings, err := scanBookings(rows)
+	if err != nil {
+		return false, err
+	}
+	if !available(bookings) {
+		return false, nil
+	}
+	if err := write(ctx, conn); err != nil {
+		return false, err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return false, err
+	}
+	committed = true
+	return true, nil
+}
+
+func (s *sqlStore) Get(id string) (booking, error) {
+	row := s.db.QueryRow("SELECT "+bookingColumns+" FROM bookings WHERE id = ?", id)
+	b, err := scanBooking(row)
+	if err == sql.ErrNoRows {
+		return booking{}, errBookingNotFound
+	}
+	return b, err
+}
+
+func (s *sqlStore) GetByReference(reference string) (booking, error) {
+	if reference == "" {
+		return booking{}, errBookingNotFound
+	}
+	row := s.db.QueryRow("SELECT "+bookingColumns+" FROM bookings WHERE reference = ?", reference)
+	b, err := scanBooking(row)
+	if err == sql.ErrNoRows {
+		return booking{}, errBookingNotFound
+	}
+	return b, err
+}
+
+// rowQueryer is implemented by both *sql.DB and *sql.Conn.
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// referenceTaken reports whether a booking in q's database already has reference.
+func referenceTaken(ctx context.Context, q rowQueryer, reference string) (bool, error) {
+	if reference == "" {
+		return false, nil
+	}
+	var n int
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM bookings WHERE reference = ?", reference).Scan(&n)
+	return n > 0, err
+}
+
+func (s *sqlStore) GetByMessageID(messageID string) (booking, error) {
+	// message_ids is a comma separated list, so surround both with commas to match whole ids only.
+	row := s.db.QueryRow(
+		"SELECT "+bookingColumns+" FROM bookings WHERE ',' || message_ids || ',' LIKE ?",
+		"%,"+messageID+",%",
+	)
+	b, err := scanBooking(row)
+	if err == sql.ErrNoRows {
+		return booking{}, errBookingNotFound
+	}
+	return b, err
+}
+
+func (s *sqlStore) Update(b booking) error {
+	values, err := bookingValues(b)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(
+		"UPDATE bookings SET ("+bookingColumns+") = ("+bookingPlaceholders+") WHERE id = ?",
+		append(values, b.ID)...,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errBookingNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) List() ([]booking, error) {
+	rows, err := s.db.Query("SELECT " + bookingColumns + " FROM bookings ORDER BY booking_time")
+	if err != nil {
+		return nil, err
+	}
+	return scanBookings(rows)
+}
+
+// scanBookings returns the bookings in rows, and closes them.
+func scanBookings(rows *sql.Rows) ([]booking, error) {
+	defer rows.Close()
+
+	var bookings []booking
+	for rows.Next() {
+		b, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, b)
+	}
+	return bookings, rows.Err()
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBooking(row scanner) (booking, error) {
+	var (
+		b                booking
+		bookingTime      time.Time
+		messageIDs       string
+		reminderStatuses string
+		consentedAt      sql.NullTime
+		phones           string
+		staleMessageIDs  string
+	)
+	err := row.Scan(&b.ID, &b.Name, &b.Treatment, &b.Phone, &bookingTime, &b.ReminderLead, &messageIDs, &b.Cancelled,
+		&reminderStatuses, &b.Confirmed, &b.Channel, &b.Email, &b.Country, &b.SeriesID, &b.Staff, &b.Notes, &b.ContactPhone,
+		&b.Consent, &consentedAt, &b.Language, &phones, &staleMessageIDs, &b.Reference, &b.Branch)
+	if err != nil {
+		return booking{}, err
+	}
+	b.BookingTime = &bookingTime
+	if consentedAt.Valid {
+		b.ConsentedAt = &consentedAt.Time
+	}
+	if messageIDs != "" {
+		b.MessageIDs = strings.Split(messageIDs, ",")
+	}
+	if phones != "" {
+		b.Phones = strings.Split(phones, ",")
+	}
+	if staleMessageIDs != "" {
+		b.StaleMessageIDs = strings.Split(staleMessageIDs, ",")
+	}
+	if err := json.Unmarshal([]byte(reminderStatuses), &b.ReminderStatuses); err != nil {
+		return booking{}, err
+	}
+	return b, nil
+}
+
+// sqlWaitlist is a Waitlist kept in the same SQLite database as a sqlStore's bookings.
+type sqlWaitlist struct {
+	db *sql.DB
+}
+
+// waitlist returns the waitlist in s's database.
+func (s *sqlStore) waitlist() *sqlWaitlist {
+	return &sqlWaitlist{db: s.db}
+}
+
+// waitlistColumns lists the waitlist columns in the order waitlistValues and scanWaitlistEntry use.
+const waitlistColumns = "id, name, treatment, staff, branch, phone, booking_time, created, hold_until"
+
+func waitlistValues(e waitlistEntry) []interface{} {
+	// Entries that haven't been offered a slot yet have no hold.
+	var holdUntil interface{}
+	if !e.HoldUntil.IsZero() {
+		holdUntil = e.HoldUntil.UTC()
+	}
+	return []interface{}{e.ID, e.Name, e.Treatment, e.Staff, e.Branch, e.Phone, e.BookingTime.UTC(), e.Created.UTC(), holdUntil}
+}
+
+func (l *sqlWaitlist) Add(e waitlistEntry) (string, error) {
+	id, err := newBookingID()
+	if err != nil {
+		return "", err
+	}
+	e.ID = id
+	_, err = l.db.Exec("INSERT INTO waitlist ("+waitlistColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", waitlistValues(e)...)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (l *sqlWaitlist) Update(e waitlistEntry) error {
+	res, err := l.db.Exec(
+		"UPDATE waitlist SET ("+waitlistColumns+") = (?, ?, ?, ?, ?, ?, ?, ?, ?) WHERE id = ?",
+		append(waitlistValues(e), e.ID)...,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errBookingNotFound
+	}
+	return nil
+}
+
+func (l *sqlWaitlist) Remove(id string) error {
+	_, err := l.db.Exec("DELETE FROM waitlist WHERE id = ?", id)
+	return err
+}
+
+func (l *sqlWaitlist) List() ([]waitlistEntry, error) {
+	rows, err := l.db.Query("SELECT " + waitlistColumns + " FROM waitlist ORDER BY created")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []waitlistEntry
+	for rows.Next() {
+		var (
+			e         waitlistEntry
+			holdUntil sql.NullTime
+		)
+		err := rows.Scan(&e.ID, &e.Name, &e.Treatment, &e.Staff, &e.Branch, &e.Phone, &e.BookingTime, &e.Created, &holdUntil)
+		if err != nil {
+			return nil, err
+		}
+		e.HoldUntil = holdUntil.Time
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// sqlOptOuts is an OptOuts kept in the same SQLite database as a sqlStore's bookings.
+type sqlOptOuts struct {
+	db *sql.DB
+}
+
+// optOuts returns the opt-outs in s's database.
+func (s *sqlStore) optOuts() *sqlOptOuts {
+	return &sqlOptOuts{db: s.db}
+}
+
+func (o *sqlOptOuts) OptOut(phone string, at time.Time) error {
+	_, err := o.db.Exec("INSERT OR REPLACE INTO opt_outs (phone, opted_out) VALUES (?, ?)", digitsOnly(phone), at.UTC())
+	return err
+}
+
+func (o *sqlOptOuts) OptIn(phone string) error {
+	_, err := o.db.Exec("DELETE FROM opt_outs WHERE phone = ?", digitsOnly(phone))
+	return err
+}
+
+func (o *sqlOptOuts) OptedOut(phone string) (bool, error) {
+	var n int
+	if err := o.db.QueryRow("SELECT COUNT(*) FROM opt_outs WHERE phone = ?", digitsOnly(phone)).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// sqlSMSUsage is an SMSUsage kept in the same SQLite database as a sqlStore's bookings.
+type sqlSMSUsage struct {
+	db *sql.DB
+}
+
+// smsUsage returns the SMS usage counted in s's database.
+func (s *sqlStore) smsUsage() *sqlSMSUsage {
+	return &sqlSMSUsage{db: s.db}
+}
+
+func (u *sqlSMSUsage) Add(day string, segments int) error {
+	_, err := u.db.Exec("INSERT INTO sms_usage (day, segments) VALUES (?, ?) ON CONFLICT (day) DO UPDATE SET segments = segments + excluded.segments", day, segments)
+	return err
+}
+
+func (u *sqlSMSUsage) Used(day string) (int, error) {
+	var segments int
+	err := u.db.QueryRow("SELECT segments FROM sms_usage WHERE day = ?", day).Scan(&segments)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return segments, err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestSQLStore returns a sqlStore with a new database of its own, which is removed after the test.
+func newTestSQLStore(t *testing.T) *sqlStore {
+	t.Helper()
+	s, err := newSQLStore(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	return s
+}
+
+func TestSQLStoreKeepsEveryField(t *testing.T) {
+	s := newTestSQLStore(t)
+	bookingTime := time.Date(2026, 3, 11, 13, 0, 0, 0, time.UTC)
+	consentedAt := time.Date(2026, 3, 10, 7, 0, 0, 0, time.UTC)
+	// Every field that's saved, so that one that's left out of bookingColumns doesn't come back.
+	want := booking{
+		ID:               "0123456789abcdef",
+		Reference:        "7KQ2-M9XD-4HRT",
+		Name:             "Jane",
+		Treatment:        "Haircut",
+		Phone:            "+31612345678",
+		ContactPhone:     "+31687654321",
+		Phones:           []string{"+31611111111", "+31622222222"},
+		Country:          "NL",
+		Email:            "jane@example.com",
+		BookingTime:      &bookingTime,
+		ReminderLead:     "3h",
+		Channel:          channelSMS,
+		Staff:            "Anna",
+		Branch:           "Berlin",
+		Notes:            "bringing my own color",
+		Language:         "de",
+		Consent:          true,
+		ConsentedAt:      &consentedAt,
+		MessageIDs:       []string{"m1", "m2"},
+		StaleMessageIDs:  []string{"m0"},
+		ReminderStatuses: map[string]string{"m1": reminderPending, "m2": reminderPending},
+		Cancelled:        true,
+		Confirmed:        true,
+		SeriesID:         "fedcba9876543210",
+	}
+	if _, err := s.Save(want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// parseStaff parses a comma separated list of stylists' names, like "Anna, Bram".
+func parseStaff(list string) []string {
+	var staff []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			staff = append(staff, name)
+		}
+	}
+	return staff
+}
+
+// validStaff reports whether name is one of cfg.Staff.
+func validStaff(name string) bool {
+	for _, s := range cfg.Staff {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// staffAvailable reports whether b's stylist is free for duration from b's booking time, that is, whether none of
+// their other bookings overlaps it. Cancelled bookings and b itself, if it's already saved, don't count.
+// Without a stylist, b can always be booked, like before we had staff.
+func (a *app) staffAvailable(b booking, duration time.Duration) (bool, error) {
+	if b.Staff == "" {
+		return true, nil
+	}
+	bookings, err := a.store.List()
+	if err != nil {
+		return false, err
+	}
+	return staffFree(bookings, b, duration), nil
+}
+
+// staffFree reports whether none of bookings keeps b's stylist busy for duration from b's booking time.
+// Every appointment, b's included, keeps its stylist busy for cfg.AppointmentBuffer after it ends.
+func staffFree(bookings []booking, b booking, duration time.Duration) bool {
+	for _, other := range bookings {
+		if other.Staff != b.Staff || other.Cancelled || (b.ID != "" && other.ID == b.ID) {
+			continue
+		}
+		// A treatment we no longer offer has no duration, but it still takes up its start time.
+		treatment, _ := findTreatment(other.Treatment)
+		if overlaps(*b.BookingTime, duration, *other.BookingTime, max(treatment.Duration, time.Minute)) {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether an appointment taking duration from start and one taking otherDuration from otherStart
+// keep the same stylist busy at the same time, counting the buffer after each of them.
+func overlaps(start time.Time, duration time.Duration, otherStart time.Time, otherDuration time.Duration) bool {
+	end, otherEnd := start.Add(duration+cfg.AppointmentBuffer), otherStart.Add(otherDuration+cfg.AppointmentBuffer)
+	return otherStart.Before(end) && start.Before(otherEnd)
+}
+
+// checkStaff checks that b's stylist is free for duration from b's booking time, and explains why not if they aren't,
+// in the locale lang.
+func (a *app) checkStaff(b booking, duration time.Duration, lang string) *bookingError {
+	available, err := a.staffAvailable(b, duration)
+	if err != nil {
+		slog.Error("Couldn't check staff availability", "staff", b.Staff, "booking_time", *b.BookingTime, "err", err)
+		return &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+	}
+	if available {
+		// A slot that freed up is kept for whoever on the waitlist we offered it to.
+		held, err := a.heldByOther(b, duration)
+		if err != nil {
+			slog.Error("Couldn't check waitlist", "staff", b.Staff, "booking_time", *b.BookingTime, "err", err)
+			return &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+		}
+		available = !held
+	}
+	if !available {
+		return &bookingError{http.StatusConflict, codeStaffUnavailable, translate(lang, "staff_unavailable", b.Staff), "staff", nil}
+	}
+	return nil
+}
+
+// capacityConflict explains, in the locale lang, why bookings leave no room for b taking duration: its stylist is
+// busy, its branch is fully booked that day, or it has no chair free. If there's room, it returns nil.
+func capacityConflict(bookings []booking, b booking, duration time.Duration, lang string) *bookingError {
+	if b.Staff != "" && !staffFree(bookings, b, duration) {
+		return &bookingError{http.StatusConflict, codeStaffUnavailable, translate(lang, "staff_unavailable", b.Staff), "staff", nil}
+	}
+	if dayFull(bookings, b) {
+		return &bookingError{http.StatusConflict, codeDayFull, translate(lang, "day_full"), "date", nil}
+	}
+	if !chairFree(bookings, b, duration) {
+		return &bookingError{http.StatusConflict, codeSlotTaken, translate(lang, "slot_taken"), "date", nil}
+	}
+	return nil
+}
+
+// saveBooking saves b, which has its id and its reminders, unless another booking took b's stylist, the last of
+// its branch's bookings that day or its last chair since checkStaff and checkBranchCapacity let b through. Then it cancels b's reminders and
+// explains why, in the locale lang. Checking again as we save keeps bookings made at the same time from both
+// getting the same slot.
+func (a *app) saveBooking(ctx context.Context, b booking, duration time.Duration, lang string) *bookingError {
+	var conflict *bookingError
+	saved, err := a.store.SaveIfAvailable(b, func(bookings []booking) bool {
+		conflict = capacityConflict(bookings, b, duration, lang)
+		return conflict == nil
+	})
+	if err != nil {
+		slog.Error("Couldn't save booking", "booking_id", b.ID, "phone", maskPhone(b.Phone), "booking_time", *b.BookingTime, "err", err)
+		return &bookingError{http.StatusInternalServerError, codeStoreFailed, translate(lang, "store_failed"), "", nil}
+	}
+	if !saved {
+		slog.Info("Slot was taken while booking", "booking_id", b.ID, "staff", b.Staff, "booking_time", *b.BookingTime, "code", conflict.Code)
+		if _, err := a.cancelReminders(ctx, b); err != nil {
+			slog.Error("Couldn't cancel reminders of unsaved booking", "booking_id", b.ID, "err", err)
+		}
+		return conflict
+	}
+	return nil
+}
+
+// dayFull reports whether b's branch already has its MaxBookingsPerDay on the day of b, at the branch's local time,
+// not counting cancelled bookings and b itself.
+func dayFull(bookings []booking, b booking) bool {
+	branch := branchFor(b)
+	if branch.MaxBookingsPerDay <= 0 {
+		return false
+	}
+	year, month, day := localTime(b).Date()
+	count := 0
+	for _, other := range bookings {
+		if other.Cancelled || (b.ID != "" && other.ID == b.ID) || branchFor(other).Name != branch.Name {
+			continue
+		}
+		if y, m, d := localTime(other).Date(); y == year && m == month && d == day {
+			count++
+		}
+	}
+	return count >= branch.MaxBookingsPerDay
+}
+
+// chairFree reports whether b's branch has a chair free for duration from b's booking time: whether, in each slot
+// b spans, fewer than the branch's Chairs of bookings keep a chair busy. Slots are cfg.SlotGranularity, or
+// defaultSlotMinutes without it, long. Cancelled bookings and b itself don't count.
+func chairFree(bookings []booking, b booking, duration time.Duration) bool {
+	branch := branchFor(b)
+	if branch.Chairs <= 0 {
+		return true
+	}
+	step := cfg.SlotGranularity
+	if step <= 0 {
+		step = defaultSlotMinutes * time.Minute
+	}
+	start := *b.BookingTime
+	end := start.Add(max(duration, time.Minute) + cfg.AppointmentBuffer)
+	for from := start; from.Before(end); from = from.Add(step) {
+		to := from.Add(step)
+		if to.After(end) {
+			to = end
+		}
+		busy := 0
+		for _, other := range bookings {
+			if other.Cancelled || (b.ID != "" && other.ID == b.ID) || branchFor(other).Name != branch.Name {
+				continue
+			}
+			// Like in staffFree, a treatment we no longer offer still takes up its start time.
+			treatment, _ := findTreatment(other.Treatment)
+			otherEnd := other.BookingTime.Add(max(treatment.Duration, time.Minute) + cfg.AppointmentBuffer)
+			if other.BookingTime.Before(to) && from.Before(otherEnd) {
+				busy++
+			}
+		}
+		if busy >= branch.Chairs {
+			return false
+		}
+	}
+	return true
+}
+
+// checkBranchCapacity checks that b's branch isn't fully booked on the day of b, and that it has a chair free for
+// duration from b's booking time, and explains why not if it doesn't, in the locale lang.
+func (a *app) checkBranchCapacity(b booking, duration time.Duration, lang string) *bookingError {
+	branch := branchFor(b)
+	if branch.MaxBookingsPerDay <= 0 && branch.Chairs <= 0 {
+		return nil
+	}
+	bookings, err := a.store.List()
+	if err != nil {
+		slog.Error("Couldn't count bookings", "branch", b.Branch, "booking_time", *b.BookingTime, "err", err)
+		return &bookingError{http.StatusInternalServerError, codeInternal, translate(lang, "internal_error"), "", nil}
+	}
+	if dayFull(bookings, b) {
+		return &bookingError{http.StatusConflict, codeDayFull, translate(lang, "day_full"), "date", nil}
+	}
+	if !chairFree(bookings, b, duration) {
+		return &bookingError{http.StatusConflict, codeSlotTaken, translate(lang, "slot_taken"), "date", nil}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBookingsPerDayCap(t *testing.T) {
+	a, _ := newTestApp(t)
+	amsterdam, rotterdam := testBranch(), testBranch()
+	amsterdam.Name, amsterdam.MaxBookingsPerDay = "Amsterdam", 2
+	rotterdam.Name = "Rotterdam"
+	cfg.Branches = []Branch{amsterdam, rotterdam}
+
+	for _, clock := range []string{"10:00", "14:00"} {
+		bookForTest(t, a, "branch", "Amsterdam", "time", clock)
+	}
+	// A third booking that day is one over the cap, so it's turned down, whatever the time.
+	w := postForm(a.bbScheduler, "/", bookingForm("branch", "Amsterdam", "time", "16:00"), "Accept", "application/json")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusConflict)
+	}
+	var response bookingResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != codeDayFull {
+		t.Errorf("got code %q, want %q", response.Code, codeDayFull)
+	}
+
+	// The next day, and the other branch, still take bookings.
+	bookForTest(t, a, "branch", "Amsterdam", "date", "2026-03-12", "time", "16:00")
+	bookForTest(t, a, "branch", "Rotterdam", "time", "16:00")
+	// Cancelled bookings don't count.
+	bookings, err := a.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookings[0].Cancelled = true
+	if err := a.store.Update(bookings[0]); err != nil {
+		t.Fatal(err)
+	}
+	bookForTest(t, a, "branch", "Amsterdam", "time", "16:00")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/messagebird/go-rest-api"
+)
+
+// mbErrNotFound is the MessageBird error code for something that doesn't exist, like a message that was deleted.
+const mbErrNotFound = 20
+
+// Reminder states, as shown on the booking status page. For SMS reminders, they come from MessageBird.
+const (
+	stateScheduled = "scheduled"
+	stateSent      = "sent"
+	stateDelivered = "delivered"
+	stateFailed    = "failed"
+	stateCancelled = "cancelled"
+	stateUnknown   = "unknown"
+)
+
+// stateStatuses maps the reminder states MessageBird can tell us about to the reminder statuses we record on a booking.
+var stateStatuses = map[string]string{
+	stateScheduled: reminderPending,
+	stateSent:      reminderPending,
+	stateDelivered: reminderDelivered,
+	stateFailed:    reminderFailed,
+}
+
+// bookingStatusPage is the data for views/status.gohtml.
+type bookingStatusPage struct {
+	Booking   booking
+	Reminders []reminderState
+	// Time is the time of the booking at its branch, formatted for the customer.
+	Time string
+	// CancelLink is where the customer can cancel the booking: see cancelLink.
+	CancelLink string
+	Message    string
+	Lang       string
+}
+
+// reminderState is what we know about one of a booking's reminders.
+type reminderState struct {
+	// Channel is how the reminder is sent, like "sms", "whatsapp" or "email".
+	Channel string
+	// SendAt is when the reminder is due, formatted for the customer. It's empty if we don't know.
+	SendAt string
+	// State is one of the state constants, like stateScheduled.
+	State string
+}
+
+// bookingPages serves the pages under /bookings/{id}: the booking's status page, and its calendar file.
+func (a *app) bookingPages(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/calendar.ics") {
+		a.bookingCalendar(w, r)
+		return
+	}
+	a.bookingStatus(w, r)
+}
+
+// bookingStatus serves /bookings/{id}, or /bookings/{reference}: a page that shows the state of each of the booking's reminders, so that
+// customers can check their reminder is still on its way. It asks MessageBird about SMS reminders, and records
+// what it says on the booking, in case we missed a status report.
+func (a *app) bookingStatus(w http.ResponseWriter, r *http.Request) {
+	lang := requestLocale(r)
+	id := strings.TrimPrefix(r.URL.Path, "/bookings/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	thisBooking, err := findBooking(a.store, id)
+	if err != nil {
+		if err != errBookingNotFound {
+			slog.Error("Couldn't get booking", "booking_id", id, "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		renderPage(w, http.StatusNotFound, "views/status.gohtml", bookingStatusPage{Message: translate(lang, "booking_not_found"), Lang: lang})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+	defer cancel()
+	page := bookingStatusPage{
+		Booking:    thisBooking,
+		Time:       localTime(thisBooking).Format(translate(lang, "date_format")),
+		CancelLink: cancelLink(thisBooking),
+		Lang:       lang,
+	}
+	changed := false
+	for _, messageID := range thisBooking.MessageIDs {
+		state, err := a.reminderState(ctx, &thisBooking, messageID, lang)
+		if err != nil {
+			slog.Warn("Couldn't get reminder status", "booking_id", thisBooking.ID, "message_id", messageID, "err", maskPhones(err.Error()))
+			page.Message = translate(lang, "reminder_status_failed")
+		}
+		if status, ok := stateStatuses[state.State]; ok && !isLocalReminder(messageID) && thisBooking.ReminderStatuses[messageID] != status {
+			if thisBooking.ReminderStatuses == nil {
+				thisBooking.ReminderStatuses = make(map[string]string)
+			}
+			thisBooking.ReminderStatuses[messageID] = status
+			changed = true
+		}
+		page.Reminders = append(page.Reminders, state)
+	}
+	if changed {
+		if err := a.store.Update(thisBooking); err != nil {
+			slog.Error("Couldn't save reminder status", "booking_id", thisBooking.ID, "err", err)
+		}
+	}
+	renderPage(w, http.StatusOK, "views/status.gohtml", page)
+}
+
+// reminderState returns the state of b's reminder with messageID. Reminders we send ourselves, like WhatsApp and
+// email reminders, are scheduled for as long as their timer runs, or until the dispatcher sends them; for SMS
+// reminders, we ask MessageBird. If that fails, the state is stateUnknown, and the error is returned too.
+func (a *app) reminderState(ctx context.Context, b *booking, messageID, lang string) (reminderState, error) {
+	if isLocalReminder(messageID) {
+		// Local ids look like "local-whatsapp-0123456789abcdef".
+		kind, _, _ := strings.Cut(strings.TrimPrefix(messageID, localReminderPrefix), "-")
+		state := reminderState{Channel: kind, State: stateUnknown}
+		_, isDispatched := dispatchedReminderTime(messageID)
+		switch {
+		case a.timers != nil && a.timers.pending(messageID):
+			state.State = stateScheduled
+		case b.Cancelled:
+			state.State = stateCancelled
+		case isDispatched && b.ReminderStatuses[messageID] == reminderPending:
+			// The dispatcher hasn't got to it yet. Once it has, the reminder has MessageBird's id instead.
+			state.State = stateScheduled
+		case b.ReminderStatuses[messageID] == reminderDelivered:
+			state.State = stateSent
+		case b.ReminderStatuses[messageID] == reminderFailed:
+			state.State = stateFailed
+		}
+		// Otherwise, it's either been sent, or it was lost when we restarted; we can't tell which.
+		return state, nil
+	}
+
+	state := reminderState{Channel: channelSMS, State: stateUnknown}
+	msg, err := a.client.ReadSMS(ctx, messageID)
+	if isNotFound(err) {
+		// MessageBird forgets about scheduled messages we delete, which is what we do when a booking is cancelled.
+		state.State = stateCancelled
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if msg.ScheduledDatetime != nil {
+		state.SendAt = formatIn(*msg.ScheduledDatetime, branchFor(*b), lang)
+	}
+	state.State = messageState(msg.Recipients.Items)
+	return state, nil
+}
+
+// messageState sums up the statuses of an SMS's recipients, which for our reminders is always just the one customer.
+func messageState(recipients []messagebird.Recipient) string {
+	state := stateUnknown
+	for _, recipient := range recipients {
+		switch recipient.Status {
+		case "scheduled":
+			state = stateScheduled
+		case "sent", "buffered":
+			state = stateSent
+		case "delivered":
+			state = stateDelivered
+		case "expired", "delivery_failed":
+			return stateFailed
+		}
+	}
+	return state
+}
+
+// formatIn formats t for the customer, at branch's local time.
+func formatIn(t time.Time, branch Branch, lang string) string {
+	if branch.Timezone != nil {
+		t = t.In(branch.Timezone)
+	}
+	return t.Format(translate(lang, "date_format"))
+}
+
+// isNotFound reports whether err is MessageBird telling us that what we asked for doesn't exist.
+func isNotFound(err error) bool {
+	var errorResponse messagebird.ErrorResponse
+	if !errors.As(err, &errorResponse) {
+		return false
+	}
+	for _, e := range errorResponse.Errors {
+		if e.Code == mbErrNotFound {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// errBookingNotFound is returned by a Store when there is no booking with the requested id.
+var errBookingNotFound = errors.New("booking not found")
+
+// errReferenceTaken is returned by a Store when another booking already has the reference of the booking it saves.
+var errReferenceTaken = errors.New("booking reference taken")
+
+// Store saves bookings so that they outlive the request that made them.
+type Store interface {
+	// Save stores b and returns the id it was saved under: b's own, if it has one, or a new one.
+	Save(b booking) (id string, err error)
+	// SaveIfAvailable stores b, which must have its id, if available reports that the other stored bookings leave
+	// room for it, and reports whether it did. No other booking is saved or moved between the check and saving b,
+	// so two bookings made at the same time can't both take the last of something.
+	SaveIfAvailable(b booking, available func(bookings []booking) bool) (ok bool, err error)
+	// UpdateIfAvailable replaces the stored booking that has the same id as b, like Update, if available reports
+	// that the stored bookings leave room for b, and reports whether it did. Like SaveIfAvailable, no other booking
+	// is saved or moved between the check and the update, so that a booking moved to another time can't take the
+	// last of something there that another booking took at the same time.
+	UpdateIfAvailable(b booking, available func(bookings []booking) bool) (ok bool, err error)
+	// Get returns the booking with the given id, or errBookingNotFound.
+	Get(id string) (booking, error)
+	// GetByReference returns the booking with the given reference, as newBookingReference writes it,
+	// or errBookingNotFound.
+	GetByReference(reference string) (booking, error)
+	// GetByMessageID returns the booking that has a reminder with the given MessageBird message id, or errBookingNotFound.
+	GetByMessageID(messageID string) (booking, error)
+	// Update replaces the stored booking that has the same id as b.
+	Update(b booking) error
+	// List returns every stored booking.
+	List() ([]booking, error)
+}
+
+// memoryStore is a Store that keeps bookings in memory. Bookings are lost when the application stops.
+type memoryStore struct {
+	mu       sync.Mutex
+	bookings []booking
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) Save(b booking) (string, error) {
+	if b.ID == "" {
+		id, err := newBookingID()
+		if err != nil {
+			return "", err
+		}
+		b.ID = id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.referenceTaken(b.Reference) {
+		return "", errReferenceTaken
+	}
+	s.bookings = append(s.bookings, cloneBooking(b))
+	return b.ID, nil
+}
+
+func (s *memoryStore) SaveIfAvailable(b booking, available func([]booking) bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// available only reads the bookings, so it doesn't need copies of them.
+	if !available(s.bookings) {
+		return false, nil
+	}
+	if s.referenceTaken(b.Reference) {
+		return false, errReferenceTaken
+	}
+	s.bookings = append(s.bookings, cloneBooking(b))
+	return true, nil
+}
+
+func (s *memoryStore) UpdateIfAvailable(b booking, available func([]booking) bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !available(s.bookings) {
+		return false, nil
+	}
+	for i := range s.bookings {
+		if s.bookings[i].ID == b.ID {
+			s.bookings[i] = cloneBooking(b)
+			return true, nil
+		}
+	}
+	return false, errBookingNotFound
+}
+
+// referenceTaken reports whether a stored booking has reference. s.mu must be held.
+func (s *memoryStore) referenceTaken(reference string) bool {
+	if reference == "" {
+		return false
+	}
+	for _, b := range s.bookings {
+		if b.Reference == reference {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) Get(id string) (booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.bookings {
+		if b.ID == id {
+			return cloneBooking(b), nil
+		}
+	}
+	return booking{}, errBookingNotFound
+}
+
+func (s *memoryStore) GetByReference(reference string) (booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reference == "" {
+		return booking{}, errBookingNotFound
+	}
+	for _, b := range s.bookings {
+		if b.Reference == reference {
+			return cloneBooking(b), nil
+		}
+	}
+	return booking{}, errBookingNotFound
+}
+
+func (s *memoryStore) GetByMessageID(messageID string) (booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.bookings {
+		for _, id := range b.MessageIDs {
+			if id == messageID {
+				return cloneBooking(b), nil
+			}
+		}
+	}
+	return booking{}, errBookingNotFound
+}
+
+func (s *memoryStore) Update(b booking) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.bookings {
+		if s.bookings[i].ID == b.ID {
+			s.bookings[i] = cloneBooking(b)
+			return nil
+		}
+	}
+	return errBookingNotFound
+}
+
+func (s *memoryStore) List() ([]booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bookings := make([]booking, len(s.bookings))
+	for i, b := range s.bookings {
+		bookings[i] = cloneBooking(b)
+	}
+	return bookings, nil
+}
+
+// cloneBooking returns a copy of b that shares no slices or maps with it,
+// so that callers can't change stored bookings without calling Update.
+func cloneBooking(b booking) booking {
+	if b.BookingTime != nil {
+		bookingTime := *b.BookingTime
+		b.BookingTime = &bookingTime
+	}
+	b.MessageIDs = append([]string(nil), b.MessageIDs...)
+	b.StaleMessageIDs = append([]string(nil), b.StaleMessageIDs...)
+	b.Phones = append([]string(nil), b.Phones...)
+	if b.ReminderStatuses != nil {
+		reminderStatuses := make(map[string]string, len(b.ReminderStatuses))
+		for id, status := range b.ReminderStatuses {
+			reminderStatuses[id] = status
+		}
+		b.ReminderStatuses = reminderStatuses
+	}
+	return b
+}
+
+// newBookingID returns a random, hard to guess booking id.
+func newBookingID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// referenceAlphabet is Crockford's base32: digits and capitals, without I, L and O, which are easily mistaken for
+// 1 and 0, and U, so that references don't spell words.
+const referenceAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// referenceLength is how many characters of referenceAlphabet a booking reference has: 60 random bits, about as
+// many as a booking id, so that guessing one is as hopeless.
+const referenceLength = 12
+
+// referenceAttempts is how many references newBookingReference tries before it gives up. With 60 random bits,
+// even the second is only needed once in a very long while.
+const referenceAttempts = 5
+
+// newBookingReference returns a random booking reference that no booking in s has, like "7KQ2-M9XD-4HRT".
+// It's what we give customers to quote, on the phone or in the cancel form: shorter than a booking id, without
+// letters that look alike, and split in groups of four, so that it's easy to read out. References are random, not
+// counted, so they don't tell anybody how many bookings there are, or lead to anyone else's.
+// Stores also turn down a reference that's taken, in case two bookings draw the same one at the same time.
+func newBookingReference(s Store) (string, error) {
+	for attempt := 0; attempt < referenceAttempts; attempt++ {
+		b := make([]byte, referenceLength)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		// 256 is a multiple of 32, so each character is as likely as any other.
+		for i := range b {
+			b[i] = referenceAlphabet[b[i]%32]
+		}
+		reference := string(b[:4]) + "-" + string(b[4:8]) + "-" + string(b[8:])
+		if _, err := s.GetByReference(reference); err != errBookingNotFound {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		return reference, nil
+	}
+	return "", fmt.Errorf("no free booking reference after %d attempts", referenceAttempts)
+}
+
+// normalizeReference returns s the way newBookingReference writes references, however the customer typed it:
+// in any case, with or without dashes and spaces, and with O for 0 or I and L for 1. It reports false if s can't
+// be a reference.
+func normalizeReference(s string) (string, bool) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		switch r {
+		case '-', ' ':
+			continue
+		case 'O':
+			r = '0'
+		case 'I', 'L':
+			r = '1'
+		}
+		if !strings.ContainsRune(referenceAlphabet, r) {
+			return "", false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() != referenceLength {
+		return "", false
+	}
+	reference := b.String()
+	return reference[:4] + "-" + reference[4:8] + "-" + reference[8:], true
+}
+
+// findBooking returns the booking in s that a customer means by idOrReference: its id, or its reference.
+// Bookings from before we had references only have their id.
+func findBooking(s Store, idOrReference string) (booking, error) {
+	if reference, ok := normalizeReference(idOrReference); ok {
+		return s.GetByReference(reference)
+	}
+	return s.Get(idOrReference)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// referencelessStore is a Store that can't look bookings up by reference, so newBookingReference fails.
+type referencelessStore struct {
+	Store
+}
+
+var errReferencesDown = errors.New("references are down")
+
+func (referencelessStore) GetByReference(string) (booking, error) {
+	return booking{}, errReferencesDown
+}
+
+func TestBookingReferenceFailureSchedulesNothing(t *testing.T) {
+	a, client := newTestApp(t)
+	a.store = referencelessStore{a.store}
+
+	w := postForm(a.bbScheduler, "/", bookingForm(), "Accept", "application/json")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	var response bookingResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != codeInternal {
+		t.Errorf("got code %q, want %q", response.Code, codeInternal)
+	}
+	if len(client.Messages) != 0 {
+		t.Errorf("%d reminders are scheduled, want none", len(client.Messages))
+	}
+}
+
+func TestUpdateIfAvailableRaces(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return newMemoryStore() },
+		"sql":    func(t *testing.T) Store { return newTestSQLStore(t) },
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			const n = 8
+			start := time.Date(2026, 3, 11, 13, 0, 0, 0, time.UTC)
+			var bookings []booking
+			for i := 0; i < n; i++ {
+				bookingTime := start.Add(time.Duration(i+1) * time.Hour)
+				b := booking{ID: strconv.Itoa(i), Name: "Jane", Treatment: "Haircut", BookingTime: &bookingTime}
+				if _, err := s.Save(b); err != nil {
+					t.Fatal(err)
+				}
+				bookings = append(bookings, b)
+			}
+
+			// Every booking tries to move to start, which is only free as long as none of the others moved there.
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			updated := 0
+			for _, b := range bookings {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					b.BookingTime = &start
+					ok, err := s.UpdateIfAvailable(b, func(bookings []booking) bool {
+						for _, other := range bookings {
+							if other.ID != b.ID && other.BookingTime.Equal(start) {
+								return false
+							}
+						}
+						return true
+					})
+					if err != nil {
+						t.Error(err)
+					}
+					if ok {
+						mu.Lock()
+						updated++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if updated != 1 {
+				t.Errorf("%d bookings were moved, want 1", updated)
+			}
+			stored, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := 0
+			for _, b := range stored {
+				if b.BookingTime.Equal(start) {
+					at++
+				}
+			}
+			if at != 1 {
+				t.Errorf("%d bookings are stored at %v, want 1", at, start)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// With TLS, we serve HTTPS on defaultTLSListenAddr and redirect plain HTTP to it from defaultRedirectAddr,
+// unless LISTEN_ADDR and HTTP_REDIRECT_ADDR say otherwise. Let's Encrypt checks that we own a domain on port 80,
+// so with TLS_DOMAINS, defaultRedirectAddr is where it has to reach us.
+const (
+	defaultTLSListenAddr = ":443"
+	defaultRedirectAddr  = ":80"
+)
+
+// defaultCertCacheDir is where we keep the certificates we get from Let's Encrypt when TLS_CACHE_DIR is not set,
+// so that we don't ask for new ones every time we start.
+const defaultCertCacheDir = "certs"
+
+// tlsEnabled reports whether we serve HTTPS ourselves, with certificates from Let's Encrypt or from files.
+func tlsEnabled() bool {
+	return len(cfg.TLSDomains) > 0 || cfg.TLSCertFile != ""
+}
+
+// newCertManager returns the autocert.Manager that gets certificates for cfg.TLSDomains from Let's Encrypt,
+// and renews them before they expire. It turns down every other domain, so that requests for domains we don't
+// serve can't make us ask for certificates.
+func newCertManager() *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.TLSDomains...),
+		Cache:      autocert.DirCache(cfg.TLSCacheDir),
+		Email:      cfg.TLSEmail,
+	}
+}
+
+// serverTLSConfig returns the TLS configuration to serve HTTPS with: manager's, if we get our certificates from
+// Let's Encrypt, or one with the certificate in cfg.TLSCertFile and cfg.TLSKeyFile. Loading those here, rather than
+// when we start serving, means that a missing or broken certificate stops the application before it says it's ready.
+func serverTLSConfig(manager *autocert.Manager) (*tls.Config, error) {
+	if manager != nil {
+		return manager.TLSConfig(), nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS, on the port we serve HTTPS on.
+// It uses 308 Permanent Redirect, so that a form posted over plain HTTP is posted again over HTTPS, rather than
+// turned into a GET.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, port, err := net.SplitHostPort(cfg.ListenAddr); err == nil && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
+
+// redirectHandler returns the handler for plain HTTP when we serve HTTPS: redirectToHTTPS, and with manager,
+// Let's Encrypt's checks that we own our domains.
+func redirectHandler(manager *autocert.Manager) http.Handler {
+	if manager != nil {
+		return manager.HTTPHandler(http.HandlerFunc(redirectToHTTPS))
+	}
+	return http.HandlerFunc(redirectToHTTPS)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/messagebird/go-rest-api/voicemessage"
+)
+
+// voiceLanguages are the languages MessageBird reads voice reminders out in, by the locale of the reminder.
+var voiceLanguages = map[string]string{
+	"en": "en-gb",
+	"nl": "nl-nl",
+	"de": "de-de",
+}
+
+// voiceLanguage returns the language MessageBird reads out a reminder in the locale lang in.
+func voiceLanguage(lang string) string {
+	if language, ok := voiceLanguages[lang]; ok {
+		return language
+	}
+	return voiceLanguages[defaultLocale]
+}
+
+// voicePhoneTypes are the kinds of phone numbers we can call. Customers who choose voice reminders can book with
+// any of them on top of cfg.PhoneTypes, because they don't need to receive an SMS.
+var voicePhoneTypes = []string{"mobile", "fixed line", "fixed line or mobile", "voip", "personal number"}
+
+// phoneTypesFor returns the kinds of phone numbers we take for reminders on channel. If it's empty, we take any.
+func phoneTypesFor(channel string) []string {
+	if channel != channelVoice || len(cfg.PhoneTypes) == 0 {
+		return cfg.PhoneTypes
+	}
+	return append(append([]string(nil), cfg.PhoneTypes...), voicePhoneTypes...)
+}
+
+// callVoice calls phone from cfg.VoiceOriginator, and reads text, in the locale lang, out with text-to-speech.
+// Like an SMS, the call is retried if MessageBird can't be reached.
+func (a *app) callVoice(ctx context.Context, phone, text, lang string) error {
+	return retry(ctx, "create voice message", func() error {
+		_, err := a.client.CreateVoiceMessage(ctx, []string{phone}, text, &voicemessage.Params{
+			Originator: cfg.VoiceOriginator,
+			Language:   voiceLanguage(lang),
+			// Read it out twice, in case they missed the start.
+			Repeat: 2,
+			// Leave the reminder on their voicemail if they don't pick up.
+			IfMachine: "continue",
+		})
+		return err
+	})
+}
+
+// scheduleVoice schedules a call to phone at callAt that reads out text, in the locale lang, and returns the reminder's id.
+// We keep our own timer for it, like for WhatsApp reminders, so that cancelling a booking cancels its calls too.
+func (a *app) scheduleVoice(phone, text, lang string, callAt time.Time) (string, error) {
+	return a.timers.schedule(channelVoice, callAt.Sub(a.now()), func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.APITimeout)
+		defer cancel()
+		if err := a.callVoice(ctx, phone, text, lang); err != nil {
+			slog.Error("Couldn't place voice reminder", "phone", maskPhone(phone), "err", maskPhones(err.Error()))
+			return
+		}
+		slog.Info("Placed voice reminder", "phone", maskPhone(phone))
+	})
+}
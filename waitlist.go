@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// waitlistHold is how long we keep a freed slot for the customer we offer it to, before we offer it to the next one.
+const waitlistHold = 2 * time.Hour
+
+// waitlistEntry is a customer waiting for a slot that was taken when they tried to book it.
+type waitlistEntry struct {
+	ID        string
+	Name      string
+	Treatment string
+	Staff     string
+	Branch    string
+	// Phone is where we tell the customer the slot is free: the contact number of the booking they tried to make.
+	Phone       string
+	BookingTime time.Time
+	Created     time.Time
+	// HoldUntil is set once we've offered the customer the slot. Until then, nobody else can book it.
+	HoldUntil time.Time
+}
+
+// Waitlist keeps the customers waiting for a slot.
+type Waitlist interface {
+	// Add stores e and returns the id it was saved under.
+	Add(e waitlistEntry) (id string, err error)
+	// Update replaces the stored entry that has the same id as e.
+	Update(e waitlistEntry) error
+	// Remove deletes the entry with the given id. Removing an entry that doesn't exist isn't an error.
+	Remove(id string) error
+	// List returns every entry, in the order they were added.
+	List() ([]waitlistEntry, error)
+}
+
+// memoryWaitlist is a Waitlist that keeps entries in memory. Entries are lost when the application stops.
+type memoryWaitlist struct {
+	mu      sync.Mutex
+	entries []waitlistEntry
+}
+
+func newMemoryWaitlist() *memoryWaitlist {
+	return &memoryWaitlist{}
+}
+
+func (l *memoryWaitlist) Add(e waitlistEntry) (string, error) {
+	id, err := newBookingID()
+	if err != nil {
+		return "", err
+	}
+	e.ID = id
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	return id, nil
+}
+
+func (l *memoryWaitlist) Update(e waitlistEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.entries {
+		if l.entries[i].ID == e.ID {
+			l.entries[i] = e
+			return nil
+		}
+	}
+	return errBookingNotFound
+}
+
+func (l *memoryWaitlist) Remove(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.entries {
+		if l.entries[i].ID == id {
+			l.entries = append(l.entries[:i], l.entries[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *memoryWaitlist) List() ([]waitlistEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]waitlistEntry(nil), l.entries...), nil
+}
+
+// sameSlot reports whether e is waiting for the slot of b: the same stylist, at the same branch and time.
+func (e waitlistEntry) sameSlot(b booking) bool {
+	return e.Staff == b.Staff && e.Branch == b.Branch && e.BookingTime.Equal(*b.BookingTime)
+}
+
+// writeBookingError responds to a booking that failed with berr, like writeBookingResult. If the slot was taken,
+// the booking form offers to put the customer on the waitlist for it, with a signed copy of b like the confirmation step.
+func (a *app) writeBookingError(w http.ResponseWriter, r *http.Request, b booking, berr *bookingError, lang string) {
+	if berr.Code != codeStaffUnavailable || a.waitlist == nil || a.confirmationKey == nil || wantsJSON(r) {
+		response := errorResponse(berr)
+		response.SuggestedTime = b.SuggestedTime
+		writeBookingResult(w, r, berr.Status, b, response, lang)
+		return
+	}
+	token, err := signConfirmation(a.confirmationKey, confirmation{Booking: b, Expires: a.now().Add(confirmationWindow)})
+	if err != nil {
+		slog.Error("Couldn't sign waitlist offer", "err", err)
+		writeBookingResult(w, r, berr.Status, b, errorResponse(berr), lang)
+		return
+	}
+	renderPage(w, berr.Status, "views/booking.gohtml", bookingContainer{
+		Booking:        b,
+		Message:        berr.Message,
+		Field:          berr.Field,
+		Lang:           lang,
+		IdempotencyKey: newIdempotencyKey(),
+		Waitlist:       token,
+	})
+}
+
+// joinWaitlist puts the customer on the waitlist for the slot they couldn't book. The booking form posts the signed
+// booking writeBookingError offered in "waitlist", so that we know it's a booking we checked.
+func (a *app) joinWaitlist(w http.ResponseWriter, r *http.Request) {
+	lang := requestLocale(r)
+	if r.Method != "POST" || a.waitlist == nil || a.confirmationKey == nil {
+		http.NotFound(w, r)
+		return
+	}
+	empty := booking{}
+	empty.MinDate, empty.MaxDate = a.bookableDates()
+	c, err := verifyConfirmation(a.confirmationKey, r.FormValue("waitlist"), a.now())
+	if err != nil {
+		berr := &bookingError{http.StatusBadRequest, codeInvalidConfirmation, translate(lang, "invalid_confirmation"), "", nil}
+		writeBookingResult(w, r, berr.Status, empty, errorResponse(berr), lang)
+		return
+	}
+	b := c.Booking
+
+	entries, err := a.waitlist.List()
+	if err == nil {
+		for _, e := range entries {
+			if e.Phone == b.ContactPhone && e.sameSlot(b) {
+				// Already waiting; posting the form twice doesn't put them in the queue twice.
+				writeBookingResult(w, r, http.StatusOK, empty, bookingResponse{Message: translate(lang, "waitlisted", localTime(b).Format(translate(lang, "date_format")))}, lang)
+				return
+			}
+		}
+		_, err = a.waitlist.Add(waitlistEntry{
+			Name:        b.Name,
+			Treatment:   b.Treatment,
+			Staff:       b.Staff,
+			Branch:      b.Branch,
+			Phone:       b.ContactPhone,
+			BookingTime: *b.BookingTime,
+			Created:     a.now(),
+		})
+	}
+	if err != nil {
+		slog.Error("Couldn't add to waitlist", "phone", maskPhone(b.ContactPhone), "booking_time", *b.BookingTime, "err", err)
+		berr := &bookingError{http.StatusInternalServerError, codeStoreFailed, translate(lang, "waitlist_failed"), "", nil}
+		writeBookingResult(w, r, berr.Status, empty, errorResponse(berr), lang)
+		return
+	}
+	slog.Info("Added to waitlist", "phone", maskPhone(b.ContactPhone), "staff", b.Staff, "booking_time", *b.BookingTime)
+	writeBookingResult(w, r, http.StatusOK, empty, bookingResponse{Message: translate(lang, "waitlisted", localTime(b).Format(translate(lang, "date_format")))}, lang)
+}
+
+// heldByOther reports whether someone on the waitlist, other than b's contact, has been offered a slot that overlaps
+// duration from b's booking time, and can still book it.
+func (a *app) heldByOther(b booking, duration time.Duration) (bool, error) {
+	if a.waitlist == nil || b.Staff == "" {
+		return false, nil
+	}
+	entries, err := a.waitlist.List()
+	if err != nil {
+		return false, err
+	}
+	now := a.now()
+	for _, e := range entries {
+		if e.Staff != b.Staff || e.Branch != b.Branch || e.Phone == b.ContactPhone || !e.HoldUntil.After(now) {
+			continue
+		}
+		treatment, _ := findTreatment(e.Treatment)
+		if overlaps(*b.BookingTime, duration, e.BookingTime, max(treatment.Duration, time.Minute)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// offerFreedSlot tells the first customer waiting for the slot of b, which was just cancelled or moved, that it's free,
+// and holds it for them for waitlistHold. If they don't book it by then, the next customer in line gets the offer.
+// Customers who had their chance are taken off the waitlist. Failures are only logged: the cancellation stands.
+func (a *app) offerFreedSlot(ctx context.Context, b booking) {
+	if a.waitlist == nil || b.Staff == "" {
+		return
+	}
+	entries, err := a.waitlist.List()
+	if err != nil {
+		slog.Error("Couldn't get waitlist", "err", err)
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+	now := a.now()
+	var next *waitlistEntry
+	for i, e := range entries {
+		if !e.sameSlot(b) {
+			continue
+		}
+		if !e.HoldUntil.IsZero() {
+			if e.HoldUntil.After(now) {
+				// Someone is already holding this slot.
+				return
+			}
+			a.waitlist.Remove(e.ID)
+			continue
+		}
+		if next == nil && !a.optedOut(e.Phone) {
+			next = &entries[i]
+		}
+	}
+	if next == nil || !next.BookingTime.After(now) {
+		return
+	}
+
+	// Make sure the slot really is free: a cancellation of one booking doesn't help if its stylist has another.
+	slot := booking{Staff: next.Staff, Branch: next.Branch, ContactPhone: next.Phone, BookingTime: &next.BookingTime}
+	treatment, _ := findTreatment(next.Treatment)
+	if available, err := a.staffAvailable(slot, treatment.Duration); err != nil || !available {
+		return
+	}
+
+	next.HoldUntil = now.Add(waitlistHold)
+	if err := a.waitlist.Update(*next); err != nil {
+		slog.Error("Couldn't hold slot for waitlist", "phone", maskPhone(next.Phone), "err", err)
+		return
+	}
+	branch := branchFor(slot)
+	text := "Good news, " + next.Name + "! " + next.Staff + " can do your " + next.Treatment + " at " + formatIn(next.BookingTime, branch, defaultLocale) +
+		" after all. We're keeping the slot for you until " + formatIn(next.HoldUntil, branch, defaultLocale) + ": book it on our website with this number."
+	if _, err := a.client.CreateSMS(ctx, branch.Originator, []string{next.Phone}, shorten(text, maxMessageSegments), nil); err != nil {
+		slog.Warn("Couldn't offer freed slot", "phone", maskPhone(next.Phone), "err", maskPhones(err.Error()))
+	} else {
+		slog.Info("Offered freed slot", "phone", maskPhone(next.Phone), "staff", next.Staff, "booking_time", next.BookingTime, "hold_until", next.HoldUntil)
+	}
+
+	// If they don't take it, offer it to the next one in line.
+	if a.timers != nil {
+		a.timers.schedule("waitlist", waitlistHold, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.APITimeout)
+			defer cancel()
+			a.offerFreedSlot(ctx, b)
+		})
+	}
+}
+
+// leaveWaitlist takes b's contact off the waitlist for b's slot, now that they've booked it.
+func (a *app) leaveWaitlist(b booking) {
+	if a.waitlist == nil || b.Staff == "" {
+		return
+	}
+	entries, err := a.waitlist.List()
+	if err != nil {
+		slog.Error("Couldn't get waitlist", "err", err)
+		return
+	}
+	for _, e := range entries {
+		if e.Phone == b.ContactPhone && e.sameSlot(b) {
+			a.waitlist.Remove(e.ID)
+		}
+	}
+}
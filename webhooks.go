@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reminder delivery statuses, as stored in booking.ReminderStatuses.
+const (
+	reminderPending   = "pending"
+	reminderDelivered = "delivered"
+	reminderFailed    = "failed"
+)
+
+// maxWebhookBody is the largest webhook request body we accept.
+const maxWebhookBody = 1 << 20
+
+// maxWebhookAge is how old a signed webhook request may be before we reject it, so that captured requests can't be replayed later.
+const maxWebhookAge = 5 * time.Minute
+
+// statusWebhook receives MessageBird status reports for our reminders, and records on the booking
+// whether each reminder was delivered, failed, or is still pending.
+// MessageBird sends the report as query parameters or as a form, with the message id in "id" and its status in "status".
+func (a *app) statusWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := verifyWebhook(r); err != nil {
+		slog.Warn("Rejected status report", "err", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		slog.Warn("Couldn't parse status report", "err", err)
+		http.Error(w, "Expected a valid form", http.StatusBadRequest)
+		return
+	}
+
+	messageID := r.FormValue("id")
+	status, ok := reminderStatus(r.FormValue("status"))
+	if messageID == "" || !ok {
+		http.Error(w, "Expected a message id and a valid status", http.StatusBadRequest)
+		return
+	}
+
+	thisBooking, err := a.store.GetByMessageID(messageID)
+	if err != nil {
+		// This isn't one of our reminders, or its booking is gone. Tell MessageBird we're done with it, so it doesn't retry.
+		if err != errBookingNotFound {
+			slog.Error("Couldn't get booking for status report", "message_id", messageID, "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if thisBooking.ReminderStatuses == nil {
+		thisBooking.ReminderStatuses = make(map[string]string)
+	}
+	thisBooking.ReminderStatuses[messageID] = status
+	if err := a.store.Update(thisBooking); err != nil {
+		slog.Error("Couldn't save reminder status", "booking_id", thisBooking.ID, "message_id", messageID, "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Reminder status", "booking_id", thisBooking.ID, "message_id", messageID, "status", status)
+	w.WriteHeader(http.StatusOK)
+}
+
+// reminderStatus maps a MessageBird message status to one of our reminder statuses.
+func reminderStatus(messageStatus string) (string, bool) {
+	switch messageStatus {
+	case "scheduled", "sent", "buffered":
+		return reminderPending, true
+	case "delivered":
+		return reminderDelivered, true
+	case "expired", "delivery_failed":
+		return reminderFailed, true
+	default:
+		return "", false
+	}
+}
+
+// verifyWebhook checks the MessageBird-Signature header of a webhook request against cfg.SigningKey.
+// If no signing key is configured, every request is accepted.
+// The signature is a base64 encoded HMAC-SHA256 of the request timestamp, the sorted query string
+// and the SHA-256 hash of the body, each separated by a newline.
+// verifyWebhook leaves r.Body in place, so the request can still be read afterwards.
+func verifyWebhook(r *http.Request) error {
+	if cfg.SigningKey == "" {
+		return nil
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get("MessageBird-Signature"))
+	if err != nil || len(signature) == 0 {
+		return errors.New("missing or malformed signature")
+	}
+	timestamp := r.Header.Get("MessageBird-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or malformed timestamp")
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > maxWebhookAge || age < -maxWebhookAge {
+		return errors.New("request timestamp is too far from the current time")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(cfg.SigningKey))
+	mac.Write([]byte(timestamp + "\n" + r.URL.Query().Encode() + "\n"))
+	mac.Write(bodyHash[:])
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("signature doesn't match")
+	}
+	return nil
+}
+
+// inboundWebhook receives the SMS replies customers send to our number. Replying "Y" confirms
+// the customer's next appointment, and "C" cancels it. We acknowledge each reply with a short SMS.
+// MessageBird sends the sender's number in "originator" and the text of the message in "body".
+func (a *app) inboundWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := verifyWebhook(r); err != nil {
+		slog.Warn("Rejected inbound message", "err", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		slog.Warn("Couldn't parse inbound message", "err", maskPhones(err.Error()))
+		http.Error(w, "Expected a valid form", http.StatusBadRequest)
+		return
+	}
+
+	sender := r.FormValue("originator")
+	keyword := strings.ToUpper(strings.TrimSpace(r.FormValue("body")))
+	if (keyword == keywordStop || keyword == keywordStart) && a.optOuts != nil {
+		a.optOutWebhook(w, r, sender, keyword)
+		return
+	}
+	thisBooking, err := a.nextBookingFor(sender)
+	if err != nil {
+		// We don't know this sender, or they have no upcoming appointments; don't spend an SMS replying.
+		if err != errBookingNotFound {
+			slog.Error("Couldn't find booking for inbound message", "phone", maskPhone(sender), "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Ignoring message from unknown sender", "phone", maskPhone(sender))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+	defer cancel()
+	lang := thisBooking.Language
+	appointment := localTime(thisBooking).Format(translate(lang, "date_format"))
+	var reply string
+	switch keyword {
+	case "Y":
+		thisBooking.Confirmed = true
+		if err := a.store.Update(thisBooking); err != nil {
+			slog.Error("Couldn't save confirmed booking", "booking_id", thisBooking.ID, "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		reply = translate(lang, "reply_confirmed", cfg.SalonName, appointment)
+	case "C":
+		if _, err := a.cancelReminders(ctx, thisBooking); err != nil {
+			slog.Error("Couldn't cancel reminders", "booking_id", thisBooking.ID, "err", err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		thisBooking.Cancelled = true
+		if err := a.store.Update(thisBooking); err != nil {
+			slog.Error("Couldn't save cancelled booking", "booking_id", thisBooking.ID, "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		a.offerFreedSlot(ctx, thisBooking)
+		reply = translate(lang, "reply_cancelled", cfg.SalonName, appointment)
+	default:
+		reply = translate(lang, "reply_unknown", cfg.SalonName, appointment)
+	}
+
+	if _, err := a.client.CreateSMS(ctx, branchFor(thisBooking).Originator, []string{sender}, reply, nil); err != nil {
+		slog.Error("Couldn't send reply", "phone", maskPhone(sender), "err", maskPhones(err.Error()))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// optOutWebhook handles the STOP and START keywords: customers can text us STOP to opt out of our text messages,
+// whether or not they have an upcoming booking, and START to opt back in. Either way, we reply to say it's done.
+func (a *app) optOutWebhook(w http.ResponseWriter, r *http.Request, sender, keyword string) {
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.APITimeout)
+	defer cancel()
+	// Reply from the branch of their next booking, if they have one, and in its language.
+	originator, lang := cfg.Branches[0].Originator, defaultLocale
+	if next, err := a.nextBookingFor(sender); err == nil {
+		originator, lang = branchFor(next).Originator, next.Language
+	}
+	var reply string
+	if keyword == keywordStop {
+		if err := a.stopTexting(ctx, sender); err != nil {
+			slog.Error("Couldn't opt out", "phone", maskPhone(sender), "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		reply = translate(lang, "reply_opted_out", cfg.SalonName, keywordStart)
+	} else {
+		if err := a.optOuts.OptIn(sender); err != nil {
+			slog.Error("Couldn't opt in", "phone", maskPhone(sender), "err", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Opted in", "phone", maskPhone(sender))
+		reply = translate(lang, "reply_opted_in", cfg.SalonName, keywordStop)
+	}
+
+	if _, err := a.client.CreateSMS(ctx, originator, []string{sender}, reply, nil); err != nil {
+		slog.Error("Couldn't send reply", "phone", maskPhone(sender), "err", maskPhones(err.Error()))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// nextBookingFor returns the earliest upcoming booking that hasn't been cancelled and has phone as its contact number,
+// which is where its reminders went, or errBookingNotFound.
+func (a *app) nextBookingFor(phone string) (booking, error) {
+	bookings, err := a.store.List()
+	if err != nil {
+		return booking{}, err
+	}
+	var next *booking
+	now := a.now()
+	for i, b := range bookings {
+		if b.Cancelled || b.BookingTime.Before(now) || !samePhone(b.ContactPhone, phone) {
+			continue
+		}
+		if next == nil || b.BookingTime.Before(*next.BookingTime) {
+			next = &bookings[i]
+		}
+	}
+	if next == nil {
+		return booking{}, errBookingNotFound
+	}
+	return *next, nil
+}
+
+// samePhone reports whether booked, a phone number as the customer entered it, is the same number as sender,
+// a phone number in international format as MessageBird sends it. Only digits are compared, and a booked
+// number starting with a single 0 is taken to be in national format, without its country code.
+func samePhone(booked, sender string) bool {
+	booked, sender = digitsOnly(booked), digitsOnly(sender)
+	if booked == "" || sender == "" {
+		return false
+	}
+	if booked == sender {
+		return true
+	}
+	if strings.HasPrefix(booked, "00") {
+		return booked[2:] == sender
+	}
+	return strings.HasPrefix(booked, "0") && strings.HasSuffix(sender, booked[1:])
+}
+
+// digitsOnly returns s with everything but the digits 0-9 removed.
+func digitsOnly(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c < '0' || c > '9' {
+			return -1
+		}
+		return c
+	}, s)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRepliesInBookingLanguage(t *testing.T) {
+	tests := []struct {
+		lang    string
+		keyword string
+		want    string
+	}{
+		{"en", "Y", "Thanks! Your Salon Jane appointment on Wed, 11 Mar 2026 2:00 PM is confirmed. See you then!"},
+		{"nl", "Y", "Bedankt! Je afspraak bij Salon Jane op 11-03-2026 14:00 is bevestigd. Tot dan!"},
+		{"de", "C", "Dein Termin bei Salon Jane am 11.03.2026 14:00 wurde abgesagt. Wir hoffen, dich ein anderes Mal zu sehen!"},
+		{"nl", "huh", "Sorry, dat begrepen we niet. Antwoord Y om je afspraak bij Salon Jane op 11-03-2026 14:00 te bevestigen, of C om hem te annuleren."},
+		{"de", keywordStop, "Du bekommst keine SMS mehr von Salon Jane. Antworte START, um sie wieder zu bekommen."},
+		{"nl", keywordStart, "Welkom terug! Salon Jane stuurt je weer sms'jes over je afspraken. Antwoord STOP om te stoppen."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+"/"+tt.keyword, func(t *testing.T) {
+			a, client := newTestApp(t)
+			a.optOuts = newMemoryOptOuts()
+			cfg.SalonName = "Salon Jane"
+			b := bookForTest(t, a, "lang", tt.lang)
+			sent := len(client.Messages)
+
+			w := postForm(a.inboundWebhook, "/webhook", url.Values{"originator": {b.ContactPhone}, "body": {tt.keyword}})
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			// The reply is the last message sent, in the language the customer booked in.
+			if len(client.Messages) == sent {
+				t.Fatal("no reply was sent")
+			}
+			if got := client.Messages[len(client.Messages)-1].Body; got != tt.want {
+				t.Errorf("got reply %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhooksRejectMalformedForms(t *testing.T) {
+	a, client := newTestApp(t)
+	a.optOuts = newMemoryOptOuts()
+	b := bookForTest(t, a)
+	sent := len(client.Messages)
+
+	for name, webhook := range map[string]http.HandlerFunc{"status": a.statusWebhook, "inbound": a.inboundWebhook} {
+		// Everything but the last value parses, which mustn't be taken for the whole message.
+		body := url.Values{"id": {b.MessageIDs[0]}, "status": {"delivered"}, "originator": {b.ContactPhone}, "body": {"C"}}.Encode() + "&x=%zz"
+		r := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		webhook(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s webhook got status %d, want %d", name, w.Code, http.StatusBadRequest)
+		}
+	}
+	got, err := a.store.Get(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cancelled || got.ReminderStatuses[b.MessageIDs[0]] != reminderPending || len(client.Messages) != sent {
+		t.Errorf("got cancelled %v, status %q and %d replies, want the booking left alone", got.Cancelled, got.ReminderStatuses[b.MessageIDs[0]], len(client.Messages)-sent)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/messagebird/go-rest-api/conversation"
+)
+
+// Reminder channels a customer can choose from.
+const (
+	channelSMS      = "sms"
+	channelWhatsApp = "whatsapp"
+	channelVoice    = "voice"
+)
+
+// sendWhatsApp sends text to phone on our WhatsApp channel.
+func (a *app) sendWhatsApp(ctx context.Context, phone, text string) error {
+	_, err := a.client.StartConversation(ctx, &conversation.StartRequest{
+		ChannelID: cfg.WhatsAppChannelID,
+		To:        phone,
+		Type:      conversation.MessageTypeText,
+		Content:   &conversation.MessageContent{Text: text},
+	})
+	return err
+}
+
+// scheduleWhatsApp schedules text to be sent to phone on WhatsApp at sendAt, and returns the reminder's id.
+func (a *app) scheduleWhatsApp(phone, text string, sendAt time.Time) (string, error) {
+	return a.timers.schedule(channelWhatsApp, sendAt.Sub(a.now()), func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.APITimeout)
+		defer cancel()
+		if err := a.sendWhatsApp(ctx, phone, text); err != nil {
+			slog.Error("Couldn't send WhatsApp reminder", "phone", maskPhone(phone), "err", maskPhones(err.Error()))
+		}
+	})
+}
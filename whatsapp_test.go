@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestWhatsAppWelcome(t *testing.T) {
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"en", "Hi! We'll send the Salon Jane appointment reminders for Jane here."},
+		{"nl", "Hoi! We sturen de afspraakherinneringen van Salon Jane voor Jane hierheen."},
+		{"de", "Hallo! Wir schicken die Terminerinnerungen von Salon Jane für Jane hierher."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			a, client := newTestApp(t)
+			cfg.WhatsAppChannelID = "whatsapp-channel"
+			cfg.SalonName = "Salon Jane"
+
+			if w := postForm(a.bbScheduler, "/", bookingForm("channel", channelWhatsApp, "lang", tt.lang)); w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			// The welcome goes out right away, in the customer's language, with the salon's own name.
+			if len(client.Conversations) == 0 {
+				t.Fatal("no welcome was sent")
+			}
+			if got := client.Conversations[0].Content.Text; got != tt.want {
+				t.Errorf("got welcome %q, want %q", got, tt.want)
+			}
+		})
+	}
+}